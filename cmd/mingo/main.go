@@ -14,6 +14,10 @@ const (
 	EXIT_UNKNOWN_HOST
 	EXIT_PORT_UNAVAILABLE
 	EXIT_HTTP_GRACEFUL_SHUTDOWN_FAILED
+	EXIT_TLS_UNAVAILABLE
+	EXIT_DATABASE_UNAVAILABLE
+	EXIT_BAD_COMMAND
+	EXIT_COMMAND_FAILED
 )
 
 // A thin adapter between the operating system and this app, responsible for:
@@ -22,7 +26,9 @@ const (
 //  	* invoking the app's bootstrap function
 //	* returning an exit code to the OS on app termination
 func main() {
-	if err := orchestrator.Orchestrate(os.Args[1:], os.Stderr); err == flag.ErrHelp {
+	if err := orchestrator.Orchestrate(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err == nil {
+		os.Exit(0)
+	} else if err == flag.ErrHelp {
 		os.Exit(EXIT_HELP)
 	} else if err == errors.ErrUnknownUser {
 		os.Exit(EXIT_UNKNOWN_USER)
@@ -30,6 +36,16 @@ func main() {
 		os.Exit(EXIT_UNKNOWN_HOST)
 	} else if err == errors.ErrPortUnavailable {
 		os.Exit(EXIT_PORT_UNAVAILABLE)
+	} else if err == errors.ErrTlsUnavailable {
+		os.Exit(EXIT_TLS_UNAVAILABLE)
+	} else if err == errors.ErrDatabaseUnavailable {
+		os.Exit(EXIT_DATABASE_UNAVAILABLE)
+	} else if err == errors.ErrBadCommand {
+		os.Exit(EXIT_BAD_COMMAND)
+	} else if err == errors.ErrCommandFailed {
+		os.Exit(EXIT_COMMAND_FAILED)
+	} else if err == errors.ErrShutdownFailed {
+		os.Exit(EXIT_HTTP_GRACEFUL_SHUTDOWN_FAILED)
 	} else {
 		os.Exit(EXIT_BAD_FLAG)
 	}
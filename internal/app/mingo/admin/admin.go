@@ -0,0 +1,63 @@
+package admin
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/config"
+	"github.com/craigjperry2/mingo/internal/app/mingo/database"
+	"github.com/craigjperry2/mingo/internal/app/mingo/errors"
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+// Run executes command, e.g. ["user", "add", "alice"], against the configured database, or for
+// log-level against the running server
+// Passwords are read from stdin, prompting without echo when it's a terminal. Results meant for
+// scripts, e.g. a new API token, go to stdout and everything else to stderr
+func Run(command []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	c := config.GetInstance()
+	if len(command) > 0 && command[0] == "log-level" {
+		srv, err := newServer(c, os.Getenv("MINGO_TOKEN"))
+		if err != nil {
+			fmt.Fprintf(stderr, "could not trust the server's certificate: %v\n", err)
+			return errors.ErrCommandFailed
+		}
+		return runLogLevel(srv, command[1:], stdout, stderr)
+	}
+	return run(c.GetDatabase(), c.GetClock(), command, stdin, stdout, stderr)
+}
+
+func run(db *database.Db, clock system.Clock, command []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	err := errors.ErrBadCommand
+	if len(command) > 0 {
+		switch command[0] {
+		case "user":
+			err = runUser(db, clock, command[1:], stdin, stderr)
+		case "token":
+			err = runToken(db, clock, command[1:], stdout, stderr)
+		}
+	}
+	if err == errors.ErrBadCommand {
+		fmt.Fprintf(stderr, "unknown command %q, see --help\n", strings.Join(command, " "))
+	}
+	return err
+}
+
+// Explain a failed command, collapsing all failures to ErrCommandFailed for the exit code
+func report(err error, stderr io.Writer, notFound string, duplicate string) error {
+	switch err {
+	case nil:
+		return nil
+	case errors.ErrCommandFailed, errors.ErrBadCommand:
+		return err
+	case errors.ErrNotFound:
+		fmt.Fprintln(stderr, notFound)
+	case errors.ErrDuplicate:
+		fmt.Fprintln(stderr, duplicate)
+	default:
+		fmt.Fprintln(stderr, err)
+	}
+	return errors.ErrCommandFailed
+}
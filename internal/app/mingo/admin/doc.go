@@ -0,0 +1,2 @@
+// Package admin implements the maintenance commands that run instead of the web server, e.g. `mingo user add alice`
+package admin
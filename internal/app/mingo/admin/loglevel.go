@@ -0,0 +1,100 @@
+package admin
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/certs"
+	"github.com/craigjperry2/mingo/internal/app/mingo/config"
+	"github.com/craigjperry2/mingo/internal/app/mingo/errors"
+	"github.com/craigjperry2/mingo/internal/app/mingo/logger"
+)
+
+// The running server as the log-level command reaches it, over loopback on the configured port
+type server struct {
+	url    string // e.g. http://localhost:8080
+	client *http.Client
+	token  string // an API token with the admin scope
+}
+
+func newServer(c *config.Config, token string) (server, error) {
+	scheme, client := "http", &http.Client{Timeout: 10 * time.Second}
+	if c.IsTlsEnabled() {
+		scheme = "https"
+		if c.GetTlsSelfSigned() {
+			pool, err := certs.LoadCertPool(filepath.Join(c.GetTlsDir(), certs.CaCertFile))
+			if err != nil {
+				return server{}, err
+			}
+			client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+		}
+	}
+	return server{scheme + "://localhost:" + c.GetListenPortStr(), client, token}, nil
+}
+
+// log-level [<component>=<level> ...]
+func runLogLevel(srv server, args []string, stdout io.Writer, stderr io.Writer) error {
+	if srv.token == "" {
+		fmt.Fprintln(stderr, "set MINGO_TOKEN to an API token with the admin scope, see token create")
+		return errors.ErrCommandFailed
+	}
+	method, body := http.MethodGet, []byte(nil)
+	if len(args) > 0 {
+		levels, err := logger.ParseLevels(strings.Join(args, ","))
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return errors.ErrCommandFailed
+		}
+		method = http.MethodPut
+		body, _ = json.Marshal(levels)
+	}
+
+	req, err := http.NewRequest(method, srv.url+"/admin/log-levels", bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return errors.ErrCommandFailed
+	}
+	req.Header.Set("Authorization", "Bearer "+srv.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := srv.client.Do(req)
+	if err != nil {
+		fmt.Fprintf(stderr, "could not reach the server at %s: %v\n", srv.url, err)
+		return errors.ErrCommandFailed
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var refusal struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&refusal)
+		fmt.Fprintf(stderr, "the server refused, %s: %s\n", resp.Status, refusal.Error)
+		return errors.ErrCommandFailed
+	}
+	var levels map[string]logger.Level
+	if err := json.NewDecoder(resp.Body).Decode(&levels); err != nil {
+		fmt.Fprintf(stderr, "unexpected reply from the server: %v\n", err)
+		return errors.ErrCommandFailed
+	}
+
+	var components []string
+	for component := range levels {
+		components = append(components, component)
+	}
+	sort.Strings(components) // "*", the default, sorts first
+	tw := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "COMPONENT\tLEVEL")
+	for _, component := range components {
+		fmt.Fprintf(tw, "%s\t%s\n", component, levels[component])
+	}
+	return tw.Flush()
+}
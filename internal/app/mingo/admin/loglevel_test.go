@@ -0,0 +1,62 @@
+package admin
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/errors"
+)
+
+func TestLogLevel(t *testing.T) {
+	var gotMethod, gotAuth, gotBody string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		b, _ := io.ReadAll(req.Body)
+		gotMethod, gotAuth, gotBody = req.Method, req.Header.Get("Authorization"), string(b)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"*":"warn","access":"off","sql":"debug"}`))
+	}))
+	defer ts.Close()
+	srv := server{ts.URL, ts.Client(), "mgo_secret"}
+
+	var stdout, stderr bytes.Buffer
+	if err := runLogLevel(srv, []string{"sql=debug", "access=off"}, &stdout, &stderr); err != nil {
+		t.Fatalf("err want nil, got %v: %s", err, stderr.String())
+	}
+	if gotMethod != http.MethodPut || gotAuth != "Bearer mgo_secret" || gotBody != `{"access":"off","sql":"debug"}` {
+		t.Errorf("request got %s %q %s", gotMethod, gotAuth, gotBody)
+	}
+	want := "COMPONENT  LEVEL\n*          warn\naccess     off\nsql        debug\n"
+	if stdout.String() != want {
+		t.Errorf("output got %q, want %q", stdout.String(), want)
+	}
+
+	if err := runLogLevel(srv, nil, io.Discard, io.Discard); err != nil || gotMethod != http.MethodGet {
+		t.Errorf("show got %v %s, want a GET", err, gotMethod)
+	}
+	if err := runLogLevel(srv, []string{"sql=loud"}, io.Discard, io.Discard); err != errors.ErrCommandFailed {
+		t.Errorf("bad level err got %v, want ErrCommandFailed", err)
+	}
+	if err := runLogLevel(server{ts.URL, ts.Client(), ""}, nil, io.Discard, io.Discard); err != errors.ErrCommandFailed {
+		t.Errorf("no token err got %v, want ErrCommandFailed", err)
+	}
+}
+
+func TestLogLevelRefused(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"error":"you don't have permission to manage logging"}`))
+	}))
+	defer ts.Close()
+
+	var stderr bytes.Buffer
+	if err := runLogLevel(server{ts.URL, ts.Client(), "mgo_secret"}, nil, io.Discard, &stderr); err != errors.ErrCommandFailed {
+		t.Errorf("err got %v, want ErrCommandFailed", err)
+	}
+	if want := "the server refused, 403 Forbidden: you don't have permission to manage logging\n"; stderr.String() != want {
+		t.Errorf("stderr got %q, want %q", stderr.String(), want)
+	}
+}
@@ -0,0 +1,126 @@
+package admin
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo"
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+	"github.com/craigjperry2/mingo/internal/app/mingo/database"
+	"github.com/craigjperry2/mingo/internal/app/mingo/errors"
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+const defaultTokenExpiry = 90 * 24 * time.Hour
+
+func runToken(db *database.Db, clock system.Clock, args []string, stdout io.Writer, stderr io.Writer) error {
+	if len(args) == 0 {
+		return errors.ErrBadCommand
+	}
+	switch args[0] {
+	case "create":
+		return createToken(db, clock, args[1:], stdout, stderr)
+	case "list":
+		return listTokens(db, args[1:], stdout, stderr)
+	case "revoke":
+		if len(args) != 2 {
+			return errors.ErrBadCommand
+		}
+		err := db.DeleteApiToken(context.Background(), args[1], 0)
+		if err == nil {
+			fmt.Fprintf(stderr, "revoked token %s\n", args[1])
+		}
+		return report(err, stderr, "no such token "+args[1], "")
+	}
+	return errors.ErrBadCommand
+}
+
+// token create [--scopes <list>] [--expires <duration>] <username> <name>
+func createToken(db *database.Db, clock system.Clock, args []string, stdout io.Writer, stderr io.Writer) error {
+	flags := flag.NewFlagSet("token create", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	scopeList := flags.String("scopes", auth.ScopeRead, "comma separated scopes: read, write, admin")
+	expires := flags.Duration("expires", defaultTokenExpiry, "lifetime of the token, 0 for never")
+	if err := flags.Parse(args); err != nil {
+		return errors.ErrBadCommand
+	}
+	if flags.NArg() != 2 {
+		return errors.ErrBadCommand
+	}
+	username, name := flags.Arg(0), strings.TrimSpace(flags.Arg(1))
+	scopes, err := auth.ParseScopes(*scopeList)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return errors.ErrCommandFailed
+	}
+	if *expires < 0 || name == "" || len(name) > 64 {
+		fmt.Fprintln(stderr, "--expires can't be negative and name must be 1 to 64 characters")
+		return errors.ErrCommandFailed
+	}
+
+	user, err := db.GetUserByUsername(context.Background(), username)
+	if err != nil {
+		return report(err, stderr, "no such user "+username, "")
+	}
+	token, id, secretHash, err := auth.NewApiToken()
+	if err != nil {
+		return report(err, stderr, "", "")
+	}
+	now := clock().UTC()
+	t := mingo.ApiToken{Id: id, UserId: user.Id, Name: name, SecretHash: secretHash, Scopes: scopes, CreatedAt: now}
+	if *expires > 0 {
+		t.ExpiresAt = now.Add(*expires)
+	}
+	if err := db.InsertApiToken(context.Background(), t); err != nil {
+		return report(err, stderr, "", "")
+	}
+	fmt.Fprintf(stderr, "created token %s for %s, it won't be shown again\n", id, user.Username)
+	fmt.Fprintln(stdout, token)
+	return nil
+}
+
+// token list [<username>]
+func listTokens(db *database.Db, args []string, stdout io.Writer, stderr io.Writer) error {
+	if len(args) > 1 {
+		return errors.ErrBadCommand
+	}
+	users, err := db.ListUsers(context.Background())
+	if err != nil {
+		return report(err, stderr, "", "")
+	}
+	usernames := map[int]string{}
+	userId := 0
+	for _, u := range users {
+		usernames[u.Id] = u.Username
+		if len(args) == 1 && strings.EqualFold(u.Username, args[0]) {
+			userId = u.Id
+		}
+	}
+	if len(args) == 1 && userId == 0 {
+		return report(errors.ErrNotFound, stderr, "no such user "+args[0], "")
+	}
+
+	tokens, err := db.ListApiTokens(context.Background(), userId)
+	if err != nil {
+		return report(err, stderr, "", "")
+	}
+	tw := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tUSER\tNAME\tSCOPES\tCREATED\tEXPIRES\tLAST USED")
+	for _, t := range tokens {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", t.Id, usernames[t.UserId], t.Name, strings.Join(t.Scopes, ","),
+			formatTime(t.CreatedAt), formatTime(t.ExpiresAt), formatTime(t.LastUsedAt))
+	}
+	return tw.Flush()
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,88 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+	"github.com/craigjperry2/mingo/internal/app/mingo/database"
+	"github.com/craigjperry2/mingo/internal/app/mingo/errors"
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+func TestTokenCommands(t *testing.T) {
+	ctx := context.Background()
+	clock := system.ClockForTesting("2022-04-30T23:59:59Z")
+	db := database.NewRealDatabase(":memory:")
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("migrate err want nil, got %v", err)
+	}
+	db.InsertUser(ctx, "alice", "unused", "editor", clock())
+
+	var stdout, stderr bytes.Buffer
+	err := run(db, clock, strings.Fields("token create --scopes read,write --expires 720h alice nightly-export"), nil, &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("create err want nil, got %v: %s", err, stderr.String())
+	}
+	id, _, ok := auth.ParseApiToken(strings.TrimSpace(stdout.String()))
+	if !ok {
+		t.Fatalf("create printed %q, want a token", stdout.String())
+	}
+	token, user, err := db.GetApiToken(ctx, id)
+	if err != nil || user.Username != "alice" || strings.Join(token.Scopes, ",") != "read,write" || !token.ExpiresAt.Equal(clock().Add(720*time.Hour)) {
+		t.Errorf("stored token got %+v for %s %v, want alice's read,write token expiring in 30 days", token, user.Username, err)
+	}
+
+	var tests = []struct {
+		command string
+		wantErr error
+		wantOut string
+	}{
+		{"token create alice", errors.ErrBadCommand, "unknown command \"token create alice\", see --help\n"},
+		{"token create --scopes root alice x", errors.ErrCommandFailed, "unknown scope \"root\", want read, write or admin\n"},
+		{"token create bob x", errors.ErrCommandFailed, "no such user bob\n"},
+		{"token list bob", errors.ErrCommandFailed, "no such user bob\n"},
+		{"token revoke 0000000000000000", errors.ErrCommandFailed, "no such token 0000000000000000\n"},
+		{"token revoke " + id, nil, "revoked token " + id + "\n"},
+		{"token", errors.ErrBadCommand, "unknown command \"token\", see --help\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			stderr.Reset()
+			err := run(db, clock, strings.Fields(tt.command), nil, &stdout, &stderr)
+			if err != tt.wantErr {
+				t.Errorf("err got %v, want %v", err, tt.wantErr)
+			}
+			if stderr.String() != tt.wantOut {
+				t.Errorf("stderr got %q, want %q", stderr.String(), tt.wantOut)
+			}
+		})
+	}
+}
+
+func TestTokenList(t *testing.T) {
+	ctx := context.Background()
+	clock := system.ClockForTesting("2022-04-30T23:59:59Z")
+	db := database.NewRealDatabase(":memory:")
+	defer db.Close()
+	db.Migrate()
+	db.InsertUser(ctx, "alice", "unused", "editor", clock())
+
+	var stdout, stderr bytes.Buffer
+	run(db, clock, strings.Fields("token create --expires 0 alice ci"), nil, &stdout, &stderr)
+	id, _, _ := auth.ParseApiToken(strings.TrimSpace(stdout.String()))
+
+	stdout.Reset()
+	if err := run(db, clock, strings.Fields("token list alice"), nil, &stdout, &stderr); err != nil {
+		t.Fatalf("list err want nil, got %v", err)
+	}
+	want := "ID                USER   NAME  SCOPES  CREATED               EXPIRES  LAST USED\n" +
+		id + "  alice  ci    read    2022-04-30T23:59:59Z  never    never\n"
+	if stdout.String() != want {
+		t.Errorf("list got\n%s\nwant\n%s", stdout.String(), want)
+	}
+}
@@ -0,0 +1,150 @@
+package admin
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+	"github.com/craigjperry2/mingo/internal/app/mingo/database"
+	"github.com/craigjperry2/mingo/internal/app/mingo/errors"
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+const minPasswordLen = 8
+
+var validUsername = regexp.MustCompile(`^[A-Za-z0-9._@-]{1,64}$`)
+
+func runUser(db *database.Db, clock system.Clock, args []string, stdin io.Reader, stderr io.Writer) error {
+	if len(args) == 0 {
+		return errors.ErrBadCommand
+	}
+	role := auth.RoleViewer
+	if args[0] == "add" {
+		flags := flag.NewFlagSet("user add", flag.ContinueOnError)
+		flags.SetOutput(stderr)
+		flags.StringVar(&role, "role", role, "viewer, editor or admin")
+		if err := flags.Parse(args[1:]); err != nil {
+			return errors.ErrBadCommand
+		}
+		rest := flags.Args()
+		if len(rest) > 0 { // flag stops at the username, the flags may follow it too
+			if err := flags.Parse(rest[1:]); err != nil {
+				return errors.ErrBadCommand
+			}
+			rest = append(rest[:1:1], flags.Args()...)
+		}
+		args = append(args[:1], rest...)
+	} else if args[0] == "role" {
+		if len(args) != 3 {
+			return errors.ErrBadCommand
+		}
+		role, args = args[2], args[:2]
+	}
+	if len(args) != 2 {
+		return errors.ErrBadCommand
+	}
+	username := args[1]
+	if !validUsername.MatchString(username) {
+		fmt.Fprintf(stderr, "invalid username %q, use up to 64 letters, digits or . _ @ -\n", username)
+		return errors.ErrCommandFailed
+	}
+	if _, err := auth.ParseRole(role); err != nil {
+		fmt.Fprintln(stderr, err)
+		return errors.ErrCommandFailed
+	}
+
+	var err error
+	switch args[0] {
+	case "add":
+		err = addUser(db, clock, username, role, stdin, stderr)
+	case "passwd":
+		err = changePassword(db, username, stdin, stderr)
+	case "role":
+		err = db.SetUserRole(context.Background(), username, role)
+		if err == nil {
+			fmt.Fprintf(stderr, "%s is now %s, their sessions have ended\n", username, role)
+		}
+	case "disable":
+		err = db.SetUserDisabled(context.Background(), username, true)
+		if err == nil {
+			fmt.Fprintf(stderr, "disabled user %s\n", username)
+		}
+	default:
+		return errors.ErrBadCommand
+	}
+	return report(err, stderr, "no such user "+username, "user "+username+" already exists")
+}
+
+func addUser(db *database.Db, clock system.Clock, username string, role string, stdin io.Reader, out io.Writer) error {
+	hash, err := readNewPassword(stdin, out)
+	if err != nil {
+		return err
+	}
+	if _, err := db.InsertUser(context.Background(), username, hash, role, clock().UTC()); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "created %s %s\n", role, username)
+	return nil
+}
+
+func changePassword(db *database.Db, username string, stdin io.Reader, out io.Writer) error {
+	if _, err := db.GetUserByUsername(context.Background(), username); err != nil {
+		return err // before prompting, no point typing a password for a typo
+	}
+	hash, err := readNewPassword(stdin, out)
+	if err != nil {
+		return err
+	}
+	if err := db.SetUserPassword(context.Background(), username, hash); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "changed password for %s, their sessions have ended\n", username)
+	return nil
+}
+
+// Read and hash a password, a terminal user types it twice without echo, piped input is a single line
+func readNewPassword(stdin io.Reader, out io.Writer) (string, error) {
+	lines := bufio.NewReader(stdin)
+	password, err := readPassword(lines, stdin, out, "Password: ")
+	if err != nil {
+		return "", err
+	}
+	if len(password) < minPasswordLen {
+		fmt.Fprintf(out, "password must be at least %d characters\n", minPasswordLen)
+		return "", errors.ErrCommandFailed
+	}
+	if system.IsTerminal(stdin) {
+		confirm, err := readPassword(lines, stdin, out, "Confirm password: ")
+		if err != nil {
+			return "", err
+		}
+		if confirm != password {
+			fmt.Fprintln(out, "passwords don't match")
+			return "", errors.ErrCommandFailed
+		}
+	}
+	return auth.HashPassword(password)
+}
+
+func readPassword(lines *bufio.Reader, stdin io.Reader, out io.Writer, prompt string) (string, error) {
+	if system.IsTerminal(stdin) {
+		fmt.Fprint(out, prompt)
+		terminal := stdin.(*os.File)
+		if err := system.SetEcho(terminal, false); err == nil {
+			defer fmt.Fprintln(out) // the user's newline wasn't echoed either
+			defer system.SetEcho(terminal, true)
+		}
+	}
+	line, err := lines.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		fmt.Fprintln(out, "no password given on stdin")
+		return "", errors.ErrCommandFailed
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
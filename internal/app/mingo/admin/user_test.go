@@ -0,0 +1,67 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+	"github.com/craigjperry2/mingo/internal/app/mingo/database"
+	"github.com/craigjperry2/mingo/internal/app/mingo/errors"
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+func TestUserCommands(t *testing.T) {
+	ctx := context.Background()
+	clock := system.ClockForTesting("2022-04-30T23:59:59Z")
+	db := database.NewRealDatabase(":memory:")
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("migrate err want nil, got %v", err)
+	}
+
+	var tests = []struct {
+		command string
+		stdin   string
+		wantErr error
+		wantOut string
+	}{
+		{"user add alice", "first password\n", nil, "created viewer alice\n"},
+		{"user add --role admin carol", "first password\n", nil, "created admin carol\n"},
+		{"user add erin --role editor", "first password\n", nil, "created editor erin\n"},
+		{"user add --role root dave", "first password\n", errors.ErrCommandFailed, "unknown role \"root\", want viewer, editor or admin\n"},
+		{"user add alice", "first password\n", errors.ErrCommandFailed, "user alice already exists\n"},
+		{"user add bob", "short\n", errors.ErrCommandFailed, "password must be at least 8 characters\n"},
+		{"user add bob", "", errors.ErrCommandFailed, "no password given on stdin\n"},
+		{"user add bob smith", "", errors.ErrBadCommand, "unknown command \"user add bob smith\", see --help\n"},
+		{"user add b/b", "", errors.ErrCommandFailed, "invalid username \"b/b\", use up to 64 letters, digits or . _ @ -\n"},
+		{"user passwd alice", "second password", nil, "changed password for alice, their sessions have ended\n"},
+		{"user passwd bob", "second password\n", errors.ErrCommandFailed, "no such user bob\n"},
+		{"user role alice editor", "", nil, "alice is now editor, their sessions have ended\n"},
+		{"user role bob editor", "", errors.ErrCommandFailed, "no such user bob\n"},
+		{"user role alice", "", errors.ErrBadCommand, "unknown command \"user role alice\", see --help\n"},
+		{"user disable alice", "", nil, "disabled user alice\n"},
+		{"user remove alice", "", errors.ErrBadCommand, "unknown command \"user remove alice\", see --help\n"},
+		{"group add admins", "", errors.ErrBadCommand, "unknown command \"group add admins\", see --help\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			var out bytes.Buffer
+			err := run(db, clock, strings.Fields(tt.command), strings.NewReader(tt.stdin), ioutil.Discard, &out)
+			if err != tt.wantErr {
+				t.Errorf("err got %v, want %v", err, tt.wantErr)
+			}
+			if out.String() != tt.wantOut {
+				t.Errorf("output got %q, want %q", out.String(), tt.wantOut)
+			}
+		})
+	}
+
+	alice, _ := db.GetUserByUsername(ctx, "alice")
+	if !auth.VerifyPassword(alice.PasswordHash, "second password") || !alice.Disabled || alice.Role != auth.RoleEditor {
+		t.Errorf("alice got %+v, want the second password, disabled and editor", alice)
+	}
+}
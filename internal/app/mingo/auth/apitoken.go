@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// API tokens look like mgo_<id>_<secret>, the prefix makes leaked tokens easy to spot in logs & repos
+// The id is public and safe to log, only a hash of the secret is stored
+const ApiTokenPrefix = "mgo_"
+
+// What an API token may do, each scope includes the ones before it
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+var scopeRank = map[string]int{ScopeRead: 1, ScopeWrite: 2, ScopeAdmin: 3}
+
+// NewApiToken returns the token to hand to the user once, its public id and the hash to store
+func NewApiToken() (token string, id string, secretHash string, err error) {
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", "", "", err
+	}
+	secret, secretHash, err := NewSessionToken()
+	if err != nil {
+		return "", "", "", err
+	}
+	id = hex.EncodeToString(idBytes)
+	return ApiTokenPrefix + id + "_" + secret, id, secretHash, nil
+}
+
+// ParseApiToken splits a token into its id and secret, ok is false if it isn't shaped like one
+func ParseApiToken(token string) (id string, secret string, ok bool) {
+	if !strings.HasPrefix(token, ApiTokenPrefix) {
+		return "", "", false
+	}
+	id, secret, ok = strings.Cut(strings.TrimPrefix(token, ApiTokenPrefix), "_") // the id is hex, the secret may contain _
+	if !ok || len(id) != 16 || secret == "" {
+		return "", "", false
+	}
+	if _, err := hex.DecodeString(id); err != nil {
+		return "", "", false
+	}
+	return id, secret, true
+}
+
+// ParseScopes validates a comma separated list of scopes, e.g. "read,write"
+func ParseScopes(list string) ([]string, error) {
+	var scopes []string
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if _, ok := scopeRank[s]; !ok {
+			return nil, fmt.Errorf("unknown scope %q, want read, write or admin", s)
+		}
+		if !contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes, nil
+}
+
+// ScopeForMethod is the scope a token needs to make a request with this HTTP method
+func ScopeForMethod(method string) string {
+	switch method {
+	case "GET", "HEAD", "OPTIONS":
+		return ScopeRead
+	default:
+		return ScopeWrite
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
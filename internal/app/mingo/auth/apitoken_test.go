@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApiTokenRoundTrip(t *testing.T) {
+	token, id, secretHash, err := NewApiToken()
+	if err != nil {
+		t.Fatalf("new err want nil, got %v", err)
+	}
+	gotId, secret, ok := ParseApiToken(token)
+	if !ok || gotId != id || HashToken(secret) != secretHash {
+		t.Errorf("parse %q got %q %q %v, want id %q and the hashed secret", token, gotId, secret, ok, id)
+	}
+
+	var malformed = []string{"", "mgo_", "mgo_abc_secret", "ghp_0123456789abcdef_secret", "mgo_0123456789abcdeg_secret", "mgo_0123456789abcdef_", strings.TrimPrefix(token, "mgo_")}
+	for _, m := range malformed {
+		if _, _, ok := ParseApiToken(m); ok {
+			t.Errorf("parse %q got ok, want malformed", m)
+		}
+	}
+}
+
+func TestScopes(t *testing.T) {
+	scopes, err := ParseScopes(" read , write,read")
+	if err != nil || !reflect.DeepEqual(scopes, []string{"read", "write"}) {
+		t.Errorf("parse got %q %v, want [read write]", scopes, err)
+	}
+	if _, err := ParseScopes("read,root"); err == nil {
+		t.Error("parse unknown scope want err, got nil")
+	}
+	if _, err := ParseScopes(""); err == nil {
+		t.Error("parse empty want err, got nil")
+	}
+
+	var tests = []struct {
+		scopes []string
+		scope  string
+		want   bool
+	}{
+		{nil, ScopeAdmin, true},
+		{[]string{ScopeRead}, ScopeRead, true},
+		{[]string{ScopeRead}, ScopeWrite, false},
+		{[]string{ScopeWrite}, ScopeRead, true},
+		{[]string{ScopeWrite}, ScopeAdmin, false},
+		{[]string{ScopeAdmin}, ScopeWrite, true},
+	}
+	for _, tt := range tests {
+		if got := (Principal{Scopes: tt.scopes}).Allows(tt.scope); got != tt.want {
+			t.Errorf("%q allows %s got %v, want %v", tt.scopes, tt.scope, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+// Package auth holds the building blocks of authentication: password hashing, session tokens
+// and the principal (who is making this request) carried on a request's context
+package auth
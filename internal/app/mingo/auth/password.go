@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/craigjperry2/mingo/internal/pkg/stdlibext"
+)
+
+// Self describing like bcrypt's $2b$ strings so the cost can be raised later without breaking stored hashes:
+//
+//	pbkdf2-sha256$<iterations>$<base64 salt>$<base64 key>
+const (
+	passwordScheme     = "pbkdf2-sha256"
+	passwordIterations = 600_000 // OWASP's 2023 recommendation for PBKDF2-HMAC-SHA256
+	passwordSaltLen    = 16
+	passwordKeyLen     = 32
+
+	maxPasswordIterations = 10 * passwordIterations // room to raise the cost, a damaged row can't make logins hang
+)
+
+// Verified against when the user doesn't exist so that response timing doesn't reveal valid usernames
+var dummyPasswordHash string
+var dummyOnce sync.Once
+
+// HashPassword returns a salted, deliberately slow hash of password, suitable for storage
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return hashPassword(password, salt, passwordIterations), nil
+}
+
+func hashPassword(password string, salt []byte, iterations int) string {
+	key := stdlibext.Pbkdf2([]byte(password), salt, iterations, passwordKeyLen, sha256.New)
+	return fmt.Sprintf("%s$%d$%s$%s", passwordScheme, iterations, base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+// VerifyPassword checks password against a hash from HashPassword()
+// An empty encoded hash (e.g. unknown user) still costs the same time but never matches
+func VerifyPassword(encoded string, password string) bool {
+	if encoded == "" {
+		dummyOnce.Do(func() {
+			dummyPasswordHash = hashPassword("not a real password", make([]byte, passwordSaltLen), passwordIterations)
+		})
+		verifyPassword(dummyPasswordHash, password)
+		return false
+	}
+	return verifyPassword(encoded, password)
+}
+
+func verifyPassword(encoded string, password string) bool {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != passwordScheme {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 || iterations > maxPasswordIterations {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(want) != passwordKeyLen { // a truncated key would match too many passwords
+		return false
+	}
+	got := stdlibext.Pbkdf2([]byte(password), salt, iterations, passwordKeyLen, sha256.New)
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
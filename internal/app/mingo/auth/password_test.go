@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPasswordHashRoundTrip(t *testing.T) {
+	encoded, err := HashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("hash err want nil, got %v", err)
+	}
+	if !strings.HasPrefix(encoded, "pbkdf2-sha256$600000$") {
+		t.Errorf("encoded got %q, want pbkdf2-sha256$600000$ prefix", encoded)
+	}
+	if !VerifyPassword(encoded, "correct horse battery staple") {
+		t.Error("verify correct password got false, want true")
+	}
+	if VerifyPassword(encoded, "Correct horse battery staple") {
+		t.Error("verify wrong password got true, want false")
+	}
+
+	again, _ := HashPassword("correct horse battery staple")
+	if again == encoded {
+		t.Error("hashes of the same password are identical, want unique salts")
+	}
+}
+
+func TestVerifyPasswordRejectsMalformed(t *testing.T) {
+	cheap := hashPassword("pw", []byte("0123456789abcdef"), 1)
+	if !VerifyPassword(cheap, "pw") {
+		t.Fatal("verify cheap hash got false, want true")
+	}
+
+	var tests = []string{
+		"",
+		"pw",
+		"bcrypt$1$MDEyMzQ1Njc4OWFiY2RlZg$AAAA",
+		"pbkdf2-sha256$0$MDEyMzQ1Njc4OWFiY2RlZg$AAAA",
+		"pbkdf2-sha256$x$MDEyMzQ1Njc4OWFiY2RlZg$AAAA",
+		"pbkdf2-sha256$1$!!!$AAAA",
+		strings.TrimSuffix(cheap, cheap[len(cheap)-4:]) + "AAAA",
+		cheap[:strings.LastIndex(cheap, "$")+1], // no key
+		cheap[:len(cheap)-8],                    // truncated key
+		"pbkdf2-sha256$2000000000$MDEyMzQ1Njc4OWFiY2RlZg$" + cheap[strings.LastIndex(cheap, "$")+1:],
+	}
+	for _, encoded := range tests {
+		t.Run(encoded, func(t *testing.T) {
+			if VerifyPassword(encoded, "pw") {
+				t.Errorf("verify %q got true, want false", encoded)
+			}
+		})
+	}
+}
+
+func TestSessionToken(t *testing.T) {
+	token, idHash, err := NewSessionToken()
+	if err != nil {
+		t.Fatalf("token err want nil, got %v", err)
+	}
+	if len(token) != 43 {
+		t.Errorf("token length got %d, want 43", len(token))
+	}
+	if idHash != HashToken(token) || idHash == token {
+		t.Errorf("id hash got %q, want sha256 of token", idHash)
+	}
+	other, _, _ := NewSessionToken()
+	if other == token {
+		t.Error("tokens repeat, want random")
+	}
+}
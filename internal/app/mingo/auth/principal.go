@@ -0,0 +1,45 @@
+package auth
+
+import "context"
+
+// How the principal proved who they are
+const (
+	ViaSession     = "session"
+	ViaCertificate = "certificate"
+	ViaToken       = "token"
+)
+
+// Principal is the authenticated party behind a request
+type Principal struct {
+	UserId   int    // 0 when not backed by a user account, e.g. a client certificate
+	Username string // or the certificate subject
+	Via      string
+	Role     string   // see RoleViewer etc., nothing is permitted without one
+	TokenId  string   // the API token's public id when Via is ViaToken
+	Scopes   []string // what an API token may do, nil means unrestricted e.g. a login session
+}
+
+// Allows reports whether the principal may act with scope, see ScopeRead etc.
+func (p Principal) Allows(scope string) bool {
+	if p.Scopes == nil {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if scopeRank[s] >= scopeRank[scope] {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// GetPrincipal returns the authenticated principal, ok is false for anonymous requests
+func GetPrincipal(ctx context.Context) (p Principal, ok bool) {
+	p, ok = ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
@@ -0,0 +1,95 @@
+package auth
+
+import "fmt"
+
+// Roles, each can do everything the one before it can
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+// Permission is an action that's checked before it's carried out
+type Permission int
+
+const (
+	PersonRead Permission = iota
+	PersonWrite
+	PersonDelete
+	UserManage
+	MetricsRead
+	LogsManage
+	LogsRead
+	TokensManage
+)
+
+// The least role holding each permission
+var permissionRole = map[Permission]string{
+	PersonRead:   RoleViewer,
+	PersonWrite:  RoleEditor,
+	PersonDelete: RoleAdmin,
+	UserManage:   RoleAdmin,
+	MetricsRead:  RoleAdmin,
+	LogsManage:   RoleAdmin,
+	LogsRead:     RoleAdmin,
+	TokensManage: RoleViewer, // their own
+}
+
+// The scope an API token needs on top of its user's role
+var permissionScope = map[Permission]string{
+	PersonRead:   ScopeRead,
+	PersonWrite:  ScopeWrite,
+	PersonDelete: ScopeWrite,
+	UserManage:   ScopeAdmin,
+	MetricsRead:  ScopeRead,
+	LogsManage:   ScopeAdmin,
+	LogsRead:     ScopeRead,
+	TokensManage: ScopeAdmin, // a token can't be used to mint more
+}
+
+var roleRank = map[string]int{RoleViewer: 1, RoleEditor: 2, RoleAdmin: 3}
+
+// ParseRole validates a role name
+func ParseRole(role string) (string, error) {
+	if _, ok := roleRank[role]; !ok {
+		return "", fmt.Errorf("unknown role %q, want viewer, editor or admin", role)
+	}
+	return role, nil
+}
+
+// RoleRank orders roles by power, viewer lowest, 0 for an unknown role
+func RoleRank(role string) int {
+	return roleRank[role]
+}
+
+// Can is the single authorisation decision: the principal's role must hold the permission and,
+// for an API token, its scopes must cover it too
+func Can(p Principal, perm Permission) bool {
+	needed, ok := permissionRole[perm]
+	if !ok || roleRank[p.Role] < roleRank[needed] {
+		return false
+	}
+	return p.Allows(permissionScope[perm])
+}
+
+func (perm Permission) String() string {
+	switch perm {
+	case PersonRead:
+		return "view people"
+	case PersonWrite:
+		return "add or edit people"
+	case PersonDelete:
+		return "delete people"
+	case UserManage:
+		return "manage users"
+	case MetricsRead:
+		return "view server metrics"
+	case LogsManage:
+		return "manage logging"
+	case LogsRead:
+		return "view the server's logs"
+	case TokensManage:
+		return "manage API tokens"
+	}
+	return "do that"
+}
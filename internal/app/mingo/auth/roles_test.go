@@ -0,0 +1,48 @@
+package auth
+
+import "testing"
+
+func TestCan(t *testing.T) {
+	viewer := Principal{Role: RoleViewer}
+	editor := Principal{Role: RoleEditor}
+	admin := Principal{Role: RoleAdmin}
+	readOnlyAdminToken := Principal{Role: RoleAdmin, Via: ViaToken, Scopes: []string{ScopeRead}}
+	writeAdminToken := Principal{Role: RoleAdmin, Via: ViaToken, Scopes: []string{ScopeWrite}}
+	adminViewerToken := Principal{Role: RoleViewer, Via: ViaToken, Scopes: []string{ScopeAdmin}}
+
+	var tests = []struct {
+		desc      string
+		principal Principal
+		perm      Permission
+		want      bool
+	}{
+		{"anonymous read", Principal{}, PersonRead, false},
+		{"viewer read", viewer, PersonRead, true},
+		{"viewer write", viewer, PersonWrite, false},
+		{"editor write", editor, PersonWrite, true},
+		{"editor delete", editor, PersonDelete, false},
+		{"admin delete", admin, PersonDelete, true},
+		{"admin manage users", admin, UserManage, true},
+		{"editor manage users", editor, UserManage, false},
+		{"read token of admin read", readOnlyAdminToken, PersonRead, true},
+		{"read token of admin delete", readOnlyAdminToken, PersonDelete, false},
+		{"write token of admin delete", writeAdminToken, PersonDelete, true},
+		{"write token of admin manage users", writeAdminToken, UserManage, false},
+		{"admin token of viewer write", adminViewerToken, PersonWrite, false},
+		{"read token of admin metrics", readOnlyAdminToken, MetricsRead, true},
+		{"editor metrics", editor, MetricsRead, false},
+		{"admin manage logging", admin, LogsManage, true},
+		{"read token of admin manage logging", readOnlyAdminToken, LogsManage, false},
+		{"read token of admin logs", readOnlyAdminToken, LogsRead, true},
+		{"editor logs", editor, LogsRead, false},
+		{"viewer tokens", viewer, TokensManage, true},
+		{"write token of admin tokens", writeAdminToken, TokensManage, false},
+		{"admin token of viewer tokens", adminViewerToken, TokensManage, true},
+		{"unknown role", Principal{Role: "root"}, PersonRead, false},
+	}
+	for _, tt := range tests {
+		if got := Can(tt.principal, tt.perm); got != tt.want {
+			t.Errorf("%s got %v, want %v", tt.desc, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// Name of the cookie carrying the session token
+const SessionCookieName = "mingo_session"
+
+// NewSessionToken returns a random bearer secret for the client's cookie and the hash to store server side
+// Only storing the hash means a leaked database (or backup) can't be replayed as live sessions
+func NewSessionToken() (token string, idHash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken is a fast hash, fine for 256 bit random tokens unlike for human chosen passwords
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
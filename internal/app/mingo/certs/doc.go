@@ -0,0 +1,2 @@
+// Package certs generates, persists and (re)loads the X.509 certificates used to serve HTTPS
+package certs
@@ -0,0 +1,97 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"sync"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+// A TLS certificate that can be swapped while the server is running, e.g. on SIGHUP after renewal
+type Keypair struct {
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	certFile string
+	keyFile  string
+	prepare  func() error
+}
+
+// NewKeypair loads the PEM certificate and key files, they're re-read on each Reload()
+func NewKeypair(certFile string, keyFile string) (*Keypair, error) {
+	return newKeypair(certFile, keyFile, nil)
+}
+
+// NewSelfSignedKeypair maintains a self-signed certificate in dir, see EnsureSelfSigned()
+// Reload() also re-issues the leaf certificate when it's close to expiry
+func NewSelfSignedKeypair(dir string, hostname string, clock system.Clock) (*Keypair, error) {
+	certFile, keyFile, err := EnsureSelfSigned(dir, hostname, clock)
+	if err != nil {
+		return nil, err
+	}
+	return newKeypair(certFile, keyFile, func() error {
+		_, _, err := EnsureSelfSigned(dir, hostname, clock)
+		return err
+	})
+}
+
+func newKeypair(certFile string, keyFile string, prepare func() error) (*Keypair, error) {
+	kp := &Keypair{certFile: certFile, keyFile: keyFile, prepare: prepare}
+	if err := kp.load(); err != nil {
+		return nil, err
+	}
+	return kp, nil
+}
+
+// Reload re-reads the certificate files, on failure the previous certificate stays in service
+func (kp *Keypair) Reload() error {
+	if kp.prepare != nil {
+		if err := kp.prepare(); err != nil {
+			return err
+		}
+	}
+	return kp.load()
+}
+
+func (kp *Keypair) load() error {
+	cert, err := tls.LoadX509KeyPair(kp.certFile, kp.keyFile)
+	if err != nil {
+		return err
+	}
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	kp.cert = &cert
+	return nil
+}
+
+// GetCertificate satisfies tls.Config.GetCertificate
+func (kp *Keypair) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	kp.mu.RLock()
+	defer kp.mu.RUnlock()
+	return kp.cert, nil
+}
+
+// ServerTlsConfig returns modern defaults: TLS 1.2+, forward secret AEAD ciphers only
+// When clientCAs is given, clients may present a certificate signed by one of them. It's
+// optional at the handshake so that routes can decide whether to require one
+func ServerTlsConfig(kp *Keypair, clientCAs *x509.CertPool) *tls.Config {
+	clientAuth := tls.NoClientCert
+	if clientCAs != nil {
+		clientAuth = tls.VerifyClientCertIfGiven
+	}
+	return &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		CipherSuites: []uint16{ // TLS 1.3 suites aren't configurable, these only apply to TLS 1.2
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+		GetCertificate: kp.GetCertificate,
+		ClientAuth:     clientAuth,
+		ClientCAs:      clientCAs,
+	}
+}
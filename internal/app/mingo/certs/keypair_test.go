@@ -0,0 +1,167 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+func TestKeypairReload(t *testing.T) {
+	dir := t.TempDir()
+	clock := system.ClockForTesting("2022-04-30T23:59:59Z")
+	ca, _ := NewAuthority("test CA", clock)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	first, _ := ca.IssueServer("testhost", clock)
+	first.Save(certFile, keyFile)
+	kp, err := NewKeypair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("new err want nil, got %v", err)
+	}
+
+	second, _ := ca.IssueServer("testhost", clock)
+	second.Save(certFile, keyFile)
+	if got := serial(t, kp); got != first.Cert.SerialNumber.String() {
+		t.Errorf("before reload got serial %s, want %s", got, first.Cert.SerialNumber)
+	}
+	if err := kp.Reload(); err != nil {
+		t.Fatalf("reload err want nil, got %v", err)
+	}
+	if got := serial(t, kp); got != second.Cert.SerialNumber.String() {
+		t.Errorf("after reload got serial %s, want %s", got, second.Cert.SerialNumber)
+	}
+
+	// A broken renewal keeps the working certificate in service
+	os.WriteFile(certFile, []byte("garbage"), 0644)
+	if err := kp.Reload(); err == nil {
+		t.Error("reload of garbage want err, got nil")
+	}
+	if got := serial(t, kp); got != second.Cert.SerialNumber.String() {
+		t.Errorf("after failed reload got serial %s, want %s", got, second.Cert.SerialNumber)
+	}
+}
+
+func TestServerTlsConfigDefaults(t *testing.T) {
+	dir := t.TempDir()
+	kp, err := NewSelfSignedKeypair(dir, "testhost", system.ClockForTesting("2022-04-30T23:59:59Z"))
+	if err != nil {
+		t.Fatalf("new err want nil, got %v", err)
+	}
+
+	conf := ServerTlsConfig(kp, nil)
+	if conf.MinVersion != tls.VersionTLS12 {
+		t.Errorf("min version got %x, want %x", conf.MinVersion, tls.VersionTLS12)
+	}
+	for _, id := range conf.CipherSuites {
+		for _, insecure := range tls.InsecureCipherSuites() {
+			if id == insecure.ID {
+				t.Errorf("insecure cipher suite %s enabled", insecure.Name)
+			}
+		}
+	}
+}
+
+func serial(t *testing.T, kp *Keypair) string {
+	cert, _ := kp.GetCertificate(nil)
+	leaf, err := tlsLeaf(cert)
+	if err != nil {
+		t.Fatalf("parse err want nil, got %v", err)
+	}
+	return leaf.SerialNumber.String()
+}
+
+func tlsLeaf(cert *tls.Certificate) (*x509.Certificate, error) {
+	return x509.ParseCertificate(cert.Certificate[0])
+}
+
+func TestMutualTlsHandshake(t *testing.T) {
+	clock := system.NewClock() // the handshake verifies against the live time
+	dir := t.TempDir()
+	serverCa, _ := NewAuthority("server CA", clock)
+	serverCa.Save(filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem"))
+	leaf, _ := serverCa.IssueServer("testhost", clock)
+	leaf.Save(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	kp, _ := NewKeypair(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+
+	clientCa, _ := NewAuthority("client CA", clock)
+	os.WriteFile(filepath.Join(dir, "clients.pem"), clientCa.CertPem(), 0644)
+	clientCAs, err := LoadCertPool(filepath.Join(dir, "clients.pem"))
+	if err != nil {
+		t.Fatalf("pool err want nil, got %v", err)
+	}
+	client, _ := clientCa.IssueClient("svc-a", clock)
+	rogueCa, _ := NewAuthority("rogue CA", clock)
+	rogue, _ := rogueCa.IssueClient("svc-a", clock)
+
+	serverRoots := x509.NewCertPool()
+	serverRoots.AddCert(serverCa.Cert)
+
+	var tests = []struct {
+		desc        string
+		clientCerts []tls.Certificate
+		wantErr     bool
+		wantSubject string
+	}{
+		{"trusted client", []tls.Certificate{client.TlsCertificate()}, false, "CN=svc-a,O=mingo"},
+		{"no client cert", nil, false, ""},
+		{"untrusted client", []tls.Certificate{rogue.TlsCertificate()}, true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			serverConn, clientConn := socketPair(t)
+			defer serverConn.Close()
+			defer clientConn.Close()
+
+			srv := tls.Server(serverConn, ServerTlsConfig(kp, clientCAs))
+			cli := tls.Client(clientConn, &tls.Config{ServerName: "testhost", RootCAs: serverRoots,
+				// always present the cert, otherwise Go skips one not issued by a CA the server advertised
+				GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+					if len(tt.clientCerts) == 0 {
+						return &tls.Certificate{}, nil
+					}
+					return &tt.clientCerts[0], nil
+				},
+			})
+
+			go cli.Handshake()
+			err := srv.Handshake()
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("server handshake err got %v, want err %v", err, tt.wantErr)
+			}
+			var subject string
+			if chains := srv.ConnectionState().VerifiedChains; len(chains) > 0 {
+				subject = chains[0][0].Subject.String()
+			}
+			if !tt.wantErr && subject != tt.wantSubject {
+				t.Errorf("subject got %q, want %q", subject, tt.wantSubject)
+			}
+		})
+	}
+}
+
+// A connected pair of loopback sockets, unlike net.Pipe() writes are buffered so a rejected
+// handshake can send its alert without the peer reading it
+func socketPair(t *testing.T) (net.Conn, net.Conn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err want nil, got %v", err)
+	}
+	defer ln.Close()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial err want nil, got %v", err)
+	}
+	server, err := ln.Accept()
+	if err != nil {
+		client.Close()
+		t.Fatalf("accept err want nil, got %v", err)
+	}
+	return server, client
+}
@@ -0,0 +1,240 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+// File names inside the self-signed certificate directory
+const (
+	CaCertFile   = "ca.pem"
+	CaKeyFile    = "ca-key.pem"
+	LeafCertFile = "cert.pem"
+	LeafKeyFile  = "key.pem"
+)
+
+const (
+	caValidity   = 10 * 365 * 24 * time.Hour
+	leafValidity = 397 * 24 * time.Hour // longest lifetime browsers accept for a leaf certificate
+	renewBefore  = 30 * 24 * time.Hour
+)
+
+// A certificate together with its private key
+type Authority struct {
+	Cert *x509.Certificate
+	Key  *ecdsa.PrivateKey
+}
+
+// EnsureSelfSigned makes sure dir holds a local CA and a leaf certificate for hostname signed by it
+// The CA is generated once and reused so it only has to be trusted once, the leaf is re-issued when
+// it's missing, doesn't cover hostname or expires within 30 days
+// It returns the paths of the leaf certificate and key
+func EnsureSelfSigned(dir string, hostname string, clock system.Clock) (string, string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", "", err
+	}
+
+	ca, err := LoadAuthority(filepath.Join(dir, CaCertFile), filepath.Join(dir, CaKeyFile))
+	if os.IsNotExist(err) {
+		ca, err = NewAuthority("mingo local CA on "+hostname, clock)
+		if err == nil {
+			err = ca.Save(filepath.Join(dir, CaCertFile), filepath.Join(dir, CaKeyFile))
+		}
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	certFile, keyFile := filepath.Join(dir, LeafCertFile), filepath.Join(dir, LeafKeyFile)
+	if leaf, err := LoadAuthority(certFile, keyFile); err == nil && !needsRenewal(leaf.Cert, hostname, clock) {
+		return certFile, keyFile, nil
+	}
+
+	leaf, err := ca.IssueServer(hostname, clock)
+	if err != nil {
+		return "", "", err
+	}
+	return certFile, keyFile, leaf.Save(certFile, keyFile)
+}
+
+func needsRenewal(cert *x509.Certificate, hostname string, clock system.Clock) bool {
+	if clock().Add(renewBefore).After(cert.NotAfter) {
+		return true
+	}
+	return cert.VerifyHostname(hostname) != nil
+}
+
+// NewAuthority generates a self-signed CA certificate
+func NewAuthority(commonName string, clock system.Clock) (*Authority, error) {
+	template, err := newTemplate(commonName, clock, caValidity)
+	if err != nil {
+		return nil, err
+	}
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.MaxPathLenZero = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+	return sign(template, nil)
+}
+
+// IssueServer signs a TLS server certificate for hostname, localhost and the loopback addresses
+func (ca *Authority) IssueServer(hostname string, clock system.Clock) (*Authority, error) {
+	template, err := newTemplate(hostname, clock, leafValidity)
+	if err != nil {
+		return nil, err
+	}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	template.DNSNames = []string{hostname}
+	if hostname != "localhost" {
+		template.DNSNames = append(template.DNSNames, "localhost")
+	}
+	template.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	return sign(template, ca)
+}
+
+func newTemplate(commonName string, clock system.Clock, validity time.Duration) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := clock().UTC()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"mingo"}},
+		NotBefore:    now.Add(-time.Hour), // tolerate a little clock skew between hosts
+		NotAfter:     now.Add(validity),
+	}, nil
+}
+
+// Sign template with the issuer, or self-sign when issuer is nil
+func sign(template *x509.Certificate, issuer *Authority) (*Authority, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	parent, signer := template, key
+	if issuer != nil {
+		parent, signer = issuer.Cert, issuer.Key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &Authority{cert, key}, nil
+}
+
+// LoadAuthority reads a PEM certificate and its PEM EC private key
+func LoadAuthority(certFile string, keyFile string) (*Authority, error) {
+	certPem, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	keyPem, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	certBlock, _ := pem.Decode(certPem)
+	if certBlock == nil || certBlock.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("%s: no PEM certificate found", certFile)
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	keyBlock, _ := pem.Decode(keyPem)
+	if keyBlock == nil || keyBlock.Type != "EC PRIVATE KEY" {
+		return nil, fmt.Errorf("%s: no PEM EC private key found", keyFile)
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return &Authority{cert, key}, nil
+}
+
+// Save writes the certificate and key as PEM, the key is only readable by the current user
+func (a *Authority) Save(certFile string, keyFile string) error {
+	keyDer, err := x509.MarshalECPrivateKey(a.Key)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		return err
+	}
+	return writeFileAtomic(certFile, a.CertPem(), 0644)
+}
+
+// CertPem returns the PEM encoded certificate
+func (a *Authority) CertPem() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: a.Cert.Raw})
+}
+
+// Write via a rename so a concurrent reload never sees a half written file
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// IssueClient signs a TLS client certificate, e.g. for a service calling the API or for tests
+func (ca *Authority) IssueClient(commonName string, clock system.Clock) (*Authority, error) {
+	template, err := newTemplate(commonName, clock, leafValidity)
+	if err != nil {
+		return nil, err
+	}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	return sign(template, ca)
+}
+
+// TlsCertificate pairs the certificate with its key for use in a tls.Config
+func (a *Authority) TlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{a.Cert.Raw}, PrivateKey: a.Key, Leaf: a.Cert}
+}
+
+// LoadCertPool reads a bundle of PEM CA certificates, e.g. for verifying client certificates
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	bundle, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("%s: no PEM certificates found", file)
+	}
+	return pool, nil
+}
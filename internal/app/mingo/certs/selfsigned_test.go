@@ -0,0 +1,74 @@
+package certs
+
+import (
+	"crypto/x509"
+	"path/filepath"
+	"testing"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+func TestEnsureSelfSignedIssuesLeafTrustedByCa(t *testing.T) {
+	dir := t.TempDir()
+	clock := system.ClockForTesting("2022-04-30T23:59:59Z")
+
+	certFile, keyFile, err := EnsureSelfSigned(dir, "testhost", clock)
+	if err != nil {
+		t.Fatalf("ensure err want nil, got %v", err)
+	}
+
+	ca, err := LoadAuthority(filepath.Join(dir, CaCertFile), filepath.Join(dir, CaKeyFile))
+	if err != nil {
+		t.Fatalf("load ca err want nil, got %v", err)
+	}
+	leaf, err := LoadAuthority(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("load leaf err want nil, got %v", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+	for _, name := range []string{"testhost", "localhost", "127.0.0.1", "::1"} {
+		opts := x509.VerifyOptions{DNSName: name, Roots: roots, CurrentTime: clock(), KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}
+		if _, err := leaf.Cert.Verify(opts); err != nil {
+			t.Errorf("verify %s want nil, got %v", name, err)
+		}
+	}
+	if !ca.Cert.IsCA || leaf.Cert.IsCA {
+		t.Errorf("IsCA want ca=true leaf=false, got ca=%v leaf=%v", ca.Cert.IsCA, leaf.Cert.IsCA)
+	}
+}
+
+func TestEnsureSelfSignedReusesThenRenews(t *testing.T) {
+	dir := t.TempDir()
+	day0 := system.ClockForTesting("2022-04-30T23:59:59Z")
+
+	certFile, keyFile, _ := EnsureSelfSigned(dir, "testhost", day0)
+	first, _ := LoadAuthority(certFile, keyFile)
+	firstCa, _ := LoadAuthority(filepath.Join(dir, CaCertFile), filepath.Join(dir, CaKeyFile))
+
+	// A second start shouldn't churn the certificate
+	EnsureSelfSigned(dir, "testhost", system.ClockForTesting("2022-05-01T23:59:59Z"))
+	second, _ := LoadAuthority(certFile, keyFile)
+	if first.Cert.SerialNumber.Cmp(second.Cert.SerialNumber) != 0 {
+		t.Error("leaf was re-issued, want reused")
+	}
+
+	// Within 30 days of expiry the leaf is renewed, the CA isn't
+	EnsureSelfSigned(dir, "testhost", system.ClockForTesting("2023-05-10T00:00:00Z"))
+	renewed, _ := LoadAuthority(certFile, keyFile)
+	renewedCa, _ := LoadAuthority(filepath.Join(dir, CaCertFile), filepath.Join(dir, CaKeyFile))
+	if first.Cert.SerialNumber.Cmp(renewed.Cert.SerialNumber) == 0 {
+		t.Error("leaf was reused, want renewed")
+	}
+	if firstCa.Cert.SerialNumber.Cmp(renewedCa.Cert.SerialNumber) != 0 {
+		t.Error("CA was re-issued, want reused")
+	}
+
+	// A hostname change also needs a new leaf
+	EnsureSelfSigned(dir, "otherhost", system.ClockForTesting("2023-05-10T00:00:00Z"))
+	moved, _ := LoadAuthority(certFile, keyFile)
+	if err := moved.Cert.VerifyHostname("otherhost"); err != nil {
+		t.Errorf("verify otherhost want nil, got %v", err)
+	}
+}
@@ -4,7 +4,19 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+	"github.com/craigjperry2/mingo/internal/app/mingo/cors"
+	"github.com/craigjperry2/mingo/internal/app/mingo/logger"
+	"github.com/craigjperry2/mingo/internal/app/mingo/oidc"
 )
 
 func parseFlags(config *Config) (*Config, error) {
@@ -18,24 +30,329 @@ func parseFlags(config *Config) (*Config, error) {
 	flags.StringVar(&config.staticDir, "d", "", "override files embedded in binary and serve /static/* urls from disk")
 	flags.StringVar(&config.staticDir, "dir", "", "override files embedded in binary and serve /static/* urls from disk")
 
+	flags.Var(&listVar{&config.staticIndexFiles}, "index", "comma separated files to serve for a directory request under /static/")
+	flags.BoolVar(&config.staticDirListing, "dir-listing", config.staticDirListing, "list the contents of directories under /static/ that have no index file")
+	flags.StringVar(&config.staticSpaFallback, "spa-fallback", config.staticSpaFallback, "file to serve for unknown extensionless paths under /static/")
+
 	port := &portVar{&config.listenPort}
 	flags.Var(port, "port", "port to listen on for webserver")
 	flags.Var(port, "p", "port to listen on for webserver")
 
-	err := flags.Parse(config.args)
-	return config, err
+	flags.StringVar(&config.tlsCertFile, "tls-cert", config.tlsCertFile, "PEM certificate (chain) file to serve HTTPS with")
+	flags.StringVar(&config.tlsKeyFile, "tls-key", config.tlsKeyFile, "PEM private key file for --tls-cert")
+	flags.BoolVar(&config.tlsSelfSigned, "tls-self-signed", config.tlsSelfSigned, "serve HTTPS with a generated local CA and certificate")
+	flags.StringVar(&config.tlsDir, "tls-dir", config.tlsDir, "where --tls-self-signed keeps its CA and certificate")
+	flags.StringVar(&config.tlsClientCaFile, "tls-client-ca", config.tlsClientCaFile, "PEM CA bundle to verify client certificates against")
+	flags.Var(&listVar{&config.clientCertPaths}, "client-cert-paths", "comma separated URL path prefixes that require a client certificate")
+	flags.StringVar(&config.clientCertRole, "client-cert-role", config.clientCertRole, "role granted to callers with a client certificate")
+	flags.Var(&portVar{&config.redirectPort}, "redirect-port", "port to listen on for plain HTTP and redirect to HTTPS")
+
+	flags.StringVar(&config.dbPath, "db", config.dbPath, "sqlite database file")
+	flags.DurationVar(&config.sessionTtl, "session-ttl", config.sessionTtl, "how long a login lasts")
+
+	flags.DurationVar(&config.shutdownDelay, "shutdown-delay", config.shutdownDelay, "how long to keep serving once told to stop while /ready reports 503")
+	flags.DurationVar(&config.drainTimeout, "drain-timeout", config.drainTimeout, "how long in-flight requests get to finish when stopping")
+
+	flags.StringVar(&config.oidcIssuer, "oidc-issuer", config.oidcIssuer, "OpenID Connect provider to offer single sign-on with")
+	flags.StringVar(&config.oidcClientId, "oidc-client-id", config.oidcClientId, "client id registered with the provider")
+	flags.StringVar(&config.oidcSecretFile, "oidc-client-secret-file", config.oidcSecretFile, "file holding the client secret")
+	flags.StringVar(&config.oidcRedirectUrl, "oidc-redirect-url", config.oidcRedirectUrl, "callback URL registered with the provider")
+	flags.StringVar(&config.oidcUsernameClaim, "oidc-username-claim", config.oidcUsernameClaim, "ID token claim to use as username")
+	flags.StringVar(&config.oidcRoleClaim, "oidc-role-claim", config.oidcRoleClaim, "ID token claim whose values map to roles")
+	flags.Var(&listVar{&config.oidcRoles}, "oidc-roles", "comma separated <claim value>=<role> pairs")
+
+	flags.Float64Var(&config.rateLimit, "rate-limit", config.rateLimit, "requests per second allowed to each client, 0 for no limit")
+	flags.IntVar(&config.rateBurst, "rate-burst", config.rateBurst, "requests a client may make at once before --rate-limit applies")
+	flags.IntVar(&config.maxInFlight, "max-in-flight", config.maxInFlight, "concurrent requests beyond which to shed load, 0 for no limit")
+	flags.Var(&cidrListVar{&config.trustedProxies}, "trusted-proxies", "comma separated addresses or CIDRs of reverse proxies")
+
+	flags.StringVar(&config.csp, "csp", config.csp, "Content-Security-Policy, {nonce} is replaced per request")
+	flags.BoolVar(&config.cspReportOnly, "csp-report-only", config.cspReportOnly, "report CSP violations without blocking")
+	flags.DurationVar(&config.hstsMaxAge, "hsts-max-age", config.hstsMaxAge, "Strict-Transport-Security max-age over HTTPS")
+	flags.Var(&corsVar{&config.corsPolicies}, "cors", "URL path prefix other origins may call, repeatable")
+
+	flags.Var(&levelsVar{&config.logLevels}, "log-level", "comma separated [<component>=]<level> pairs")
+	flags.IntVar(&config.logBuffer, "log-buffer", config.logBuffer, "recent log lines to keep in memory for /admin/logs")
+	flags.StringVar(&config.logFile, "log-file", config.logFile, "file to write the log to instead of stderr")
+	flags.Var(&sizeVar{&config.logRotation.MaxSize}, "log-max-size", "size at which to rotate log files, 0 for no limit")
+	flags.BoolVar(&config.logRotation.Daily, "log-daily", config.logRotation.Daily, "rotate log files when the UTC day changes")
+	flags.IntVar(&config.logRotation.Keep, "log-keep", config.logRotation.Keep, "rotated log files to keep, 0 keeps them all")
+	flags.BoolVar(&config.logRotation.Compress, "log-compress", config.logRotation.Compress, "gzip rotated log files")
+	flags.Var(&sinkVar{&config.logSink}, "log-sink", "journald or syslog collector to send the log to instead of stderr")
+
+	flags.StringVar(&config.accessLog, "access-log", config.accessLog, "file to append access log lines to")
+	flags.Var(&accessFormatVar{&config.accessLogFormat}, "access-log-format", "access log format: mingo, combined or json")
+	flags.Var(&listVar{&config.accessLogExclude}, "access-log-exclude", "comma separated URL path prefixes not to log")
+
+	flags.StringVar(&config.traceExport, "trace-export", config.traceExport, "file or collector URL to export spans to as OTLP JSON")
+
+	if err := flags.Parse(config.args); err != nil {
+		return config, err
+	}
+	config.command = flags.Args()
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "log-max-size", "log-daily", "log-keep", "log-compress":
+			config.accessLogRotation = config.logRotation // asked for, otherwise it grows & nothing is deleted
+		}
+	})
+
+	if err := validate(config); err != nil {
+		fmt.Fprintln(flags.Output(), err)
+		flags.Usage()
+		return config, err
+	}
+	return config, nil
+}
+
+// Constraints between flags that can't be captured by the flag types alone
+func validate(config *Config) error {
+	if (config.tlsCertFile == "") != (config.tlsKeyFile == "") {
+		return fmt.Errorf("--tls-cert and --tls-key must be used together")
+	}
+	if config.tlsSelfSigned && config.tlsCertFile != "" {
+		return fmt.Errorf("--tls-self-signed can't be combined with --tls-cert")
+	}
+	if config.tlsClientCaFile != "" && !config.IsTlsEnabled() {
+		return fmt.Errorf("--tls-client-ca requires HTTPS, see --tls-cert or --tls-self-signed")
+	}
+	if config.redirectPort != 0 && !config.IsTlsEnabled() {
+		return fmt.Errorf("--redirect-port requires HTTPS, see --tls-cert or --tls-self-signed")
+	}
+	if _, err := auth.ParseRole(config.clientCertRole); err != nil {
+		return fmt.Errorf("--client-cert-role: %v", err)
+	}
+	if config.sessionTtl < time.Minute {
+		return fmt.Errorf("--session-ttl must be at least 1m")
+	}
+	if config.redirectPort != 0 && config.redirectPort == config.listenPort {
+		return fmt.Errorf("--redirect-port must differ from --port")
+	}
+	if config.rateLimit < 0 || config.maxInFlight < 0 {
+		return fmt.Errorf("--rate-limit and --max-in-flight can't be negative")
+	}
+	if config.shutdownDelay < 0 || config.drainTimeout < 0 {
+		return fmt.Errorf("--shutdown-delay and --drain-timeout can't be negative")
+	}
+	if config.hstsMaxAge < 0 {
+		return fmt.Errorf("--hsts-max-age can't be negative")
+	}
+	if config.logRotation.Keep < 0 || config.logBuffer < 0 {
+		return fmt.Errorf("--log-keep and --log-buffer can't be negative")
+	}
+	if config.logFile != "" && config.logSink.Protocol != "" {
+		return fmt.Errorf("--log-file and --log-sink can't be used together")
+	}
+	if config.accessLog != "" && config.logFile != "" && sameFile(config.accessLog, config.logFile) {
+		return fmt.Errorf("--access-log and --log-file must be different files")
+	}
+	if config.rateLimit > 0 && config.rateBurst < 1 {
+		return fmt.Errorf("--rate-burst must be at least 1")
+	}
+	return validateOidc(config)
+}
+
+func validateOidc(config *Config) error {
+	if config.oidcIssuer == "" {
+		if config.oidcClientId != "" || config.oidcSecretFile != "" || config.oidcRedirectUrl != "" || len(config.oidcRoles) > 0 {
+			return fmt.Errorf("--oidc-* options require --oidc-issuer")
+		}
+		return nil
+	}
+	if u, err := url.Parse(config.oidcIssuer); err != nil || u.Host == "" || (u.Scheme != "https" && !isLoopback(u)) {
+		return fmt.Errorf("--oidc-issuer must be an https URL")
+	}
+	if config.oidcClientId == "" {
+		return fmt.Errorf("--oidc-issuer requires --oidc-client-id")
+	}
+	if len(config.oidcRoles) == 0 {
+		return fmt.Errorf("--oidc-issuer requires --oidc-roles, e.g. mingo-admins=admin,*=viewer")
+	}
+	if _, err := oidc.ParseRoleMap(config.oidcRoleClaim, config.oidcRoles); err != nil {
+		return fmt.Errorf("--oidc-roles: %v", err)
+	}
+	if config.oidcRedirectUrl != "" {
+		if u, err := url.Parse(config.oidcRedirectUrl); err != nil || !u.IsAbs() || u.Host == "" {
+			return fmt.Errorf("--oidc-redirect-url must be an absolute URL")
+		}
+	}
+	return nil
+}
+
+// Whether two paths name the same file, each rotating it would lose the other's lines
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	if absA == absB {
+		return true
+	}
+	infoA, errA := os.Stat(absA)
+	infoB, errB := os.Stat(absB)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB) // e.g. through a symlink
+}
+
+// A provider on this machine, e.g. for development, may use plain HTTP
+func isLoopback(u *url.URL) bool {
+	host := u.Hostname()
+	return u.Scheme == "http" && (host == "localhost" || host == "127.0.0.1" || host == "::1")
 }
 
 // Default usage neglects help flag and uses -flag rather than --flag or -f
 func usageHelpMessage(progname string, w io.Writer) {
 	// TODO: append options based on defined flags in order
-	template := `Usage: %s [OPTION]
+	template := `Usage: %[1]s [OPTION]
+       %[1]s [OPTION] user add|passwd|role|disable ...
+       %[1]s [OPTION] token create|list|revoke ...
+       %[1]s [OPTION] log-level [<component>=<level> ...]
+
+Commands:
+ user add [--role <role>] <username>
+ 			create a login for the CRUD UI as a viewer, editor or
+ 			admin (default viewer), reads the password from stdin
+ user passwd <username>	change a user's password, ends their sessions
+ user role <username> <role>
+ 			change what a user may do, ends their sessions
+ user disable <username>
+ 			block a user from logging in, ends their sessions
+ token create [--scopes <list>] [--expires <duration>] <username> <name>
+ 			print a new API token that acts as username, scopes
+ 			are read, write & admin (default read, expires 2160h)
+ token list [<username>]
+ 			list API tokens, never their secrets
+ token revoke <id>	revoke an API token
+ log-level [<component>=<level> ...]
+ 			show or change the running server's log levels, needs
+ 			an admin scoped API token in $MINGO_TOKEN
 
 Options:
+     --access-log <file>
+ 			append access log lines to this file, rotated like
+ 			--log-file only when a --log-* rotation option is given,
+ 			e.g. for audits that mustn't lose lines (default
+ 			alongside the other components' lines)
+     --access-log-exclude <prefixes>
+ 			comma separated URL path prefixes whose requests aren't
+ 			logged, e.g. /health,/static/
+     --access-log-format <format>
+ 			mingo, combined (Apache's Combined Log Format) or json,
+ 			a JSON object per line (default mingo)
+     --client-cert-paths <prefixes>
+ 			comma separated URL path prefixes that require a client
+ 			certificate when --tls-client-ca is set (default /api/)
+     --client-cert-role <role>
+ 			role of callers authenticated by a client certificate:
+ 			viewer, editor or admin (default viewer)
+     --cors <spec>	let browsers on other origins call a URL path prefix,
+ 			repeat for more prefixes, the longest match applies:
+ 			"<prefix> origins=<list> [methods=<list>]
+ 			[headers=<list>] [expose=<list>] [credentials=true]
+ 			[max-age=<duration>]", origins may be * or wildcard
+ 			subdomains like https://*.example.com, methods default
+ 			to GET,HEAD,POST and headers to Content-Type
+     --csp <policy>	Content-Security-Policy to send, {nonce} is replaced by
+ 			a per request nonce that the page's inline scripts &
+ 			styles carry, empty to send none (default only this
+ 			server's assets and nonced inline code)
+     --csp-report-only	report policy violations to /csp-report without
+ 			blocking anything, for trying out a new --csp
+     --db <file>	sqlite database file (default my.db)
  -d, --dir <dir>	override files embedded in binary and serve /static/*
  			urls from disk
+     --dir-listing	list directories under /static/ that have no index
+ 			file (default off)
+     --drain-timeout <duration>
+ 			how long in-flight requests get to finish once stopping,
+ 			a second SIGINT or SIGTERM stops at once (default 5s)
  -h, --help		this help message
+     --hsts-max-age <duration>
+ 			how long browsers should only use HTTPS, sent over HTTPS,
+ 			0 to send no HSTS (default 8760h)
+     --index <files>	comma separated index files for directories under
+ 			/static/ (default index.html)
+     --log-buffer <n>	recent log lines to keep in memory for admins to read
+ 			and follow live at /admin/logs, 0 for none (default
+ 			1000)
+     --log-compress	gzip rotated log files (default off)
+     --log-daily	also rotate log files when the UTC day changes
+ 			(default off)
+     --log-file <file>	write the log to this file rather than stderr, rotated
+ 			by size and/or day, reopened on SIGUSR1 for an external
+ 			logrotate
+     --log-keep <n>	rotated log files to keep, 0 keeps them all (default 7)
+     --log-level <levels>
+ 			comma separated [<component>=]<level> pairs, a level
+ 			alone applies to components not named, levels are debug,
+ 			info, warn, error & off, change them while running with
+ 			the log-level command (default info)
+     --log-max-size <size>
+ 			rotate --log-file & --access-log when they would grow
+ 			past this, e.g. 512K, 100M or 1G, 0 for no limit
+ 			(default 100M)
+     --log-sink <sink>	send the log to a collector rather than stderr, keeping
+ 			each line's component, level & request id: journald,
+ 			syslog (RFC 5424 to /dev/log), syslog+unix://<path>,
+ 			syslog+udp://<host>[:<port>] or
+ 			syslog+tcp://<host>[:<port>]
+     --max-in-flight <n>
+ 			concurrent requests beyond which to shed load with 503,
+ 			0 for no limit (default 256)
+     --oidc-client-id <id>
+ 			client id registered with the OpenID provider
+     --oidc-client-secret-file <file>
+ 			file holding the client secret, omit for a public client
+     --oidc-issuer <url>
+ 			offer single sign-on with this OpenID Connect provider,
+ 			authorization code flow with PKCE
+     --oidc-redirect-url <url>
+ 			callback registered with the provider (default this
+ 			server's /login/oidc/callback)
+     --oidc-role-claim <claim>
+ 			ID token claim whose values --oidc-roles maps (default
+ 			groups)
+     --oidc-roles <pairs>
+ 			comma separated <claim value>=<role> pairs, the most
+ 			powerful match wins, * matches anyone, e.g.
+ 			mingo-admins=admin,staff=editor,*=viewer
+     --oidc-username-claim <claim>
+ 			ID token claim that names a new user (default
+ 			preferred_username)
  -p, --port <port>	port to listen on for webserver
+     --rate-burst <n>	requests a client may make at once before --rate-limit
+ 			applies (default 40)
+     --rate-limit <n>	sustained requests per second per client address, or
+ 			per user once logged in, 0 for no limit (default 20)
+     --redirect-port <port>
+ 			listen for plain HTTP on this port and redirect to HTTPS
+     --session-ttl <duration>
+ 			how long a login lasts, e.g. 30m or 12h (default 12h)
+     --shutdown-delay <duration>
+ 			keep serving this long once told to stop, with /ready
+ 			reporting 503 so load balancers move traffic away first
+ 			(default 0s)
+     --spa-fallback <file>
+ 			serve this file for unknown extensionless paths under
+ 			/static/, e.g. index.html for a single page app
+     --tls-cert <file>	PEM certificate (chain) to serve HTTPS with, reloaded
+ 			on SIGHUP
+     --tls-client-ca <file>
+ 			PEM CA bundle that signs client certificates, enables
+ 			mutual TLS
+     --tls-dir <dir>	where --tls-self-signed keeps its CA and certificate
+     --tls-key <file>	PEM private key for --tls-cert
+     --tls-self-signed	serve HTTPS with a generated local CA and certificate
+ 			for this host
+     --trace-export <file|url>
+ 			export request & database spans as OTLP JSON, a line per
+ 			batch appended to a file, or posted to a collector URL
+ 			like http://localhost:4318/v1/traces (default none,
+ 			traceparent headers are still honoured)
+     --trusted-proxies <cidrs>
+ 			comma separated addresses or CIDRs of reverse proxies
+ 			whose X-Forwarded-For, -Proto & -Host headers name
+ 			the client and the origin it asked for
 `
 	fmt.Fprintf(w, template, progname)
 }
@@ -68,3 +385,208 @@ func (p *portVar) Set(s string) error {
 	*p.port = uint16(val)
 	return nil
 }
+
+// A comma separated list of IP addresses or CIDRs, e.g. --trusted-proxies 10.0.0.0/8,192.0.2.1
+type cidrListVar struct {
+	nets *[]*net.IPNet
+}
+
+func (c *cidrListVar) String() string {
+	if c.nets == nil {
+		return ""
+	}
+
+	var items []string
+	for _, n := range *c.nets {
+		items = append(items, n.String())
+	}
+	return strings.Join(items, ",")
+}
+
+func (c *cidrListVar) Set(s string) error {
+	var items []string
+	if err := (&listVar{&items}).Set(s); err != nil {
+		return err
+	}
+
+	var nets []*net.IPNet
+	for _, item := range items {
+		cidr := item
+		if ip := net.ParseIP(item); ip != nil && ip.To4() != nil {
+			cidr += "/32"
+		} else if ip != nil {
+			cidr += "/128"
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("%q is not an IP address or CIDR", item)
+		}
+		nets = append(nets, n)
+	}
+	*c.nets = nets
+	return nil
+}
+
+// A repeatable flag, one CORS policy per URL path prefix, e.g. --cors "/api/ origins=https://*.example.com"
+type corsVar struct {
+	policies *cors.Policies
+}
+
+func (c *corsVar) String() string {
+	if c.policies == nil {
+		return ""
+	}
+
+	var prefixes []string
+	for _, p := range *c.policies {
+		prefixes = append(prefixes, p.Prefix)
+	}
+	return strings.Join(prefixes, ",")
+}
+
+func (c *corsVar) Set(s string) error {
+	p, err := cors.Parse(s)
+	if err != nil {
+		return err
+	}
+	for _, existing := range *c.policies {
+		if existing.Prefix == p.Prefix {
+			return fmt.Errorf("more than one policy for %s", p.Prefix)
+		}
+	}
+
+	*c.policies = append(*c.policies, p)
+	return nil
+}
+
+// One of the access log formats, e.g. --access-log-format combined
+type accessFormatVar struct {
+	format *logger.AccessFormat
+}
+
+func (a *accessFormatVar) String() string {
+	if a.format == nil {
+		return ""
+	}
+
+	return string(*a.format)
+}
+
+func (a *accessFormatVar) Set(s string) error {
+	f, err := logger.ParseAccessFormat(s)
+	if err != nil {
+		return err
+	}
+
+	*a.format = f
+	return nil
+}
+
+// A journald or syslog collector, e.g. --log-sink syslog+udp://logs.example.com
+type sinkVar struct {
+	address *logger.SinkAddress
+}
+
+func (v *sinkVar) String() string {
+	if v.address == nil {
+		return ""
+	}
+
+	return v.address.String()
+}
+
+func (v *sinkVar) Set(s string) error {
+	a, err := logger.ParseSinkAddress(s)
+	if err != nil {
+		return err
+	}
+
+	*v.address = a
+	return nil
+}
+
+// Log levels by component, e.g. --log-level warn,sql=debug
+type levelsVar struct {
+	levels *map[string]logger.Level
+}
+
+func (v *levelsVar) String() string {
+	if v.levels == nil {
+		return ""
+	}
+
+	return logger.FormatLevels(*v.levels)
+}
+
+func (v *levelsVar) Set(s string) error {
+	levels, err := logger.ParseLevels(s)
+	if err != nil {
+		return err
+	}
+
+	*v.levels = levels
+	return nil
+}
+
+// A size in bytes with an optional K, M or G suffix, e.g. --log-max-size 100M
+type sizeVar struct {
+	size *int64
+}
+
+func (v *sizeVar) String() string {
+	if v.size == nil {
+		return ""
+	}
+
+	return strconv.FormatInt(*v.size, 10)
+}
+
+func (v *sizeVar) Set(s string) error {
+	digits, shift := s, 0
+	switch {
+	case strings.HasSuffix(s, "K"):
+		shift = 10
+	case strings.HasSuffix(s, "M"):
+		shift = 20
+	case strings.HasSuffix(s, "G"):
+		shift = 30
+	}
+	if shift > 0 {
+		digits = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64>>shift {
+		return fmt.Errorf("%q is not a size like 512K, 100M or 1G", s)
+	}
+
+	*v.size = n << shift
+	return nil
+}
+
+// A comma separated list flag, e.g. --index index.html,index.htm
+type listVar struct {
+	list *[]string
+}
+
+func (l *listVar) String() string {
+	if l.list == nil {
+		return ""
+	}
+
+	return strings.Join(*l.list, ",")
+}
+
+func (l *listVar) Set(s string) error {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	if len(items) == 0 {
+		return fmt.Errorf("empty list")
+	}
+
+	*l.list = items
+	return nil
+}
@@ -8,14 +8,189 @@ import (
 	"testing"
 	"time"
 
+	"github.com/craigjperry2/mingo/internal/app/mingo/logger"
 	"github.com/craigjperry2/mingo/internal/app/mingo/system"
 )
 
 func TestFlags(t *testing.T) {
-	const expectedHelpText = "Usage: testprog [OPTION]\n\nOptions:\n -d, --dir <dir>\toverride files embedded in binary and serve /static/*\n \t\t\turls from disk\n -h, --help\t\tthis help message\n -p, --port <port>\tport to listen on for webserver\n"
+	const expectedHelpText = `Usage: testprog [OPTION]
+       testprog [OPTION] user add|passwd|role|disable ...
+       testprog [OPTION] token create|list|revoke ...
+       testprog [OPTION] log-level [<component>=<level> ...]
+
+Commands:
+ user add [--role <role>] <username>
+ 			create a login for the CRUD UI as a viewer, editor or
+ 			admin (default viewer), reads the password from stdin
+ user passwd <username>	change a user's password, ends their sessions
+ user role <username> <role>
+ 			change what a user may do, ends their sessions
+ user disable <username>
+ 			block a user from logging in, ends their sessions
+ token create [--scopes <list>] [--expires <duration>] <username> <name>
+ 			print a new API token that acts as username, scopes
+ 			are read, write & admin (default read, expires 2160h)
+ token list [<username>]
+ 			list API tokens, never their secrets
+ token revoke <id>	revoke an API token
+ log-level [<component>=<level> ...]
+ 			show or change the running server's log levels, needs
+ 			an admin scoped API token in $MINGO_TOKEN
+
+Options:
+     --access-log <file>
+ 			append access log lines to this file, rotated like
+ 			--log-file only when a --log-* rotation option is given,
+ 			e.g. for audits that mustn't lose lines (default
+ 			alongside the other components' lines)
+     --access-log-exclude <prefixes>
+ 			comma separated URL path prefixes whose requests aren't
+ 			logged, e.g. /health,/static/
+     --access-log-format <format>
+ 			mingo, combined (Apache's Combined Log Format) or json,
+ 			a JSON object per line (default mingo)
+     --client-cert-paths <prefixes>
+ 			comma separated URL path prefixes that require a client
+ 			certificate when --tls-client-ca is set (default /api/)
+     --client-cert-role <role>
+ 			role of callers authenticated by a client certificate:
+ 			viewer, editor or admin (default viewer)
+     --cors <spec>	let browsers on other origins call a URL path prefix,
+ 			repeat for more prefixes, the longest match applies:
+ 			"<prefix> origins=<list> [methods=<list>]
+ 			[headers=<list>] [expose=<list>] [credentials=true]
+ 			[max-age=<duration>]", origins may be * or wildcard
+ 			subdomains like https://*.example.com, methods default
+ 			to GET,HEAD,POST and headers to Content-Type
+     --csp <policy>	Content-Security-Policy to send, {nonce} is replaced by
+ 			a per request nonce that the page's inline scripts &
+ 			styles carry, empty to send none (default only this
+ 			server's assets and nonced inline code)
+     --csp-report-only	report policy violations to /csp-report without
+ 			blocking anything, for trying out a new --csp
+     --db <file>	sqlite database file (default my.db)
+ -d, --dir <dir>	override files embedded in binary and serve /static/*
+ 			urls from disk
+     --dir-listing	list directories under /static/ that have no index
+ 			file (default off)
+     --drain-timeout <duration>
+ 			how long in-flight requests get to finish once stopping,
+ 			a second SIGINT or SIGTERM stops at once (default 5s)
+ -h, --help		this help message
+     --hsts-max-age <duration>
+ 			how long browsers should only use HTTPS, sent over HTTPS,
+ 			0 to send no HSTS (default 8760h)
+     --index <files>	comma separated index files for directories under
+ 			/static/ (default index.html)
+     --log-buffer <n>	recent log lines to keep in memory for admins to read
+ 			and follow live at /admin/logs, 0 for none (default
+ 			1000)
+     --log-compress	gzip rotated log files (default off)
+     --log-daily	also rotate log files when the UTC day changes
+ 			(default off)
+     --log-file <file>	write the log to this file rather than stderr, rotated
+ 			by size and/or day, reopened on SIGUSR1 for an external
+ 			logrotate
+     --log-keep <n>	rotated log files to keep, 0 keeps them all (default 7)
+     --log-level <levels>
+ 			comma separated [<component>=]<level> pairs, a level
+ 			alone applies to components not named, levels are debug,
+ 			info, warn, error & off, change them while running with
+ 			the log-level command (default info)
+     --log-max-size <size>
+ 			rotate --log-file & --access-log when they would grow
+ 			past this, e.g. 512K, 100M or 1G, 0 for no limit
+ 			(default 100M)
+     --log-sink <sink>	send the log to a collector rather than stderr, keeping
+ 			each line's component, level & request id: journald,
+ 			syslog (RFC 5424 to /dev/log), syslog+unix://<path>,
+ 			syslog+udp://<host>[:<port>] or
+ 			syslog+tcp://<host>[:<port>]
+     --max-in-flight <n>
+ 			concurrent requests beyond which to shed load with 503,
+ 			0 for no limit (default 256)
+     --oidc-client-id <id>
+ 			client id registered with the OpenID provider
+     --oidc-client-secret-file <file>
+ 			file holding the client secret, omit for a public client
+     --oidc-issuer <url>
+ 			offer single sign-on with this OpenID Connect provider,
+ 			authorization code flow with PKCE
+     --oidc-redirect-url <url>
+ 			callback registered with the provider (default this
+ 			server's /login/oidc/callback)
+     --oidc-role-claim <claim>
+ 			ID token claim whose values --oidc-roles maps (default
+ 			groups)
+     --oidc-roles <pairs>
+ 			comma separated <claim value>=<role> pairs, the most
+ 			powerful match wins, * matches anyone, e.g.
+ 			mingo-admins=admin,staff=editor,*=viewer
+     --oidc-username-claim <claim>
+ 			ID token claim that names a new user (default
+ 			preferred_username)
+ -p, --port <port>	port to listen on for webserver
+     --rate-burst <n>	requests a client may make at once before --rate-limit
+ 			applies (default 40)
+     --rate-limit <n>	sustained requests per second per client address, or
+ 			per user once logged in, 0 for no limit (default 20)
+     --redirect-port <port>
+ 			listen for plain HTTP on this port and redirect to HTTPS
+     --session-ttl <duration>
+ 			how long a login lasts, e.g. 30m or 12h (default 12h)
+     --shutdown-delay <duration>
+ 			keep serving this long once told to stop, with /ready
+ 			reporting 503 so load balancers move traffic away first
+ 			(default 0s)
+     --spa-fallback <file>
+ 			serve this file for unknown extensionless paths under
+ 			/static/, e.g. index.html for a single page app
+     --tls-cert <file>	PEM certificate (chain) to serve HTTPS with, reloaded
+ 			on SIGHUP
+     --tls-client-ca <file>
+ 			PEM CA bundle that signs client certificates, enables
+ 			mutual TLS
+     --tls-dir <dir>	where --tls-self-signed keeps its CA and certificate
+     --tls-key <file>	PEM private key for --tls-cert
+     --tls-self-signed	serve HTTPS with a generated local CA and certificate
+ 			for this host
+     --trace-export <file|url>
+ 			export request & database spans as OTLP JSON, a line per
+ 			batch appended to a file, or posted to a collector URL
+ 			like http://localhost:4318/v1/traces (default none,
+ 			traceparent headers are still honoured)
+     --trusted-proxies <cidrs>
+ 			comma separated addresses or CIDRs of reverse proxies
+ 			whose X-Forwarded-For, -Proto & -Host headers name
+ 			the client and the origin it asked for
+`
 	const expectedFlagError = "flag: help requested"
 	const missingPortArg = "flag needs an argument: -port"
 	const missingDirArg = "flag needs an argument: -d"
+	const tlsPairError = "--tls-cert and --tls-key must be used together"
+	const tlsSelfSignedError = "--tls-self-signed can't be combined with --tls-cert"
+	const clientCaError = "--tls-client-ca requires HTTPS, see --tls-cert or --tls-self-signed"
+	const redirectError = "--redirect-port requires HTTPS, see --tls-cert or --tls-self-signed"
+	const redirectPortError = "--redirect-port must differ from --port"
+	const sessionTtlError = "--session-ttl must be at least 1m"
+	const certRoleError = "--client-cert-role: unknown role \"root\", want viewer, editor or admin"
+	const trustedProxiesError = "invalid value \"10.0.0.0/8,proxy.example\" for flag -trusted-proxies: \"proxy.example\" is not an IP address or CIDR"
+	const rateBurstError = "--rate-burst must be at least 1"
+	const hstsError = "--hsts-max-age can't be negative"
+	const logKeepError = "--log-keep and --log-buffer can't be negative"
+	const drainError = "--shutdown-delay and --drain-timeout can't be negative"
+	const logSinkError = "invalid value \"syslog+sctp://logs.example.com\" for flag -log-sink: unknown log sink \"syslog+sctp://logs.example.com\", want journald, syslog or syslog+{unix,udp,tcp}://<address>"
+	const logSinkFileError = "--log-file and --log-sink can't be used together"
+	const accessLogFileError = "--access-log and --log-file must be different files"
+	const logSizeError = "invalid value \"10MB\" for flag -log-max-size: \"10MB\" is not a size like 512K, 100M or 1G"
+	const accessFormatError = "invalid value \"apache\" for flag -access-log-format: unknown access log format \"apache\", want mingo, combined or json"
+	const corsDuplicateError = "invalid value \"/api/ origins=*\" for flag -cors: more than one policy for /api/"
+	const corsCredentialsError = "invalid value \"/api/ origins=* credentials=true\" for flag -cors: \"/api/ origins=* credentials=true\" can't send credentials to any origin, list them"
+	const oidcIssuerError = "--oidc-* options require --oidc-issuer"
+	const oidcHttpsError = "--oidc-issuer must be an https URL"
+	const oidcRolesError = "--oidc-issuer requires --oidc-roles, e.g. mingo-admins=admin,*=viewer"
+	const oidcRoleError = "--oidc-roles: unknown role \"root\", want viewer, editor or admin"
+	const emptyIndexError = "invalid value \",\" for flag -index: empty list"
 	const portErrorTemplate = "invalid value \"%d\" for flag -port: port %d out of range [1:65535]"
 	var unexpectedPort0Error = fmt.Sprintf(portErrorTemplate, 0, 0)
 	var unexpectedPort65536Error = fmt.Sprintf(portErrorTemplate, 65536, 65536)
@@ -38,6 +213,50 @@ func TestFlags(t *testing.T) {
 		{makeConfig([]string{"--port"}, 0, &loggingBuf, ""), missingPortArg + "\n" + expectedHelpText, missingPortArg},
 		{makeConfig([]string{"-d"}, 0, &loggingBuf, ""), missingDirArg + "\n" + expectedHelpText, missingDirArg},
 		{makeConfig([]string{"--dir", "does-not-exist"}, 0, &loggingBuf, "does-not-exist"), "", ""},
+		{makeConfig([]string{"--dir-listing"}, 0, &loggingBuf, ""), "", ""},
+		{makeConfig([]string{"--index", "index.htm,index.html"}, 0, &loggingBuf, ""), "", ""},
+		{makeConfig([]string{"--index", ","}, 0, &loggingBuf, ""), emptyIndexError + "\n" + expectedHelpText, emptyIndexError},
+		{makeConfig([]string{"--spa-fallback", "index.html"}, 0, &loggingBuf, ""), "", ""},
+		{makeConfig([]string{"--tls-cert", "cert.pem", "--tls-key", "key.pem"}, 0, &loggingBuf, ""), "", ""},
+		{makeConfig([]string{"--tls-cert", "cert.pem"}, 0, &loggingBuf, ""), tlsPairError + "\n" + expectedHelpText, tlsPairError},
+		{makeConfig([]string{"--tls-self-signed", "--tls-dir", "certs"}, 0, &loggingBuf, ""), "", ""},
+		{makeConfig([]string{"--tls-self-signed", "--tls-cert", "c", "--tls-key", "k"}, 0, &loggingBuf, ""), tlsSelfSignedError + "\n" + expectedHelpText, tlsSelfSignedError},
+		{makeConfig([]string{"--tls-self-signed", "-p", "8443", "--redirect-port", "8080"}, 8443, &loggingBuf, ""), "", ""},
+		{makeConfig([]string{"--tls-self-signed", "--tls-client-ca", "ca.pem", "--client-cert-paths", "/api/,/admin/"}, 0, &loggingBuf, ""), "", ""},
+		{makeConfig([]string{"--tls-client-ca", "ca.pem"}, 0, &loggingBuf, ""), clientCaError + "\n" + expectedHelpText, clientCaError},
+		{makeConfig([]string{"--redirect-port", "8080"}, 0, &loggingBuf, ""), redirectError + "\n" + expectedHelpText, redirectError},
+		{makeConfig([]string{"--tls-self-signed", "-p", "8443", "--redirect-port", "8443"}, 8443, &loggingBuf, ""), redirectPortError + "\n" + expectedHelpText, redirectPortError},
+		{makeConfig([]string{"--db", "other.db", "--session-ttl", "30m"}, 0, &loggingBuf, ""), "", ""},
+		{makeConfig([]string{"--session-ttl", "30s"}, 0, &loggingBuf, ""), sessionTtlError + "\n" + expectedHelpText, sessionTtlError},
+		{makeConfig([]string{"user", "add", "alice"}, 0, &loggingBuf, ""), "", ""},
+		{makeConfig([]string{"--client-cert-role", "editor"}, 0, &loggingBuf, ""), "", ""},
+		{makeConfig([]string{"--client-cert-role", "root"}, 0, &loggingBuf, ""), certRoleError + "\n" + expectedHelpText, certRoleError},
+		{makeConfig([]string{"--rate-limit", "2.5", "--rate-burst", "5", "--max-in-flight", "0", "--trusted-proxies", "10.0.0.0/8,192.0.2.1,::1"}, 0, &loggingBuf, ""), "", ""},
+		{makeConfig([]string{"--trusted-proxies", "10.0.0.0/8,proxy.example"}, 0, &loggingBuf, ""), trustedProxiesError + "\n" + expectedHelpText, trustedProxiesError},
+		{makeConfig([]string{"--rate-limit", "5", "--rate-burst", "0"}, 0, &loggingBuf, ""), rateBurstError + "\n" + expectedHelpText, rateBurstError},
+		{makeConfig([]string{"--csp", "default-src 'self'", "--csp-report-only", "--hsts-max-age", "0"}, 0, &loggingBuf, ""), "", ""},
+		{makeConfig([]string{"--hsts-max-age", "-1s"}, 0, &loggingBuf, ""), hstsError + "\n" + expectedHelpText, hstsError},
+		{makeConfig([]string{"--cors", "/api/ origins=https://*.example.com credentials=true", "--cors", "/api/admin/ origins=https://ops.example.com max-age=1h"}, 0, &loggingBuf, ""), "", ""},
+		{makeConfig([]string{"--cors", "/api/ origins=https://app.example.com", "--cors", "/api/ origins=*"}, 0, &loggingBuf, ""), corsDuplicateError + "\n" + expectedHelpText, corsDuplicateError},
+		{makeConfig([]string{"--cors", "/api/ origins=* credentials=true"}, 0, &loggingBuf, ""), corsCredentialsError + "\n" + expectedHelpText, corsCredentialsError},
+		{makeConfig([]string{"--trace-export", "http://localhost:4318/v1/traces"}, 0, &loggingBuf, ""), "", ""},
+		{makeConfig([]string{"--access-log-format", "json", "--access-log-exclude", "/health,/static/"}, 0, &loggingBuf, ""), "", ""},
+		{makeConfig([]string{"--log-max-size", "1G", "--log-daily", "--log-keep", "0", "--log-compress"}, 0, &loggingBuf, ""), "", ""},
+		{makeConfig([]string{"--log-max-size", "10MB"}, 0, &loggingBuf, ""), logSizeError + "\n" + expectedHelpText, logSizeError},
+		{makeConfig([]string{"--log-keep", "-1"}, 0, &loggingBuf, ""), logKeepError + "\n" + expectedHelpText, logKeepError},
+		{makeConfig([]string{"--shutdown-delay", "10s", "--drain-timeout", "30s"}, 0, &loggingBuf, ""), "", ""},
+		{makeConfig([]string{"--drain-timeout", "-1s"}, 0, &loggingBuf, ""), drainError + "\n" + expectedHelpText, drainError},
+		{makeConfig([]string{"--log-sink", "syslog+udp://logs.example.com"}, 0, &loggingBuf, ""), "", ""},
+		{makeConfig([]string{"--log-sink", "syslog+sctp://logs.example.com"}, 0, &loggingBuf, ""), logSinkError + "\n" + expectedHelpText, logSinkError},
+		{makeConfig([]string{"--log-sink", "journald", "--log-file", "mingo.log"}, 0, &loggingBuf, ""), logSinkFileError + "\n" + expectedHelpText, logSinkFileError},
+		{makeConfig([]string{"--log-file", "mingo.log", "--access-log", "./mingo.log"}, 0, &loggingBuf, ""), accessLogFileError + "\n" + expectedHelpText, accessLogFileError},
+		{makeConfig([]string{"--access-log-format", "apache"}, 0, &loggingBuf, ""), accessFormatError + "\n" + expectedHelpText, accessFormatError},
+		{makeConfig([]string{"--oidc-issuer", "https://idp.example/realms/corp", "--oidc-client-id", "mingo", "--oidc-roles", "admins=admin,*=viewer"}, 0, &loggingBuf, ""), "", ""},
+		{makeConfig([]string{"--oidc-issuer", "http://localhost:8180", "--oidc-client-id", "mingo", "--oidc-roles", "*=viewer"}, 0, &loggingBuf, ""), "", ""},
+		{makeConfig([]string{"--oidc-client-id", "mingo"}, 0, &loggingBuf, ""), oidcIssuerError + "\n" + expectedHelpText, oidcIssuerError},
+		{makeConfig([]string{"--oidc-issuer", "http://idp.example", "--oidc-client-id", "mingo", "--oidc-roles", "*=viewer"}, 0, &loggingBuf, ""), oidcHttpsError + "\n" + expectedHelpText, oidcHttpsError},
+		{makeConfig([]string{"--oidc-issuer", "https://idp.example", "--oidc-client-id", "mingo"}, 0, &loggingBuf, ""), oidcRolesError + "\n" + expectedHelpText, oidcRolesError},
+		{makeConfig([]string{"--oidc-issuer", "https://idp.example", "--oidc-client-id", "mingo", "--oidc-roles", "*=root"}, 0, &loggingBuf, ""), oidcRoleError + "\n" + expectedHelpText, oidcRoleError},
 	}
 
 	for _, tt := range tests {
@@ -60,6 +279,73 @@ func TestFlags(t *testing.T) {
 	}
 }
 
+func TestStaticFlags(t *testing.T) {
+	var loggingBuf bytes.Buffer
+
+	config, err := parseFlags(makeConfig([]string{"--index", " index.htm , default.html", "--dir-listing", "--spa-fallback", "app.html"}, 0, &loggingBuf, ""))
+	if err != nil {
+		t.Fatalf("err got %v, want nil", err)
+	}
+	if want := []string{"index.htm", "default.html"}; !reflect.DeepEqual(config.GetStaticIndexFiles(), want) {
+		t.Errorf("index got %q, want %q", config.GetStaticIndexFiles(), want)
+	}
+	if !config.GetStaticDirListing() {
+		t.Error("dir-listing got false, want true")
+	}
+	if config.GetStaticSpaFallback() != "app.html" {
+		t.Errorf("spa-fallback got %q, want %q", config.GetStaticSpaFallback(), "app.html")
+	}
+}
+
+func TestAccessLogRotation(t *testing.T) {
+	var loggingBuf bytes.Buffer
+	parse := func(args ...string) *Config {
+		c := makeConfig(args, 0, &loggingBuf, "")
+		c.logRotation = logger.Rotation{MaxSize: 100 << 20, Keep: 7}
+		config, err := parseFlags(c)
+		if err != nil {
+			t.Fatalf("err got %v, want nil", err)
+		}
+		return config
+	}
+
+	if config := parse("--log-file", "mingo.log", "--access-log", "access.log"); config.accessLogRotation != (logger.Rotation{}) {
+		t.Errorf("rotation got %+v, want none without a rotation option", config.accessLogRotation)
+	}
+	want := logger.Rotation{MaxSize: 100 << 20, Daily: true, Keep: 7}
+	if config := parse("--access-log", "access.log", "--log-daily"); config.accessLogRotation != want {
+		t.Errorf("rotation got %+v, want %+v once a rotation option is given", config.accessLogRotation, want)
+	}
+}
+
+func TestCommandArgs(t *testing.T) {
+	var loggingBuf bytes.Buffer
+
+	config, err := parseFlags(makeConfig([]string{"--db", "users.db", "user", "add", "alice"}, 0, &loggingBuf, ""))
+	if err != nil {
+		t.Fatalf("err got %v, want nil", err)
+	}
+	if config.GetDatabasePath() != "users.db" {
+		t.Errorf("db got %q, want %q", config.GetDatabasePath(), "users.db")
+	}
+	if want := []string{"user", "add", "alice"}; !reflect.DeepEqual(config.GetCommand(), want) {
+		t.Errorf("command got %q, want %q", config.GetCommand(), want)
+	}
+}
+
 func makeConfig(cli []string, port uint16, logDest *bytes.Buffer, staticDir string) *Config {
-	return &Config{"testprog", time.Time{}, cli, "", "", port, logDest, staticDir, system.ClockForTesting("2022-04-30T23:59:59Z"), nil}
+	return &Config{
+		progname:           "testprog",
+		startUtc:           time.Time{},
+		args:               cli,
+		listenPort:         port,
+		loggingDestination: logDest,
+		staticDir:          staticDir,
+		clientCertRole:     "viewer",
+		dbPath:             "my.db",
+		sessionTtl:         12 * time.Hour,
+		oidcUsernameClaim:  "preferred_username",
+		oidcRoleClaim:      "groups",
+		clock:              system.ClockForTesting("2022-04-30T23:59:59Z"),
+	}
 }
@@ -1,12 +1,23 @@
 package config
 
 import (
+	"fmt"
 	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/craigjperry2/mingo/internal/app/mingo/cors"
 	"github.com/craigjperry2/mingo/internal/app/mingo/database"
+	"github.com/craigjperry2/mingo/internal/app/mingo/logger"
+	"github.com/craigjperry2/mingo/internal/app/mingo/oidc"
 	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+	"github.com/craigjperry2/mingo/internal/app/mingo/tracing"
 )
 
 type Config struct {
@@ -18,18 +29,87 @@ type Config struct {
 	listenPort         uint16
 	loggingDestination io.Writer
 	staticDir          string
+	staticIndexFiles   []string
+	staticDirListing   bool
+	staticSpaFallback  string
+	tlsCertFile        string
+	tlsKeyFile         string
+	tlsSelfSigned      bool
+	tlsDir             string
+	redirectPort       uint16
+	tlsClientCaFile    string
+	clientCertPaths    []string
+	clientCertRole     string
+	dbPath             string
+	sessionTtl         time.Duration
+	shutdownDelay      time.Duration
+	drainTimeout       time.Duration
+	oidcIssuer         string
+	oidcClientId       string
+	oidcSecretFile     string
+	oidcRedirectUrl    string
+	oidcUsernameClaim  string
+	oidcRoleClaim      string
+	oidcRoles          []string
+	rateLimit          float64
+	rateBurst          int
+	maxInFlight        int
+	trustedProxies     []*net.IPNet
+	csp                string
+	cspReportOnly      bool
+	hstsMaxAge         time.Duration
+	corsPolicies       cors.Policies
+	traceExport        string
+	logLevels          map[string]logger.Level
+	logBuffer          int
+	logFile            string
+	logRotation        logger.Rotation
+	accessLogRotation  logger.Rotation // only rotated when a --log-* rotation option is given
+	logFiles           []*logger.RotatingFile
+	logSink            logger.SinkAddress
+	sink               logger.Sink
+	accessLog          string
+	accessLogFormat    logger.AccessFormat
+	accessLogExclude   []string
+	accessLogDest      io.Writer
+	command            []string
 	clock              system.Clock
 	db                 *database.Db
+	oidcClient         *oidc.Client
+	oidcRoleMap        oidc.RoleMap
+	tracer             *tracing.Tracer
 }
 
 var instance *Config
 
+// DefaultCsp only allows the server's own assets, plus inline scripts & styles carrying the page's nonce
+const DefaultCsp = "default-src 'self'; script-src 'self' 'nonce-{nonce}'; style-src 'self' 'nonce-{nonce}'; " +
+	"img-src 'self' data:; object-src 'none'; base-uri 'none'; form-action 'self'; frame-ancestors 'none'; " +
+	"report-uri /csp-report"
+
 func defaults() *Config {
 	return &Config{
-		progname:   "mingo",
-		startUtc:   system.NewClock()().UTC(),
-		listenPort: 8080,
-		clock:      system.NewClock(),
+		progname:          "mingo",
+		startUtc:          system.NewClock()().UTC(),
+		listenPort:        8080,
+		staticIndexFiles:  []string{"index.html"},
+		tlsDir:            "tls",
+		clientCertPaths:   []string{"/api/"},
+		clientCertRole:    "viewer",
+		dbPath:            "my.db",
+		sessionTtl:        12 * time.Hour,
+		drainTimeout:      5 * time.Second,
+		oidcUsernameClaim: "preferred_username",
+		oidcRoleClaim:     "groups",
+		rateLimit:         20,
+		rateBurst:         40,
+		maxInFlight:       256,
+		csp:               DefaultCsp,
+		hstsMaxAge:        365 * 24 * time.Hour,
+		logBuffer:         1000,
+		logRotation:       logger.Rotation{MaxSize: 100 << 20, Keep: 7},
+		accessLogFormat:   logger.AccessMingo,
+		clock:             system.NewClock(),
 	}
 }
 
@@ -53,13 +133,81 @@ func Build(args []string, stderr io.Writer) (err error) {
 	}
 	cfg.hostname = hostname
 
-	cfg.loggingDestination = stderr
+	if dir, err := system.ConfigDir(); err == nil {
+		cfg.tlsDir = filepath.Join(dir, "mingo", "tls")
+	}
 
-	cfg.db = database.NewRealDatabase()
+	cfg.loggingDestination = stderr
 
 	instance, err = parseFlags(cfg)
+	if err != nil {
+		return err
+	}
+
+	logger.SetLevels(cfg.logLevels)
+	if cfg.logBuffer > 0 {
+		logger.SetRecent(logger.NewRing(cfg.logBuffer))
+	}
+	if cfg.logFile != "" {
+		f, err := logger.NewRotatingFile(cfg.logFile, cfg.logRotation, cfg.clock, stderr)
+		if err != nil {
+			fmt.Fprintf(stderr, "--log-file: %v\n", err)
+			return err
+		}
+		cfg.logFiles = append(cfg.logFiles, f)
+		cfg.loggingDestination = f
+	}
+	if cfg.logSink.Protocol != "" { // validate refuses it with --log-file, neither replaces the other
+		sink, err := logger.OpenSink(cfg.logSink, cfg.clock, cfg.hostname, stderr)
+		if err != nil {
+			fmt.Fprintf(stderr, "--log-sink: %v\n", err)
+			return err
+		}
+		cfg.sink = sink
+		cfg.loggingDestination = sink
+	}
+	cfg.accessLogDest = cfg.loggingDestination
+	if cfg.accessLog != "" {
+		f, err := logger.NewRotatingFile(cfg.accessLog, cfg.accessLogRotation, cfg.clock, stderr)
+		if err != nil {
+			fmt.Fprintf(stderr, "--access-log: %v\n", err)
+			return err
+		}
+		cfg.logFiles = append(cfg.logFiles, f)
+		cfg.accessLogDest = f
+	}
 
-	return err
+	cfg.db = database.NewRealDatabase(cfg.dbPath)
+	cfg.db.SetLogger(logger.NewComponentLogger(cfg.clock, cfg.loggingDestination, cfg.hostname, "sql"))
+
+	if cfg.oidcIssuer != "" {
+		secret := ""
+		if cfg.oidcSecretFile != "" {
+			b, err := ioutil.ReadFile(cfg.oidcSecretFile)
+			if err != nil {
+				fmt.Fprintf(stderr, "--oidc-client-secret-file: %v\n", err)
+				return err
+			}
+			secret = strings.TrimSpace(string(b))
+		}
+		cfg.oidcClient = oidc.NewClient(cfg.oidcIssuer, cfg.oidcClientId, secret, nil, cfg.clock)
+		cfg.oidcRoleMap, _ = oidc.ParseRoleMap(cfg.oidcRoleClaim, cfg.oidcRoles) // already validated
+	}
+
+	var exporter tracing.Exporter
+	if strings.HasPrefix(cfg.traceExport, "http://") || strings.HasPrefix(cfg.traceExport, "https://") {
+		exporter = tracing.NewHttpExporter(cfg.traceExport, &http.Client{Timeout: 10 * time.Second})
+	} else if cfg.traceExport != "" {
+		f, err := os.OpenFile(cfg.traceExport, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			fmt.Fprintf(stderr, "--trace-export: %v\n", err)
+			return err
+		}
+		exporter = tracing.NewFileExporter(f)
+	}
+	cfg.tracer = tracing.NewTracer(cfg.clock, cfg.progname, exporter, logger.NewComponentLogger(cfg.clock, cfg.loggingDestination, cfg.hostname, "tracing"))
+
+	return nil
 }
 
 func GetInstance() *Config {
@@ -74,6 +222,30 @@ func (c *Config) GetLoggingDestination() io.Writer {
 	return c.loggingDestination
 }
 
+// GetLogFiles are the --log-file & --access-log files, to be reopened on SIGUSR1 and closed on exit
+func (c *Config) GetLogFiles() []*logger.RotatingFile {
+	return c.logFiles
+}
+
+// GetLogSink is the --log-sink collector, nil when logging to stderr or a file
+func (c *Config) GetLogSink() logger.Sink {
+	return c.sink
+}
+
+// GetAccessLogDestination is the --access-log file, or the logging destination when it's not set
+func (c *Config) GetAccessLogDestination() io.Writer {
+	return c.accessLogDest
+}
+
+func (c *Config) GetAccessLogFormat() logger.AccessFormat {
+	return c.accessLogFormat
+}
+
+// GetAccessLogExclude lists URL path prefixes whose requests go unlogged, e.g. /health
+func (c *Config) GetAccessLogExclude() []string {
+	return c.accessLogExclude
+}
+
 func (c *Config) GetClock() system.Clock {
 	return c.clock
 }
@@ -86,6 +258,18 @@ func (c *Config) GetStaticDir() string {
 	return c.staticDir
 }
 
+func (c *Config) GetStaticIndexFiles() []string {
+	return c.staticIndexFiles
+}
+
+func (c *Config) GetStaticDirListing() bool {
+	return c.staticDirListing
+}
+
+func (c *Config) GetStaticSpaFallback() string {
+	return c.staticSpaFallback
+}
+
 func (c *Config) GetListenPort() uint16 {
 	return c.listenPort
 }
@@ -94,6 +278,49 @@ func (c *Config) GetListenPortStr() string {
 	return strconv.Itoa(int(c.listenPort))
 }
 
+func (c *Config) GetTlsCertFile() string {
+	return c.tlsCertFile
+}
+
+func (c *Config) GetTlsKeyFile() string {
+	return c.tlsKeyFile
+}
+
+func (c *Config) GetTlsSelfSigned() bool {
+	return c.tlsSelfSigned
+}
+
+func (c *Config) GetTlsDir() string {
+	return c.tlsDir
+}
+
+// IsTlsEnabled is true when the server should speak HTTPS rather than plain HTTP
+func (c *Config) IsTlsEnabled() bool {
+	return c.tlsSelfSigned || c.tlsCertFile != ""
+}
+
+func (c *Config) GetTlsClientCaFile() string {
+	return c.tlsClientCaFile
+}
+
+// GetClientCertPaths lists the URL path prefixes that require a client certificate when --tls-client-ca is set
+func (c *Config) GetClientCertPaths() []string {
+	return c.clientCertPaths
+}
+
+// GetClientCertRole is the role granted to callers authenticated by a client certificate alone
+func (c *Config) GetClientCertRole() string {
+	return c.clientCertRole
+}
+
+func (c *Config) GetRedirectPort() uint16 {
+	return c.redirectPort
+}
+
+func (c *Config) GetRedirectPortStr() string {
+	return strconv.Itoa(int(c.redirectPort))
+}
+
 func (c *Config) GetProgname() string {
 	return c.progname
 }
@@ -105,3 +332,90 @@ func (c *Config) GetUsername() string {
 func (c *Config) GetDatabase() *database.Db {
 	return c.db
 }
+
+func (c *Config) GetDatabasePath() string {
+	return c.dbPath
+}
+
+func (c *Config) GetSessionTtl() time.Duration {
+	return c.sessionTtl
+}
+
+// GetShutdownDelay is how long to carry on serving after a stop signal, while /ready reports 503
+func (c *Config) GetShutdownDelay() time.Duration {
+	return c.shutdownDelay
+}
+
+// GetDrainTimeout is how long in-flight requests get to finish once the servers stop accepting new ones
+func (c *Config) GetDrainTimeout() time.Duration {
+	return c.drainTimeout
+}
+
+// GetOidcClient is the single sign-on provider, nil when --oidc-issuer isn't set
+func (c *Config) GetOidcClient() *oidc.Client {
+	return c.oidcClient
+}
+
+// GetOidcRedirectUrl is the callback URL registered with the provider, empty to derive it from the request
+func (c *Config) GetOidcRedirectUrl() string {
+	return c.oidcRedirectUrl
+}
+
+// GetOidcUsernameClaim names the ID token claim that becomes a new user's username
+func (c *Config) GetOidcUsernameClaim() string {
+	return c.oidcUsernameClaim
+}
+
+func (c *Config) GetOidcRoleMap() oidc.RoleMap {
+	return c.oidcRoleMap
+}
+
+// GetRateLimit is each client's sustained requests per second, 0 for no limit
+func (c *Config) GetRateLimit() float64 {
+	return c.rateLimit
+}
+
+// GetRateBurst is how many requests a client may make at once before the rate limit applies
+func (c *Config) GetRateBurst() int {
+	return c.rateBurst
+}
+
+// GetMaxInFlight is the number of concurrent requests beyond which the server sheds load, 0 for no limit
+func (c *Config) GetMaxInFlight() int {
+	return c.maxInFlight
+}
+
+// GetTrustedProxies are the reverse proxies whose X-Forwarded-For, -Proto & -Host headers are believed
+func (c *Config) GetTrustedProxies() []*net.IPNet {
+	return c.trustedProxies
+}
+
+// GetCsp is the Content-Security-Policy with {nonce} placeholders, empty to send none
+func (c *Config) GetCsp() string {
+	return c.csp
+}
+
+// IsCspReportOnly is true when violations should only be reported, not blocked
+func (c *Config) IsCspReportOnly() bool {
+	return c.cspReportOnly
+}
+
+// GetHstsMaxAge is how long browsers should insist on HTTPS, sent over HTTPS only, 0 for no HSTS
+func (c *Config) GetHstsMaxAge() time.Duration {
+	return c.hstsMaxAge
+}
+
+// GetCorsPolicies are the URL path prefixes other origins may call from a browser
+func (c *Config) GetCorsPolicies() cors.Policies {
+	return c.corsPolicies
+}
+
+// GetTracer starts request spans, it exports them only when --trace-export is set
+func (c *Config) GetTracer() *tracing.Tracer {
+	return c.tracer
+}
+
+// GetCommand returns the arguments after the options, e.g. ["user", "add", "alice"], empty to run the server
+func (c *Config) GetCommand() []string {
+	return c.command
+}
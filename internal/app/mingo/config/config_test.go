@@ -21,6 +21,18 @@ func TestDefaults(t *testing.T) {
 		t.Errorf("staticDir want \"\", got %s", conf.staticDir)
 	}
 
+	if len(conf.staticIndexFiles) != 1 || conf.staticIndexFiles[0] != "index.html" {
+		t.Errorf("staticIndexFiles want [index.html], got %q", conf.staticIndexFiles)
+	}
+
+	if conf.staticDirListing {
+		t.Error("staticDirListing want false, got true")
+	}
+
+	if len(conf.clientCertPaths) != 1 || conf.clientCertPaths[0] != "/api/" {
+		t.Errorf("clientCertPaths want [/api/], got %q", conf.clientCertPaths)
+	}
+
 	if conf != GetInstance() {
 		t.Error("GetInstance not singleton")
 	}
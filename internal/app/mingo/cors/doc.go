@@ -0,0 +1,3 @@
+// Package cors describes which other origins may call a URL path prefix from a browser, parsed
+// from --cors specs, e.g. "/api/ origins=https://*.example.com methods=GET,POST credentials=true"
+package cors
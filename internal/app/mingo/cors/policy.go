@@ -0,0 +1,177 @@
+package cors
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy lets browsers on the listed origins call URLs under Prefix
+type Policy struct {
+	Prefix      string
+	Origins     []string // "*" for any, or scheme://host[:port] where the host may start with "*."
+	Methods     []string
+	Headers     []string // request headers the caller may send beyond the CORS-safelisted ones
+	Expose      []string // response headers the caller's script may read
+	Credentials bool     // whether cookies & client certificates go along
+	MaxAge      time.Duration
+}
+
+// Parse reads "<prefix> origins=<list> [methods=<list>] [headers=<list>] [expose=<list>] [credentials[=true]] [max-age=<duration>]"
+// where lists are comma separated, methods default to GET,HEAD,POST and headers to Content-Type
+func Parse(spec string) (Policy, error) {
+	fields := strings.Fields(spec)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return Policy{}, fmt.Errorf("%q should start with a URL path prefix", spec)
+	}
+	p := Policy{Prefix: fields[0], Methods: []string{"GET", "HEAD", "POST"}, Headers: []string{"Content-Type"}}
+
+	for _, field := range fields[1:] {
+		key, value, hasValue := strings.Cut(field, "=")
+		if key == "credentials" {
+			credentials, err := strconv.ParseBool(value)
+			if !hasValue {
+				credentials, err = true, nil
+			}
+			if err != nil {
+				return p, fmt.Errorf("%q in %q, want credentials=true or false", field, spec)
+			}
+			p.Credentials = credentials
+			continue
+		}
+		if !hasValue || value == "" {
+			return p, fmt.Errorf("%q in %q, want <key>=<value>", field, spec)
+		}
+		list := strings.Split(value, ",")
+		switch key {
+		case "origins":
+			p.Origins = nil
+			for _, origin := range list {
+				origin = strings.ToLower(origin)
+				if err := checkOrigin(origin); err != nil {
+					return p, err
+				}
+				p.Origins = append(p.Origins, origin)
+			}
+		case "methods":
+			p.Methods = nil
+			for _, method := range list {
+				p.Methods = append(p.Methods, strings.ToUpper(method))
+			}
+		case "headers":
+			p.Headers = canonicalHeaders(list)
+		case "expose":
+			p.Expose = canonicalHeaders(list)
+		case "max-age":
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 0 {
+				return p, fmt.Errorf("max-age %q should be a duration like 10m", value)
+			}
+			p.MaxAge = d
+		default:
+			return p, fmt.Errorf("unknown CORS setting %q in %q", key, spec)
+		}
+	}
+
+	if len(p.Origins) == 0 {
+		return p, fmt.Errorf("%q needs origins=<list>", spec)
+	}
+	if p.Credentials && p.AllowsAnyOrigin() {
+		return p, fmt.Errorf("%q can't send credentials to any origin, list them", spec)
+	}
+	return p, nil
+}
+
+func checkOrigin(origin string) error {
+	if origin == "*" {
+		return nil
+	}
+	u, err := url.Parse(strings.Replace(origin, "://*.", "://wildcard.", 1))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" || u.User != nil {
+		return fmt.Errorf("origin %q, want * or scheme://host[:port] e.g. https://*.example.com", origin)
+	}
+	return nil
+}
+
+func canonicalHeaders(names []string) []string {
+	var canonical []string
+	for _, name := range names {
+		canonical = append(canonical, http.CanonicalHeaderKey(name))
+	}
+	return canonical
+}
+
+// AllowsAnyOrigin is true for a policy with the "*" origin
+func (p Policy) AllowsAnyOrigin() bool {
+	for _, o := range p.Origins {
+		if o == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsOrigin compares an Origin request header with the policy's origins, "*." matches one or more subdomains
+func (p Policy) AllowsOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	if origin == "" || origin == "null" {
+		return false
+	}
+	for _, o := range p.Origins {
+		if o == "*" || o == origin {
+			return true
+		}
+		if before, after, ok := strings.Cut(o, "://*."); ok && strings.HasPrefix(origin, before+"://") && strings.HasSuffix(origin, "."+after) {
+			sub := strings.TrimSuffix(strings.TrimPrefix(origin, before+"://"), "."+after)
+			if sub != "" && !strings.ContainsAny(sub, "/:@") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p Policy) AllowsMethod(method string) bool {
+	for _, m := range p.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsHeaders checks an Access-Control-Request-Headers list against the policy's headers
+func (p Policy) AllowsHeaders(requested string) bool {
+	for _, name := range strings.Split(requested, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		allowed := false
+		for _, h := range p.Headers {
+			if strings.EqualFold(h, name) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// Policies are searched longest prefix first, so /api/admin/ can be stricter than /api/
+type Policies []Policy
+
+func (ps Policies) For(path string) (Policy, bool) {
+	best, found := Policy{}, false
+	for _, p := range ps {
+		if strings.HasPrefix(path, p.Prefix) && (!found || len(p.Prefix) > len(best.Prefix)) {
+			best, found = p, true
+		}
+	}
+	return best, found
+}
@@ -0,0 +1,114 @@
+package cors
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	p, err := Parse("/api/ origins=https://app.example.com,https://*.Example.org methods=get,PUT headers=content-type,x-csrf-token expose=location credentials max-age=10m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Policy{
+		Prefix:      "/api/",
+		Origins:     []string{"https://app.example.com", "https://*.example.org"},
+		Methods:     []string{"GET", "PUT"},
+		Headers:     []string{"Content-Type", "X-Csrf-Token"},
+		Expose:      []string{"Location"},
+		Credentials: true,
+		MaxAge:      10 * time.Minute,
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("got %+v, want %+v", p, want)
+	}
+
+	p, err = Parse("/ origins=*")
+	if err != nil || !reflect.DeepEqual(p.Methods, []string{"GET", "HEAD", "POST"}) || !reflect.DeepEqual(p.Headers, []string{"Content-Type"}) {
+		t.Errorf("defaults got %+v, %v", p, err)
+	}
+
+	for spec, want := range map[string]bool{
+		"/api/ origins=https://app.example.com credentials=true":  true,
+		"/api/ origins=https://app.example.com credentials=false": false,
+		"/api/ origins=* credentials=false":                       false,
+	} {
+		if p, err := Parse(spec); err != nil || p.Credentials != want {
+			t.Errorf("%q credentials got %v, %v, want %v", spec, p.Credentials, err, want)
+		}
+	}
+
+	for _, spec := range []string{
+		"",
+		"api origins=*",
+		"/api/",
+		"/api/ methods=GET",
+		"/api/ origins=",
+		"/api/ origins=app.example.com",
+		"/api/ origins=https://app.example.com/path",
+		"/api/ origins=ftp://app.example.com",
+		"/api/ origins=* credentials",
+		"/api/ origins=* credentials=true",
+		"/api/ origins=https://app.example.com,* credentials",
+		"/api/ origins=https://app.example.com credentials=yes",
+		"/api/ origins=https://app.example.com credentials=",
+		"/api/ origins=* max-age=soon",
+		"/api/ origins=* colour=blue",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("%q parsed", spec)
+		}
+	}
+}
+
+func TestAllowsOrigin(t *testing.T) {
+	p := Policy{Origins: []string{"https://app.example.com", "https://*.example.org", "http://localhost:3000"}}
+	var tests = []struct {
+		origin string
+		want   bool
+	}{
+		{"https://app.example.com", true},
+		{"HTTPS://APP.EXAMPLE.COM", true},
+		{"http://app.example.com", false},
+		{"https://app.example.com:8443", false},
+		{"https://evil.example.com", false},
+		{"https://a.example.org", true},
+		{"https://a.b.example.org", true},
+		{"https://example.org", false},
+		{"https://evilexample.org", false},
+		{"https://a.example.org:444", false},
+		{"http://localhost:3000", true},
+		{"http://localhost", false},
+		{"null", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := p.AllowsOrigin(tt.origin); got != tt.want {
+			t.Errorf("%q got %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+
+	if !(Policy{Origins: []string{"*"}}).AllowsOrigin("https://anywhere.test") {
+		t.Error("* didn't allow any origin")
+	}
+}
+
+func TestAllowsHeaders(t *testing.T) {
+	p := Policy{Headers: []string{"Content-Type", "Authorization"}}
+	for requested, want := range map[string]bool{"": true, "content-type": true, "content-type, authorization": true, "content-type,x-other": false} {
+		if got := p.AllowsHeaders(requested); got != want {
+			t.Errorf("%q got %v, want %v", requested, got, want)
+		}
+	}
+}
+
+func TestPoliciesFor(t *testing.T) {
+	ps := Policies{{Prefix: "/api/"}, {Prefix: "/api/admin/"}, {Prefix: "/static/"}}
+	for path, want := range map[string]string{"/api/people": "/api/", "/api/admin/x": "/api/admin/", "/crud": ""} {
+		p, ok := ps.For(path)
+		if ok != (want != "") || p.Prefix != want {
+			t.Errorf("%s got %q, %v", path, p.Prefix, ok)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package database
+
+import "fmt"
+
+// Schema changes, applied in order and exactly once. Never edit a released migration, append a new one
+// The schema version is tracked in sqlite's user_version pragma
+var migrations = []string{
+	// 1: the original database/crud.sql
+	`CREATE TABLE IF NOT EXISTS Person (Id INTEGER PRIMARY KEY, Name TEXT, Location TEXT);`,
+
+	// 2: user accounts & login sessions
+	`CREATE TABLE User (
+		Id INTEGER PRIMARY KEY,
+		Username TEXT NOT NULL UNIQUE COLLATE NOCASE,
+		PasswordHash TEXT NOT NULL,
+		Disabled INTEGER NOT NULL DEFAULT 0,
+		CreatedAt INTEGER NOT NULL
+	);
+	CREATE TABLE Session (
+		IdHash TEXT PRIMARY KEY,
+		UserId INTEGER NOT NULL REFERENCES User(Id) ON DELETE CASCADE,
+		CreatedAt INTEGER NOT NULL,
+		ExpiresAt INTEGER NOT NULL
+	);
+	CREATE INDEX Session_UserId ON Session(UserId);`,
+
+	// 3: API tokens, timestamps of 0 mean never
+	`CREATE TABLE ApiToken (
+		Id TEXT PRIMARY KEY,
+		UserId INTEGER NOT NULL REFERENCES User(Id) ON DELETE CASCADE,
+		Name TEXT NOT NULL,
+		SecretHash TEXT NOT NULL,
+		Scopes TEXT NOT NULL,
+		CreatedAt INTEGER NOT NULL,
+		ExpiresAt INTEGER NOT NULL DEFAULT 0,
+		LastUsedAt INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX ApiToken_UserId ON ApiToken(UserId);`,
+
+	// 4: roles, users from before roles existed could do everything so they become admins
+	`ALTER TABLE User ADD COLUMN Role TEXT NOT NULL DEFAULT 'viewer';
+	UPDATE User SET Role = 'admin';`,
+
+	// 5: single sign-on users are linked to their provider's subject, they have an empty PasswordHash
+	`ALTER TABLE User ADD COLUMN OidcSubject TEXT;
+	CREATE UNIQUE INDEX User_OidcSubject ON User(OidcSubject);`,
+}
+
+// Migrate brings the schema up to date, each migration runs in its own transaction
+func (db *Db) Migrate() error {
+	var version int
+	if err := db.DB.QueryRow(`PRAGMA user_version;`).Scan(&version); err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than this binary supports (%d)", version, len(migrations))
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.DB.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d;`, i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// SchemaVersion is the number of migrations applied
+func (db *Db) SchemaVersion() (int, error) {
+	var version int
+	err := db.DB.QueryRow(`PRAGMA user_version;`).Scan(&version)
+	return version, err
+}
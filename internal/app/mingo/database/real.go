@@ -1,81 +1,148 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"io"
+	"log"
+	"time"
 
 	"github.com/craigjperry2/mingo/internal/app/mingo"
+	"github.com/craigjperry2/mingo/internal/app/mingo/errors"
+	"github.com/craigjperry2/mingo/internal/app/mingo/logger"
+	"github.com/craigjperry2/mingo/internal/app/mingo/tracing"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// Statements taking longer than this are logged even when they succeed
+const slowStatement = 250 * time.Millisecond
+
 // Fake DB access layer for this iteration
 type Db struct {
 	*sql.DB
+	log *log.Logger
 }
 
-func NewRealDatabase() *Db {
-	db, err := sql.Open("sqlite3", "/Users/craig/Code/github.com/craigjperry2/mingo/my.db")
+func NewRealDatabase(path string) *Db {
+	db, err := sql.Open("sqlite3", path+"?_foreign_keys=on&_busy_timeout=5000")
 	if err != nil {
-		panic("Couldn't open my.db")
+		panic("Couldn't open " + path)
+	}
+	if path == ":memory:" {
+		db.SetMaxOpenConns(1) // each connection would otherwise get its own empty database
 	}
-	return &Db{db}
+	return &Db{db, log.New(io.Discard, "", 0)}
+}
+
+// SetLogger receives failed and slow statements, by default they go unlogged
+func (db *Db) SetLogger(l *log.Logger) {
+	db.log = l
+}
+
+func (db *Db) Close() error {
+	return db.DB.Close()
 }
 
-func (db *Db) Close()  {
-	db.DB.Close()
+// Every statement runs under observe: it gets a span beneath the request's, and a log line naming the
+// request when it fails or is slow. Call the returned func with the statement's outcome
+func (db *Db) observe(ctx context.Context, operation string, statement string) (context.Context, func(error)) {
+	ctx, span := tracing.Start(ctx, tracing.KindClient, "sqlite "+operation)
+	span.SetAttribute("db.system", "sqlite")
+	span.SetAttribute("db.statement", statement)
+	start := time.Now()
+	return ctx, func(err error) {
+		elapsed := time.Since(start)
+		if err != nil && err != sql.ErrNoRows && err != errors.ErrNotFound && err != errors.ErrDuplicate {
+			span.SetError(err)
+			logger.Errorf(logger.Scoped(ctx, db.log), "%s failed after %v: %v\n", operation, elapsed, err)
+		} else if elapsed >= slowStatement {
+			logger.Warnf(logger.Scoped(ctx, db.log), "%s was slow, %v\n", operation, elapsed)
+		} else {
+			logger.Debugf(logger.Scoped(ctx, db.log), "%s took %v\n", operation, elapsed)
+		}
+		span.End()
+	}
 }
 
-func (db *Db) GetAll(offset int, limit int) ([]mingo.Person, error) {
+func (db *Db) GetAll(ctx context.Context, offset int, limit int) (result []mingo.Person, err error) {
 	// Because of my HTMX UI impl, i can't get away with simple offset/limit pagination, so using cursor style instead
-	var result []mingo.Person
-	if rows, err := db.DB.Query(`select * from Person where Id > (?) limit (?);`, offset, limit); err != nil {
-		panic(err)
-	} else {
-		for rows.Next() {
-			var p mingo.Person
-			err := rows.Scan(&p.Id, &p.Name, &p.Location)
-			if err != nil {
-				panic(err)
-			}
-			result = append(result, p)
+	const query = `select * from Person where Id > (?) limit (?);`
+	ctx, done := db.observe(ctx, "GetAll", query)
+	defer func() { done(err) }()
+
+	rows, err := db.DB.QueryContext(ctx, query, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p mingo.Person
+		if err := rows.Scan(&p.Id, &p.Name, &p.Location); err != nil {
+			return nil, err
 		}
+		result = append(result, p)
 	}
-	return result, nil
+	return result, rows.Err()
 }
 
-func (db *Db) Get(id int) (mingo.Person, error) {
-	var result mingo.Person
-	if err := db.DB.QueryRow(`select * from Person where Id = (?);`, id).Scan(&result.Id, &result.Name, &result.Location); err != nil {
-		panic(err)
+func (db *Db) Get(ctx context.Context, id int) (result mingo.Person, err error) {
+	const query = `select * from Person where Id = (?);`
+	ctx, done := db.observe(ctx, "Get", query)
+	defer func() { done(err) }()
+
+	err = db.DB.QueryRowContext(ctx, query, id).Scan(&result.Id, &result.Name, &result.Location)
+	if err == sql.ErrNoRows {
+		return result, errors.ErrNotFound
 	}
-	return result, nil
+	return result, err
 }
 
-func (db *Db) Update(id int, name string, location string) (mingo.Person, error) {
-	p := mingo.Person{id, name, location}
-	if _, err := db.Exec(`UPDATE Person SET name = (?), location = (?) WHERE id = (?);`, name, location, id); err != nil {
-		panic(err)
+func (db *Db) Update(ctx context.Context, id int, name string, location string) (p mingo.Person, err error) {
+	const query = `UPDATE Person SET name = (?), location = (?) WHERE id = (?);`
+	ctx, done := db.observe(ctx, "Update", query)
+	defer func() { done(err) }()
+
+	result, err := db.ExecContext(ctx, query, name, location, id)
+	if err != nil {
+		return p, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return p, err
+	} else if n == 0 {
+		return p, errors.ErrNotFound
 	}
-	return p, nil
+	return mingo.Person{Id: id, Name: name, Location: location}, nil
 }
 
-func (db *Db) Insert(name string, location string) (mingo.Person, error) {
-	var p mingo.Person
-	if result, err := db.Exec(`INSERT INTO Person (name, location) VALUES ((?), (?)) RETURNING id;`, name, location); err != nil {
-		panic(err)
-	} else {
-		id, err := result.LastInsertId()
-		if err != nil {
-			panic(err)
-		}
-		p = mingo.Person{int(id), name, location}
+func (db *Db) Insert(ctx context.Context, name string, location string) (p mingo.Person, err error) {
+	const query = `INSERT INTO Person (name, location) VALUES ((?), (?)) RETURNING id;`
+	ctx, done := db.observe(ctx, "Insert", query)
+	defer func() { done(err) }()
+
+	result, err := db.ExecContext(ctx, query, name, location)
+	if err != nil {
+		return p, err
 	}
-	return p, nil
+	id, err := result.LastInsertId()
+	if err != nil {
+		return p, err
+	}
+	return mingo.Person{Id: int(id), Name: name, Location: location}, nil
 }
 
-func (db *Db) Delete(id int) (mingo.Person, error) {
-	var old mingo.Person
-	if _, err := db.Exec(`DELETE FROM Person WHERE id = (?);`, id); err != nil {
-		panic(err)
+func (db *Db) Delete(ctx context.Context, id int) (old mingo.Person, err error) {
+	const query = `DELETE FROM Person WHERE id = (?);`
+	ctx, done := db.observe(ctx, "Delete", query)
+	defer func() { done(err) }()
+
+	result, err := db.ExecContext(ctx, query, id)
+	if err != nil {
+		return old, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return old, err
+	} else if n == 0 {
+		return old, errors.ErrNotFound
 	}
 	return old, nil
 }
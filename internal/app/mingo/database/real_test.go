@@ -0,0 +1,65 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/errors"
+	"github.com/craigjperry2/mingo/internal/app/mingo/logger"
+)
+
+func TestPeople(t *testing.T) {
+	ctx := context.Background()
+	db := newMigratedDatabase(t)
+
+	p, err := db.Insert(ctx, "Ada", "London")
+	if err != nil {
+		t.Fatalf("insert err want nil, got %v", err)
+	}
+	if got, err := db.Get(ctx, p.Id); err != nil || got != p {
+		t.Errorf("get got %v, %v, want %v", got, err, p)
+	}
+	if _, err := db.Delete(ctx, p.Id); err != nil {
+		t.Fatalf("delete err want nil, got %v", err)
+	}
+	if _, err := db.Get(ctx, p.Id); err != errors.ErrNotFound {
+		t.Errorf("get of deleted err got %v, want ErrNotFound", err)
+	}
+	if _, err := db.Update(ctx, p.Id, "Ada", "Paris"); err != errors.ErrNotFound {
+		t.Errorf("update of deleted err got %v, want ErrNotFound", err)
+	}
+	if _, err := db.Delete(ctx, p.Id); err != errors.ErrNotFound {
+		t.Errorf("delete of deleted err got %v, want ErrNotFound", err)
+	}
+}
+
+func TestCancelledStatementsFailAndAreLogged(t *testing.T) {
+	var logged bytes.Buffer
+	db := newMigratedDatabase(t)
+	db.SetLogger(log.New(&logged, "", 0))
+
+	ctx, cancel := context.WithCancel(logger.WithRequestId(context.Background(), "req-42"))
+	cancel()
+	if _, err := db.GetAll(ctx, 0, 10); err == nil {
+		t.Fatal("get all on a cancelled context want err, got nil")
+	}
+	if line := logged.String(); !strings.HasPrefix(line, "req-42 GetAll failed after") {
+		t.Errorf("log got %q, want the request id and operation", line)
+	}
+}
+
+func TestNotFoundIsNotLogged(t *testing.T) {
+	var logged bytes.Buffer
+	db := newMigratedDatabase(t)
+	db.SetLogger(log.New(&logged, "", 0))
+
+	if _, err := db.Get(context.Background(), 12345); err != errors.ErrNotFound {
+		t.Fatalf("get err got %v, want ErrNotFound", err)
+	}
+	if logged.Len() != 0 {
+		t.Errorf("log got %q, want nothing", logged.String())
+	}
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo"
+	"github.com/craigjperry2/mingo/internal/app/mingo/errors"
+)
+
+func (db *Db) InsertSession(ctx context.Context, idHash string, userId int, now time.Time, expires time.Time) (s mingo.Session, err error) {
+	const query = `INSERT INTO Session (IdHash, UserId, CreatedAt, ExpiresAt) VALUES ((?), (?), (?), (?));`
+	ctx, done := db.observe(ctx, "InsertSession", query)
+	defer func() { done(err) }()
+
+	if _, err := db.DB.ExecContext(ctx, query, idHash, userId, now.Unix(), expires.Unix()); err != nil {
+		return s, err
+	}
+	return mingo.Session{IdHash: idHash, UserId: userId, CreatedAt: time.Unix(now.Unix(), 0).UTC(), ExpiresAt: time.Unix(expires.Unix(), 0).UTC()}, nil
+}
+
+// GetSession returns the session along with the user it belongs to
+func (db *Db) GetSession(ctx context.Context, idHash string) (s mingo.Session, u mingo.User, err error) {
+	const query = `SELECT s.IdHash, s.UserId, s.CreatedAt, s.ExpiresAt, u.Id, u.Username, u.PasswordHash, u.Role, u.Disabled, u.CreatedAt
+		FROM Session s JOIN User u ON u.Id = s.UserId WHERE s.IdHash = (?);`
+	ctx, done := db.observe(ctx, "GetSession", query)
+	defer func() { done(err) }()
+
+	var sessionCreated, sessionExpires, userCreated int64
+	err = db.DB.QueryRowContext(ctx, query, idHash).
+		Scan(&s.IdHash, &s.UserId, &sessionCreated, &sessionExpires, &u.Id, &u.Username, &u.PasswordHash, &u.Role, &u.Disabled, &userCreated)
+	if err == sql.ErrNoRows {
+		return s, u, errors.ErrNotFound
+	} else if err != nil {
+		return s, u, err
+	}
+	s.CreatedAt = time.Unix(sessionCreated, 0).UTC()
+	s.ExpiresAt = time.Unix(sessionExpires, 0).UTC()
+	u.CreatedAt = time.Unix(userCreated, 0).UTC()
+	return s, u, nil
+}
+
+func (db *Db) DeleteSession(ctx context.Context, idHash string) (err error) {
+	const query = `DELETE FROM Session WHERE IdHash = (?);`
+	ctx, done := db.observe(ctx, "DeleteSession", query)
+	defer func() { done(err) }()
+
+	_, err = db.DB.ExecContext(ctx, query, idHash)
+	return err
+}
+
+func (db *Db) DeleteExpiredSessions(ctx context.Context, now time.Time) (n int64, err error) {
+	const query = `DELETE FROM Session WHERE ExpiresAt <= (?);`
+	ctx, done := db.observe(ctx, "DeleteExpiredSessions", query)
+	defer func() { done(err) }()
+
+	result, err := db.DB.ExecContext(ctx, query, now.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
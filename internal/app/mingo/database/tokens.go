@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo"
+	"github.com/craigjperry2/mingo/internal/app/mingo/errors"
+)
+
+const apiTokenColumns = `t.Id, t.UserId, t.Name, t.SecretHash, t.Scopes, t.CreatedAt, t.ExpiresAt, t.LastUsedAt`
+
+func (db *Db) InsertApiToken(ctx context.Context, t mingo.ApiToken) (err error) {
+	const query = `INSERT INTO ApiToken (Id, UserId, Name, SecretHash, Scopes, CreatedAt, ExpiresAt) VALUES ((?), (?), (?), (?), (?), (?), (?));`
+	ctx, done := db.observe(ctx, "InsertApiToken", query)
+	defer func() { done(err) }()
+
+	_, err = db.DB.ExecContext(ctx, query, t.Id, t.UserId, t.Name, t.SecretHash, strings.Join(t.Scopes, ","), unixOrZero(t.CreatedAt), unixOrZero(t.ExpiresAt))
+	return err
+}
+
+// GetApiToken returns the token along with the user it acts as
+func (db *Db) GetApiToken(ctx context.Context, id string) (t mingo.ApiToken, u mingo.User, err error) {
+	const query = `SELECT ` + apiTokenColumns + `, u.Id, u.Username, u.PasswordHash, u.Role, u.Disabled, u.CreatedAt
+		FROM ApiToken t JOIN User u ON u.Id = t.UserId WHERE t.Id = (?);`
+	ctx, done := db.observe(ctx, "GetApiToken", query)
+	defer func() { done(err) }()
+
+	var userCreated int64
+	t, err = scanApiToken(db.DB.QueryRowContext(ctx, query, id), &u.Id, &u.Username, &u.PasswordHash, &u.Role, &u.Disabled, &userCreated)
+	u.CreatedAt = time.Unix(userCreated, 0).UTC()
+	return t, u, err
+}
+
+// ListApiTokens returns a user's tokens, or everyone's for userId 0, newest first
+func (db *Db) ListApiTokens(ctx context.Context, userId int) (result []mingo.ApiToken, err error) {
+	const query = `SELECT ` + apiTokenColumns + ` FROM ApiToken t WHERE (?) = 0 OR t.UserId = (?) ORDER BY t.CreatedAt DESC, t.Id;`
+	ctx, done := db.observe(ctx, "ListApiTokens", query)
+	defer func() { done(err) }()
+
+	rows, err := db.DB.QueryContext(ctx, query, userId, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		t, err := scanApiToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, t)
+	}
+	return result, rows.Err()
+}
+
+// DeleteApiToken revokes a token, restricted to the user's own tokens unless userId is 0
+func (db *Db) DeleteApiToken(ctx context.Context, id string, userId int) (err error) {
+	const query = `DELETE FROM ApiToken WHERE Id = (?) AND ((?) = 0 OR UserId = (?));`
+	ctx, done := db.observe(ctx, "DeleteApiToken", query)
+	defer func() { done(err) }()
+
+	result, err := db.DB.ExecContext(ctx, query, id, userId, userId)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errors.ErrNotFound
+	}
+	return nil
+}
+
+// TouchApiToken records a use of the token, at most once a minute to spare the database a write per request
+func (db *Db) TouchApiToken(ctx context.Context, id string, now time.Time) (err error) {
+	const query = `UPDATE ApiToken SET LastUsedAt = (?) WHERE Id = (?) AND LastUsedAt < (?);`
+	ctx, done := db.observe(ctx, "TouchApiToken", query)
+	defer func() { done(err) }()
+
+	_, err = db.DB.ExecContext(ctx, query, now.Unix(), id, now.Add(-time.Minute).Unix())
+	return err
+}
+
+func scanApiToken(row scanner, extra ...interface{}) (mingo.ApiToken, error) {
+	var t mingo.ApiToken
+	var scopes string
+	var created, expires, lastUsed int64
+	dest := append([]interface{}{&t.Id, &t.UserId, &t.Name, &t.SecretHash, &scopes, &created, &expires, &lastUsed}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		if err == sql.ErrNoRows {
+			return t, errors.ErrNotFound
+		}
+		return t, err
+	}
+	t.Scopes = strings.Split(scopes, ",")
+	t.CreatedAt = timeOrZero(created)
+	t.ExpiresAt = timeOrZero(expires)
+	t.LastUsedAt = timeOrZero(lastUsed)
+	return t, nil
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func timeOrZero(unix int64) time.Time {
+	if unix == 0 {
+		return time.Time{}
+	}
+	return time.Unix(unix, 0).UTC()
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo"
+	"github.com/craigjperry2/mingo/internal/app/mingo/errors"
+)
+
+func TestApiTokens(t *testing.T) {
+	ctx := context.Background()
+	db := newMigratedDatabase(t)
+	now := time.Date(2022, 4, 30, 23, 59, 59, 0, time.UTC)
+	alice, _ := db.InsertUser(ctx, "alice", "hash", "editor", now)
+	bob, _ := db.InsertUser(ctx, "bob", "hash", "editor", now)
+
+	forever := mingo.ApiToken{Id: "0000000000000001", UserId: alice.Id, Name: "ci", SecretHash: "h1", Scopes: []string{"read"}, CreatedAt: now}
+	monthly := mingo.ApiToken{Id: "0000000000000002", UserId: bob.Id, Name: "export", SecretHash: "h2", Scopes: []string{"read", "write"}, CreatedAt: now.Add(time.Second), ExpiresAt: now.AddDate(0, 1, 0)}
+	for _, tok := range []mingo.ApiToken{forever, monthly} {
+		if err := db.InsertApiToken(ctx, tok); err != nil {
+			t.Fatalf("insert err want nil, got %v", err)
+		}
+	}
+
+	got, user, err := db.GetApiToken(ctx, monthly.Id)
+	if err != nil || !reflect.DeepEqual(got, monthly) || user.Username != "bob" {
+		t.Errorf("get got %+v for %s %v, want %+v for bob", got, user.Username, err, monthly)
+	}
+	if _, _, err := db.GetApiToken(ctx, "nope"); err != errors.ErrNotFound {
+		t.Errorf("get unknown err got %v, want %v", err, errors.ErrNotFound)
+	}
+
+	if all, _ := db.ListApiTokens(ctx, 0); len(all) != 2 || all[0].Id != monthly.Id {
+		t.Errorf("list all got %+v, want both, newest first", all)
+	}
+	if mine, _ := db.ListApiTokens(ctx, alice.Id); len(mine) != 1 || mine[0].Id != forever.Id {
+		t.Errorf("list alice's got %+v, want just %s", mine, forever.Id)
+	}
+
+	db.TouchApiToken(ctx, forever.Id, now.Add(time.Hour))
+	db.TouchApiToken(ctx, forever.Id, now.Add(time.Hour+time.Second)) // within the minute, not recorded
+	if got, _, _ := db.GetApiToken(ctx, forever.Id); !got.LastUsedAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("last used got %v, want %v", got.LastUsedAt, now.Add(time.Hour))
+	}
+
+	if err := db.DeleteApiToken(ctx, forever.Id, bob.Id); err != errors.ErrNotFound {
+		t.Errorf("delete someone else's token err got %v, want %v", err, errors.ErrNotFound)
+	}
+	if err := db.DeleteApiToken(ctx, forever.Id, alice.Id); err != nil {
+		t.Errorf("delete own token err got %v, want nil", err)
+	}
+	if err := db.DeleteApiToken(ctx, monthly.Id, 0); err != nil {
+		t.Errorf("delete any token err got %v, want nil", err)
+	}
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo"
+	"github.com/craigjperry2/mingo/internal/app/mingo/errors"
+)
+
+const userColumns = `Id, Username, PasswordHash, Role, Disabled, CreatedAt`
+
+func (db *Db) InsertUser(ctx context.Context, username string, passwordHash string, role string, now time.Time) (mingo.User, error) {
+	return db.insertUser(ctx, "InsertUser", username, passwordHash, role, nil, now)
+}
+
+// InsertOidcUser creates a user who can only log in through the OpenID provider, subject is "<issuer> <sub>"
+func (db *Db) InsertOidcUser(ctx context.Context, username string, subject string, role string, now time.Time) (mingo.User, error) {
+	return db.insertUser(ctx, "InsertOidcUser", username, "", role, subject, now)
+}
+
+func (db *Db) insertUser(ctx context.Context, operation string, username string, passwordHash string, role string, subject interface{}, now time.Time) (u mingo.User, err error) {
+	const query = `INSERT INTO User (Username, PasswordHash, Role, OidcSubject, CreatedAt) VALUES ((?), (?), (?), (?), (?));`
+	ctx, done := db.observe(ctx, operation, query)
+	defer func() { done(err) }()
+
+	result, err := db.DB.ExecContext(ctx, query, username, passwordHash, role, subject, now.Unix())
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return mingo.User{}, errors.ErrDuplicate
+		}
+		return mingo.User{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return mingo.User{}, err
+	}
+	return mingo.User{Id: int(id), Username: username, PasswordHash: passwordHash, Role: role, CreatedAt: time.Unix(now.Unix(), 0).UTC()}, nil
+}
+
+func (db *Db) GetUserByUsername(ctx context.Context, username string) (mingo.User, error) {
+	return db.getUser(ctx, "GetUserByUsername", `SELECT `+userColumns+` FROM User WHERE Username = (?);`, username)
+}
+
+func (db *Db) GetUserByOidcSubject(ctx context.Context, subject string) (mingo.User, error) {
+	return db.getUser(ctx, "GetUserByOidcSubject", `SELECT `+userColumns+` FROM User WHERE OidcSubject = (?);`, subject)
+}
+
+func (db *Db) GetUser(ctx context.Context, id int) (mingo.User, error) {
+	return db.getUser(ctx, "GetUser", `SELECT `+userColumns+` FROM User WHERE Id = (?);`, id)
+}
+
+func (db *Db) getUser(ctx context.Context, operation string, query string, key interface{}) (u mingo.User, err error) {
+	ctx, done := db.observe(ctx, operation, query)
+	defer func() { done(err) }()
+
+	return scanUser(db.DB.QueryRowContext(ctx, query, key))
+}
+
+func (db *Db) ListUsers(ctx context.Context) (result []mingo.User, err error) {
+	const query = `SELECT ` + userColumns + ` FROM User ORDER BY Username;`
+	ctx, done := db.observe(ctx, "ListUsers", query)
+	defer func() { done(err) }()
+
+	rows, err := db.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, u)
+	}
+	return result, rows.Err()
+}
+
+// SetUserPassword replaces the password hash and logs the user out everywhere
+func (db *Db) SetUserPassword(ctx context.Context, username string, passwordHash string) error {
+	return db.updateUserAndEndSessions(ctx, "SetUserPassword", `UPDATE User SET PasswordHash = (?) WHERE Username = (?);`, passwordHash, username)
+}
+
+// SetUserDisabled blocks (or unblocks) logins, disabling also ends the user's sessions
+func (db *Db) SetUserDisabled(ctx context.Context, username string, disabled bool) error {
+	return db.updateUserAndEndSessions(ctx, "SetUserDisabled", `UPDATE User SET Disabled = (?) WHERE Username = (?);`, disabled, username)
+}
+
+// SetUserRole changes what the user may do, their sessions end so nothing runs with a stale role
+func (db *Db) SetUserRole(ctx context.Context, username string, role string) error {
+	return db.updateUserAndEndSessions(ctx, "SetUserRole", `UPDATE User SET Role = (?) WHERE Username = (?);`, role, username)
+}
+
+func (db *Db) updateUserAndEndSessions(ctx context.Context, operation string, query string, value interface{}, username string) (err error) {
+	ctx, done := db.observe(ctx, operation, query)
+	defer func() { done(err) }()
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, value, username)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errors.ErrNotFound
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM Session WHERE UserId = (SELECT Id FROM User WHERE Username = (?));`, username); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row scanner) (mingo.User, error) {
+	var u mingo.User
+	var createdAt int64
+	if err := row.Scan(&u.Id, &u.Username, &u.PasswordHash, &u.Role, &u.Disabled, &createdAt); err != nil {
+		if err == sql.ErrNoRows {
+			return u, errors.ErrNotFound
+		}
+		return u, err
+	}
+	u.CreatedAt = time.Unix(createdAt, 0).UTC()
+	return u, nil
+}
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/errors"
+)
+
+func newMigratedDatabase(t *testing.T) *Db {
+	db := NewRealDatabase(":memory:")
+	t.Cleanup(func() { db.Close() })
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("migrate err want nil, got %v", err)
+	}
+	return db
+}
+
+func TestMigrateIsIdempotent(t *testing.T) {
+	db := newMigratedDatabase(t)
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("second migrate err want nil, got %v", err)
+	}
+	if version, _ := db.SchemaVersion(); version != len(migrations) {
+		t.Errorf("schema version got %d, want %d", version, len(migrations))
+	}
+	if _, err := db.DB.Exec(`PRAGMA user_version = 999;`); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrate(); err == nil {
+		t.Error("migrate of a newer schema want err, got nil")
+	}
+}
+
+func TestUsers(t *testing.T) {
+	ctx := context.Background()
+	db := newMigratedDatabase(t)
+	now := time.Date(2022, 4, 30, 23, 59, 59, 0, time.UTC)
+
+	alice, err := db.InsertUser(ctx, "alice", "hash1", "editor", now)
+	if err != nil {
+		t.Fatalf("insert err want nil, got %v", err)
+	}
+	if _, err := db.InsertUser(ctx, "ALICE", "hash2", "editor", now); err != errors.ErrDuplicate {
+		t.Errorf("insert duplicate err got %v, want %v", err, errors.ErrDuplicate)
+	}
+
+	got, err := db.GetUserByUsername(ctx, "Alice")
+	if err != nil || got != alice {
+		t.Errorf("get by username got %+v %v, want %+v", got, err, alice)
+	}
+	if _, err := db.GetUserByUsername(ctx, "bob"); err != errors.ErrNotFound {
+		t.Errorf("get unknown err got %v, want %v", err, errors.ErrNotFound)
+	}
+
+	if err := db.SetUserPassword(ctx, "alice", "hash3"); err != nil {
+		t.Errorf("set password err want nil, got %v", err)
+	}
+	if err := db.SetUserDisabled(ctx, "bob", true); err != errors.ErrNotFound {
+		t.Errorf("disable unknown err got %v, want %v", err, errors.ErrNotFound)
+	}
+	if err := db.SetUserDisabled(ctx, "alice", true); err != nil {
+		t.Errorf("disable err want nil, got %v", err)
+	}
+	got, _ = db.GetUser(ctx, alice.Id)
+	if got.PasswordHash != "hash3" || !got.Disabled {
+		t.Errorf("after updates got %+v, want hash3 and disabled", got)
+	}
+
+	all, err := db.ListUsers(ctx)
+	if err != nil || len(all) != 1 {
+		t.Errorf("list got %+v %v, want 1 user", all, err)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	ctx := context.Background()
+	db := newMigratedDatabase(t)
+	now := time.Date(2022, 4, 30, 23, 59, 59, 0, time.UTC)
+	alice, _ := db.InsertUser(ctx, "alice", "hash", "editor", now)
+	bob, _ := db.InsertUser(ctx, "bob", "hash", "editor", now)
+
+	db.InsertSession(ctx, "a1", alice.Id, now, now.Add(time.Hour))
+	db.InsertSession(ctx, "a2", alice.Id, now, now.Add(time.Minute))
+	db.InsertSession(ctx, "b1", bob.Id, now, now.Add(time.Hour))
+
+	session, user, err := db.GetSession(ctx, "a1")
+	if err != nil {
+		t.Fatalf("get err want nil, got %v", err)
+	}
+	if session.UserId != alice.Id || user.Username != "alice" || !session.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("get got %+v %+v, want alice's session expiring in 1h", session, user)
+	}
+	if _, _, err := db.GetSession(ctx, "nope"); err != errors.ErrNotFound {
+		t.Errorf("get unknown err got %v, want %v", err, errors.ErrNotFound)
+	}
+
+	if n, _ := db.DeleteExpiredSessions(ctx, now.Add(time.Minute)); n != 1 {
+		t.Errorf("delete expired got %d, want 1", n)
+	}
+
+	// A password change logs the user out everywhere but leaves other users alone
+	db.SetUserPassword(ctx, "alice", "new hash")
+	if _, _, err := db.GetSession(ctx, "a1"); err != errors.ErrNotFound {
+		t.Errorf("session after password change err got %v, want %v", err, errors.ErrNotFound)
+	}
+	if _, _, err := db.GetSession(ctx, "b1"); err != nil {
+		t.Errorf("other user's session err got %v, want nil", err)
+	}
+
+	db.DeleteSession(ctx, "b1")
+	if _, _, err := db.GetSession(ctx, "b1"); err != errors.ErrNotFound {
+		t.Errorf("deleted session err got %v, want %v", err, errors.ErrNotFound)
+	}
+}
+
+func TestExistingUsersBecomeAdmins(t *testing.T) {
+	ctx := context.Background()
+	db := NewRealDatabase(":memory:")
+	defer db.Close()
+	for i := 0; i < 3; i++ { // the schema before roles
+		db.DB.Exec(migrations[i])
+	}
+	db.DB.Exec(`PRAGMA user_version = 3;`)
+	db.DB.Exec(`INSERT INTO User (Username, PasswordHash, CreatedAt) VALUES ('alice', 'hash', 0);`)
+
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("migrate err want nil, got %v", err)
+	}
+	if alice, _ := db.GetUserByUsername(ctx, "alice"); alice.Role != "admin" {
+		t.Errorf("existing user role got %q, want admin", alice.Role)
+	}
+	bob, _ := db.InsertUser(ctx, "bob", "hash", "viewer", time.Unix(0, 0))
+	if bob.Role != "viewer" {
+		t.Errorf("new user role got %q, want viewer", bob.Role)
+	}
+}
+
+func TestOidcUsers(t *testing.T) {
+	ctx := context.Background()
+	db := newMigratedDatabase(t)
+	now := time.Date(2022, 4, 30, 23, 59, 59, 0, time.UTC)
+	db.InsertUser(ctx, "alice", "hash1", "admin", now)
+
+	bob, err := db.InsertOidcUser(ctx, "bob", "https://idp.test u-1", "viewer", now)
+	if err != nil {
+		t.Fatalf("insert err want nil, got %v", err)
+	}
+	if got, err := db.GetUserByOidcSubject(ctx, "https://idp.test u-1"); err != nil || got != bob || got.PasswordHash != "" {
+		t.Errorf("get by subject got %+v %v, want %+v without a password", got, err, bob)
+	}
+	if _, err := db.GetUserByOidcSubject(ctx, "https://idp.test u-2"); err != errors.ErrNotFound {
+		t.Errorf("get unknown subject err got %v, want %v", err, errors.ErrNotFound)
+	}
+	if _, err := db.InsertOidcUser(ctx, "alice", "https://idp.test u-2", "viewer", now); err != errors.ErrDuplicate {
+		t.Errorf("insert over a local username err got %v, want %v", err, errors.ErrDuplicate)
+	}
+	if _, err := db.InsertOidcUser(ctx, "bobby", "https://idp.test u-1", "viewer", now); err != errors.ErrDuplicate {
+		t.Errorf("insert duplicate subject err got %v, want %v", err, errors.ErrDuplicate)
+	}
+}
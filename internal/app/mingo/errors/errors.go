@@ -4,4 +4,13 @@ import "errors"
 
 var ErrUnknownUser = errors.New("unable to determine username")
 var ErrUnknownHost = errors.New("unable to determine hostname")
+var ErrUnknownConfigDir = errors.New("unable to determine user config dir")
 var ErrPortUnavailable = errors.New("unable to bind on port")
+var ErrTlsUnavailable = errors.New("unable to load TLS certificate")
+var ErrDatabaseUnavailable = errors.New("unable to open or migrate database")
+var ErrBadCommand = errors.New("unknown command or arguments")
+var ErrCommandFailed = errors.New("command failed")
+var ErrShutdownFailed = errors.New("unable to shut down gracefully")
+
+var ErrNotFound = errors.New("record not found")
+var ErrDuplicate = errors.New("record already exists")
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo"
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+	"github.com/craigjperry2/mingo/internal/app/mingo/config"
+	"github.com/craigjperry2/mingo/internal/app/mingo/database"
+	"github.com/craigjperry2/mingo/internal/app/mingo/errors"
+)
+
+const maxApiBodyBytes = 1 << 20
+
+// Handle JSON requests to the Person resource for programmatic clients, mounted at e.g. /api/people
+//
+//	GET /api/people?offset=&limit=, POST /api/people
+//	GET, PUT & DELETE /api/people/{id}
+type ApiHandler struct {
+	db    *database.Db
+	mount string
+}
+
+type personBody struct {
+	Name     string `json:"name"`
+	Location string `json:"location"`
+}
+
+func NewApiHandler(mount string) ApiHandler {
+	return ApiHandler{config.GetInstance().GetDatabase(), strings.TrimSuffix(mount, "/")}
+}
+
+func (h ApiHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !strings.HasPrefix(req.URL.Path, h.mount) {
+		writeJsonError(w, http.StatusNotFound, "not found")
+		return
+	}
+	rest := strings.Trim(strings.TrimPrefix(req.URL.Path, h.mount), "/")
+	if rest == "" {
+		h.serveCollection(w, req)
+		return
+	}
+	id, err := strconv.Atoi(rest)
+	if err != nil || id < 1 {
+		writeJsonError(w, http.StatusNotFound, "not found")
+		return
+	}
+	h.serveItem(w, req, id)
+}
+
+func (h ApiHandler) serveCollection(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		if !authorizeJson(w, req, auth.PersonRead) {
+			return
+		}
+		offset, err := strconv.Atoi(req.URL.Query().Get("offset"))
+		if err != nil || offset < 0 {
+			offset = 0
+		}
+		limit, err := strconv.Atoi(req.URL.Query().Get("limit"))
+		if err != nil || limit < 1 || limit > 100 {
+			limit = 100
+		}
+		all, err := h.db.GetAll(req.Context(), offset, limit)
+		if err != nil {
+			databaseFailed(w, req, err)
+			return
+		}
+		if all == nil {
+			all = []mingo.Person{}
+		}
+		writeJson(w, http.StatusOK, all)
+	case http.MethodPost:
+		if !authorizeJson(w, req, auth.PersonWrite) {
+			return
+		}
+		body, ok := readPersonBody(w, req)
+		if !ok {
+			return
+		}
+		p, err := h.db.Insert(req.Context(), body.Name, body.Location)
+		if err != nil {
+			databaseFailed(w, req, err)
+			return
+		}
+		w.Header().Set("Location", h.mount+"/"+strconv.Itoa(p.Id))
+		writeJson(w, http.StatusCreated, p)
+	case http.MethodOptions:
+		w.Header().Set("Allow", "GET, HEAD, POST, OPTIONS")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST, OPTIONS")
+		writeJsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (h ApiHandler) serveItem(w http.ResponseWriter, req *http.Request, id int) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		if !authorizeJson(w, req, auth.PersonRead) {
+			return
+		}
+		p, err := h.db.Get(req.Context(), id)
+		if err == errors.ErrNotFound {
+			writeJsonError(w, http.StatusNotFound, "not found")
+			return
+		} else if err != nil {
+			databaseFailed(w, req, err)
+			return
+		}
+		writeJson(w, http.StatusOK, p)
+	case http.MethodPut:
+		if !authorizeJson(w, req, auth.PersonWrite) {
+			return
+		}
+		body, ok := readPersonBody(w, req)
+		if !ok {
+			return
+		}
+		p, err := h.db.Update(req.Context(), id, body.Name, body.Location)
+		if err == errors.ErrNotFound {
+			writeJsonError(w, http.StatusNotFound, "not found")
+			return
+		} else if err != nil {
+			databaseFailed(w, req, err)
+			return
+		}
+		writeJson(w, http.StatusOK, p)
+	case http.MethodDelete:
+		if !authorizeJson(w, req, auth.PersonDelete) {
+			return
+		}
+		if _, err := h.db.Delete(req.Context(), id); err == errors.ErrNotFound {
+			writeJsonError(w, http.StatusNotFound, "not found")
+			return
+		} else if err != nil {
+			databaseFailed(w, req, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodOptions:
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE, OPTIONS")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE, OPTIONS")
+		writeJsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// Check the caller holds perm, otherwise answer 401 to an anonymous caller or 403 in JSON
+func authorizeJson(w http.ResponseWriter, req *http.Request, perm auth.Permission) bool {
+	if _, ok := auth.GetPrincipal(req.Context()); !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="mingo"`)
+		writeJsonError(w, http.StatusUnauthorized, "authentication required")
+		return false
+	}
+	if !can(req, perm) {
+		writeJsonError(w, http.StatusForbidden, "you don't have permission to "+perm.String())
+		return false
+	}
+	return true
+}
+
+func readPersonBody(w http.ResponseWriter, req *http.Request) (personBody, bool) {
+	var body personBody
+	decoder := json.NewDecoder(io.LimitReader(req.Body, maxApiBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&body); err != nil {
+		writeJsonError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return body, false
+	}
+	return body, true
+}
+
+func writeJson(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJsonError(w http.ResponseWriter, status int, message string) {
+	writeJson(w, status, map[string]string{"error": message})
+}
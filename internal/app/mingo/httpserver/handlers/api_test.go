@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+	"github.com/craigjperry2/mingo/internal/app/mingo/database"
+)
+
+func TestApi(t *testing.T) {
+	admin := &auth.Principal{Role: auth.RoleAdmin, Via: auth.ViaSession}
+	viewer := &auth.Principal{Role: auth.RoleViewer, Via: auth.ViaSession}
+	readToken := &auth.Principal{Role: auth.RoleAdmin, Via: auth.ViaToken, Scopes: []string{auth.ScopeRead}}
+	writeToken := &auth.Principal{Role: auth.RoleAdmin, Via: auth.ViaToken, Scopes: []string{auth.ScopeWrite}}
+	tooBig := `{"name":"` + strings.Repeat("a", maxApiBodyBytes) + `"}`
+
+	var tests = []struct {
+		desc      string
+		principal *auth.Principal // nil for an anonymous caller
+		method    string
+		target    string
+		body      string
+		code      int
+		want      string // in the body
+		header    string // "Name: value" wanted in the response, if any
+	}{
+		{"list", admin, http.MethodGet, "/api/people", "", 200, `[{"id":1,"name":"Ada","location":"London"}]`, "Content-Type: application/json"},
+		{"list past the end", admin, http.MethodGet, "/api/people?offset=1&limit=1", "", 200, "[]\n", ""},
+		{"get", readToken, http.MethodGet, "/api/people/1", "", 200, `{"id":1,"name":"Ada","location":"London"}`, ""},
+		{"get missing", admin, http.MethodGet, "/api/people/2", "", 404, `{"error":"not found"}`, ""},
+		{"get bad id", admin, http.MethodGet, "/api/people/ada", "", 404, `{"error":"not found"}`, ""},
+		{"create", writeToken, http.MethodPost, "/api/people", `{"name":"Bob","location":"Paris"}`, 201, `{"id":2,"name":"Bob","location":"Paris"}`, "Location: /api/people/2"},
+		{"create bad JSON", admin, http.MethodPost, "/api/people", `{"name":`, 400, "invalid JSON body", ""},
+		{"create unknown field", admin, http.MethodPost, "/api/people", `{"name":"Bob","age":3}`, 400, "invalid JSON body", ""},
+		{"create too big", admin, http.MethodPost, "/api/people", tooBig, 400, "invalid JSON body", ""},
+		{"update", admin, http.MethodPut, "/api/people/1", `{"name":"Ada","location":"Paris"}`, 200, `{"id":1,"name":"Ada","location":"Paris"}`, ""},
+		{"update missing", admin, http.MethodPut, "/api/people/2", `{"name":"Bob","location":"Paris"}`, 404, `{"error":"not found"}`, ""},
+		{"update bad body", admin, http.MethodPut, "/api/people/1", `[]`, 400, "invalid JSON body", ""},
+		{"delete", writeToken, http.MethodDelete, "/api/people/1", "", 204, "", ""},
+		{"delete missing", writeToken, http.MethodDelete, "/api/people/2", "", 404, `{"error":"not found"}`, ""},
+		{"anonymous", nil, http.MethodGet, "/api/people", "", 401, `{"error":"authentication required"}`, `WWW-Authenticate: Bearer realm="mingo"`},
+		{"read token create", readToken, http.MethodPost, "/api/people", `{"name":"Bob"}`, 403, "permission to add or edit people", ""},
+		{"read token delete", readToken, http.MethodDelete, "/api/people/1", "", 403, "permission to delete people", ""},
+		{"viewer update", viewer, http.MethodPut, "/api/people/1", `{"name":"Bob"}`, 403, "permission to add or edit people", ""},
+		{"collection options", viewer, http.MethodOptions, "/api/people", "", 204, "", "Allow: GET, HEAD, POST, OPTIONS"},
+		{"item options", viewer, http.MethodOptions, "/api/people/1", "", 204, "", "Allow: GET, HEAD, PUT, DELETE, OPTIONS"},
+		{"collection put", admin, http.MethodPut, "/api/people", `{}`, 405, "method not allowed", "Allow: GET, HEAD, POST, OPTIONS"},
+		{"item patch", admin, http.MethodPatch, "/api/people/1", `{}`, 405, "method not allowed", "Allow: GET, HEAD, PUT, DELETE, OPTIONS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			db := database.NewRealDatabase(":memory:")
+			defer db.Close()
+			if err := db.Migrate(); err != nil {
+				t.Fatalf("migrate err want nil, got %v", err)
+			}
+			db.Insert(context.Background(), "Ada", "London")
+
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.principal != nil {
+				req = req.WithContext(auth.WithPrincipal(req.Context(), *tt.principal))
+			}
+			rec := httptest.NewRecorder()
+			ApiHandler{db, "/api/people"}.ServeHTTP(rec, req)
+
+			if rec.Code != tt.code || !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("got %d %q, want %d with %q", rec.Code, rec.Body.String(), tt.code, tt.want)
+			}
+			if name, value, ok := strings.Cut(tt.header, ": "); ok && rec.Header().Get(name) != value {
+				t.Errorf("%s got %q, want %q", name, rec.Header().Get(name), value)
+			}
+			if tt.method == http.MethodDelete && tt.code == 204 {
+				if _, err := db.Get(context.Background(), 1); err == nil {
+					t.Error("still there after the delete")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+)
+
+// Check the caller holds perm, otherwise answer 403 in the form the client can show. HTMX gets a
+// notification fragment retargeted at #flash, crud.html lets 403 responses through to be swapped
+func authorize(w http.ResponseWriter, req *http.Request, perm auth.Permission) bool {
+	if can(req, perm) {
+		return true
+	}
+	message := "You don't have permission to " + perm.String()
+	if req.Header.Get("HX-Request") == "true" {
+		var buf bytes.Buffer
+		templates.ExecuteTemplate(&buf, "forbidden", message)
+		w.Header().Set("HX-Retarget", "#flash")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusForbidden)
+		buf.WriteTo(w)
+		return false
+	}
+	http.Error(w, message, http.StatusForbidden)
+	return false
+}
+
+func can(req *http.Request, perm auth.Permission) bool {
+	principal, _ := auth.GetPrincipal(req.Context())
+	return auth.Can(principal, perm)
+}
@@ -1,12 +1,15 @@
 package handlers
 
 import (
-	"fmt"
+	"bytes"
 	"net/http"
 	"strconv"
 
+	"github.com/craigjperry2/mingo/internal/app/mingo"
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
 	"github.com/craigjperry2/mingo/internal/app/mingo/config"
 	"github.com/craigjperry2/mingo/internal/app/mingo/database"
+	"github.com/craigjperry2/mingo/internal/app/mingo/errors"
 )
 
 // Handle CRUD requests to the Person resource
@@ -14,6 +17,18 @@ type CrudHandler struct {
 	db *database.Db
 }
 
+// A table row of web/templates/crud.partial.html, only offering the buttons the user may use
+type personRow struct {
+	Person    mingo.Person
+	CanEdit   bool
+	CanDelete bool
+	Oob       bool // prepend to the table rather than replace the target
+}
+
+func newPersonRow(req *http.Request, p mingo.Person) personRow {
+	return personRow{p, can(req, auth.PersonWrite), can(req, auth.PersonDelete), false}
+}
+
 func NewCrudHandler() CrudHandler {
 	return CrudHandler{config.GetInstance().GetDatabase()}
 }
@@ -25,22 +40,32 @@ func (h CrudHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			http.NotFound(w, req)
 			return
 		}
+		if !authorize(w, req, auth.PersonDelete) {
+			return
+		}
 		id, err := strconv.Atoi(req.URL.Query().Get("id"))
 		if err != nil {
 			http.NotFound(w, req)
 			return
 		}
-		h.db.Delete(id)
+		// Already deleted, e.g. from another tab, is fine, the row goes from this page either way
+		if _, err := h.db.Delete(req.Context(), id); err != nil && err != errors.ErrNotFound {
+			databaseFailed(w, req, err)
+			return
+		}
 	case http.MethodPut:
 		if req.URL.Path != "/crud" {
 			http.NotFound(w, req)
 			return
 		}
-	default: // GET
+	case http.MethodGet, http.MethodHead:
 		if req.URL.Path != "/crud" {
 			http.NotFound(w, req)
 			return
 		}
+		if !authorize(w, req, auth.PersonRead) {
+			return
+		}
 		offset, err := strconv.Atoi(req.URL.Query().Get("offset"))
 		if err != nil || offset < 0 {
 			offset = 0
@@ -49,12 +74,25 @@ func (h CrudHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		if err != nil || limit < 1 {
 			limit = 1
 		}
-		all, _ := h.db.GetAll(offset, limit)
+		all, err := h.db.GetAll(req.Context(), offset, limit)
+		if err != nil {
+			databaseFailed(w, req, err)
+			return
+		}
+		var buf bytes.Buffer
 		for _, p := range all {
-			fmt.Fprintf(w, `<tr> <td>%d</td> <td>%s</td> <td>%s</td> <td><div class="buttons are-small"><button class="button is-info" hx-get="/edit?id=%d">Edit</button><button class="button is-danger" hx-delete="/crud?id=%d">Delete</button></div></td> </tr>`, p.Id, p.Name, p.Location, p.Id, p.Id)
+			templates.ExecuteTemplate(&buf, "person-row", newPersonRow(req, p))
 		}
 		if limit == len(all) {
-			fmt.Fprintf(w, `<tr id="replaceMe"> <td colspan="4" class="has-text-centered"> <button class="button is-link" hx-get="/crud?limit=%d&offset=%d" hx-target="#replaceMe" hx-swap="outerHTML" hx-confirm="unset"> Load More... <span class="htmx-indicator is-transparent"> <span class="icon-text"> <span class="icon"> <i class="fas fa-spinner"></i> </span> </span> </span> </button> </td> </tr>`, limit, all[len(all)-1].Id)
+			templates.ExecuteTemplate(&buf, "load-more-row", struct{ Limit, Offset int }{limit, all[len(all)-1].Id})
+		}
+		if offset == 0 && !can(req, auth.PersonWrite) {
+			templates.ExecuteTemplate(&buf, "hide-add-row", nil) // the add row is part of the static page
 		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		buf.WriteTo(w)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 	}
 }
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+	"github.com/craigjperry2/mingo/internal/app/mingo/database"
+)
+
+func TestCrudRespectsRoles(t *testing.T) {
+	db := database.NewRealDatabase(":memory:")
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("migrate err want nil, got %v", err)
+	}
+	db.Insert(context.Background(), "Ada", "<script>London</script>")
+	crud := CrudHandler{db}
+
+	var tests = []struct {
+		role       string
+		wantEdit   bool
+		wantDelete bool
+		wantAdd    bool
+	}{
+		{auth.RoleViewer, false, false, false},
+		{auth.RoleEditor, true, false, true},
+		{auth.RoleAdmin, true, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.role, func(t *testing.T) {
+			rec := serveAs(crud, auth.Principal{Role: tt.role}, http.MethodGet, "/crud?limit=2", false)
+			body := rec.Body.String()
+			if rec.Code != http.StatusOK || !strings.Contains(body, "&lt;script&gt;London") {
+				t.Fatalf("list got %d %q, want 200 with escaped rows", rec.Code, body)
+			}
+			if got := strings.Contains(body, `hx-get="/edit?id=1"`); got != tt.wantEdit {
+				t.Errorf("edit button got %v, want %v", got, tt.wantEdit)
+			}
+			if got := strings.Contains(body, `hx-delete="/crud?id=1"`); got != tt.wantDelete {
+				t.Errorf("delete button got %v, want %v", got, tt.wantDelete)
+			}
+			if got := !strings.Contains(body, `id="add-row" hx-swap-oob="true"`); got != tt.wantAdd {
+				t.Errorf("add row kept got %v, want %v", got, tt.wantAdd)
+			}
+		})
+	}
+
+	rec := serveAs(crud, auth.Principal{Role: auth.RoleEditor}, http.MethodDelete, "/crud?id=1", true)
+	if rec.Code != http.StatusForbidden || rec.Header().Get("HX-Retarget") != "#flash" || !strings.Contains(rec.Body.String(), "permission to delete people") {
+		t.Errorf("editor delete got %d %v %q, want 403 fragment for #flash", rec.Code, rec.Header(), rec.Body.String())
+	}
+	if p, _ := db.GetAll(context.Background(), 0, 10); len(p) != 1 {
+		t.Errorf("rows after forbidden delete got %d, want 1", len(p))
+	}
+
+	rec = serveAs(EditHandler{db}, auth.Principal{Role: auth.RoleViewer}, http.MethodGet, "/edit?id=1", false)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("viewer edit got %d, want 403", rec.Code)
+	}
+
+	rec = serveAs(ApiHandler{db, "/api/people"}, auth.Principal{Role: auth.RoleViewer}, http.MethodDelete, "/api/people/1", false)
+	if rec.Code != http.StatusForbidden || rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("viewer api delete got %d %q, want 403 JSON", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
+
+func serveAs(h http.Handler, p auth.Principal, method string, target string, htmx bool) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	req = req.WithContext(auth.WithPrincipal(req.Context(), p))
+	if htmx {
+		req.Header.Set("HX-Request", "true")
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestOptionsIsNotARead(t *testing.T) {
+	db := database.NewRealDatabase(":memory:")
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("migrate err want nil, got %v", err)
+	}
+	admin := auth.Principal{Role: auth.RoleAdmin}
+
+	var tests = []struct {
+		h         http.Handler
+		target    string
+		wantCode  int
+		wantAllow string
+	}{
+		{CrudHandler{db}, "/crud?limit=2", http.StatusMethodNotAllowed, "GET, HEAD, PUT, DELETE"},
+		{EditHandler{db}, "/edit?id=1", http.StatusMethodNotAllowed, "GET, HEAD, POST, PUT"},
+		{ApiHandler{db, "/api/people"}, "/api/people", http.StatusNoContent, "GET, HEAD, POST, OPTIONS"},
+		{ApiHandler{db, "/api/people"}, "/api/people/1", http.StatusNoContent, "GET, HEAD, PUT, DELETE, OPTIONS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			rec := serveAs(tt.h, admin, http.MethodOptions, tt.target, false)
+			if rec.Code != tt.wantCode || rec.Header().Get("Allow") != tt.wantAllow || rec.Body.Len() > 0 && tt.wantCode == http.StatusNoContent {
+				t.Errorf("got %d %q %q, want %d %q", rec.Code, rec.Header().Get("Allow"), rec.Body.String(), tt.wantCode, tt.wantAllow)
+			}
+		})
+	}
+}
+
+func TestDatabaseFailures(t *testing.T) {
+	db := database.NewRealDatabase(":memory:")
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("migrate err want nil, got %v", err)
+	}
+	admin := auth.Principal{Role: auth.RoleAdmin}
+
+	if rec := serveAs(ApiHandler{db, "/api/people"}, admin, http.MethodGet, "/api/people/7", false); rec.Code != http.StatusNotFound {
+		t.Errorf("api get of missing person got %d, want 404", rec.Code)
+	}
+	if rec := serveAs(EditHandler{db}, admin, http.MethodGet, "/edit?id=7", false); rec.Code != http.StatusNotFound {
+		t.Errorf("edit of missing person got %d, want 404", rec.Code)
+	}
+	if rec := serveAs(EditHandler{db}, admin, http.MethodPut, "/edit?id=7", true); rec.Code != http.StatusNotFound {
+		t.Errorf("save of missing person got %d, want 404", rec.Code)
+	}
+	if rec := serveAs(CrudHandler{db}, admin, http.MethodDelete, "/crud?id=7", true); rec.Code != http.StatusOK {
+		t.Errorf("delete of missing person got %d, want 200, it's gone either way", rec.Code)
+	}
+
+	expired, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	var tests = []struct {
+		h            http.Handler
+		target       string
+		htmx         bool
+		wantType     string
+		wantRetarget string
+	}{
+		{CrudHandler{db}, "/crud?limit=2", true, "text/html; charset=utf-8", "#flash"},
+		{CrudHandler{db}, "/crud?limit=2", false, "text/plain; charset=utf-8", ""},
+		{ApiHandler{db, "/api/people"}, "/api/people", false, "application/json", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req = req.WithContext(auth.WithPrincipal(expired, admin))
+			if tt.htmx {
+				req.Header.Set("HX-Request", "true")
+			}
+			rec := httptest.NewRecorder()
+			tt.h.ServeHTTP(rec, req)
+			if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "1" {
+				t.Errorf("past the deadline got %d %v, want 503 with Retry-After", rec.Code, rec.Header())
+			}
+			if rec.Header().Get("Content-Type") != tt.wantType || rec.Header().Get("HX-Retarget") != tt.wantRetarget {
+				t.Errorf("past the deadline got %v, want %q retargeted at %q", rec.Header(), tt.wantType, tt.wantRetarget)
+			}
+		})
+	}
+
+	gone, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/crud?limit=2", nil).WithContext(auth.WithPrincipal(gone, admin))
+	rec := httptest.NewRecorder()
+	CrudHandler{db}.ServeHTTP(rec, req)
+	if rec.Body.Len() > 0 || rec.Header().Get("Retry-After") != "" {
+		t.Errorf("after the client left got %d %q, want nothing written", rec.Code, rec.Body.String())
+	}
+}
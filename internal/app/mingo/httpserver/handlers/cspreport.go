@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/config"
+	"github.com/craigjperry2/mingo/internal/app/mingo/logger"
+)
+
+// Log the Content Security Policy violations browsers report to /csp-report
+// Anyone can post here so only a few fields are logged, quoted, and the body size is capped
+type CspReportHandler struct {
+	log *log.Logger
+}
+
+// The fields of a report-uri report, Reporting API reports carry the same in camelCase
+type cspViolation struct {
+	DocumentUri        string `json:"document-uri"`
+	BlockedUri         string `json:"blocked-uri"`
+	ViolatedDirective  string `json:"violated-directive"`
+	EffectiveDirective string `json:"effective-directive"`
+	SourceFile         string `json:"source-file"`
+	LineNumber         int    `json:"line-number"`
+	Disposition        string `json:"disposition"`
+}
+
+type reportingApiViolation struct {
+	DocumentURL        string `json:"documentURL"`
+	BlockedURL         string `json:"blockedURL"`
+	EffectiveDirective string `json:"effectiveDirective"`
+	SourceFile         string `json:"sourceFile"`
+	LineNumber         int    `json:"lineNumber"`
+	Disposition        string `json:"disposition"`
+}
+
+func NewCspReportHandler() CspReportHandler {
+	c := config.GetInstance()
+	return CspReportHandler{logger.NewComponentLogger(c.GetClock(), c.GetLoggingDestination(), c.GetHostname(), "csp")}
+}
+
+func (h CspReportHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(req.Body, 16<<10))
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	var violations []cspViolation
+	var legacy struct {
+		Report *cspViolation `json:"csp-report"`
+	}
+	var batch []struct {
+		Type string                `json:"type"`
+		Body reportingApiViolation `json:"body"`
+	}
+	if json.Unmarshal(body, &legacy) == nil && legacy.Report != nil {
+		violations = append(violations, *legacy.Report)
+	} else if json.Unmarshal(body, &batch) == nil {
+		for _, r := range batch {
+			if r.Type == "csp-violation" {
+				b := r.Body
+				violations = append(violations, cspViolation{b.DocumentURL, b.BlockedURL, "", b.EffectiveDirective, b.SourceFile, b.LineNumber, b.Disposition})
+			}
+		}
+	} else {
+		http.Error(w, "expected a CSP report", http.StatusBadRequest)
+		return
+	}
+
+	for _, v := range violations {
+		directive := v.EffectiveDirective
+		if directive == "" {
+			directive = v.ViolatedDirective
+		}
+		logger.Scoped(req.Context(), h.log).Printf("%s violation of %q on %q: blocked %q at %q line %d", v.Disposition, directive, v.DocumentUri, v.BlockedUri, v.SourceFile, v.LineNumber)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCspReportHandler(t *testing.T) {
+	var tests = []struct {
+		desc       string
+		method     string
+		body       string
+		wantStatus int
+		wantLog    string
+	}{
+		{"report-uri", "POST", `{"csp-report":{"document-uri":"https://mingo.test/crud.html","blocked-uri":"inline","violated-directive":"script-src-elem","source-file":"https://mingo.test/crud.html","line-number":12,"disposition":"enforce"}}`,
+			204, `enforce violation of "script-src-elem" on "https://mingo.test/crud.html": blocked "inline" at "https://mingo.test/crud.html" line 12`},
+		{"reporting api", "POST", `[{"type":"csp-violation","body":{"documentURL":"https://mingo.test/","blockedURL":"https://evil.test/x.js","effectiveDirective":"script-src","disposition":"report"}},{"type":"deprecation","body":{}}]`,
+			204, `report violation of "script-src" on "https://mingo.test/": blocked "https://evil.test/x.js" at "" line 0`},
+		{"not a report", "POST", `"hello"`, 400, ""},
+		{"get", "GET", "", 405, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			var buf bytes.Buffer
+			h := CspReportHandler{log.New(&buf, "", 0)}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(tt.method, "/csp-report", strings.NewReader(tt.body)))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status got %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := strings.TrimSpace(buf.String()); got != tt.wantLog {
+				t.Errorf("log got %q, want %q", got, tt.wantLog)
+			}
+			if tt.method == http.MethodGet && rec.Header().Get("Allow") != "POST" {
+				t.Errorf("Allow got %q", rec.Header().Get("Allow"))
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Answer a failed database call in the form the client can show. Nothing is sent once the client has
+// gone away, and running out of time is a 503 worth retrying rather than a 500
+func databaseFailed(w http.ResponseWriter, req *http.Request, err error) {
+	if req.Context().Err() == context.Canceled {
+		return // nobody is listening
+	}
+	status, message := http.StatusInternalServerError, "The database failed, please try again later"
+	if errors.Is(err, context.DeadlineExceeded) {
+		status, message = http.StatusServiceUnavailable, "The database is busy, please try again"
+		w.Header().Set("Retry-After", "1")
+	}
+
+	switch {
+	case req.Header.Get("HX-Request") == "true":
+		var buf bytes.Buffer
+		templates.ExecuteTemplate(&buf, "forbidden", message)
+		w.Header().Set("HX-Retarget", "#flash")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		buf.WriteTo(w)
+	case strings.HasPrefix(req.URL.Path, "/api/"):
+		writeJsonError(w, status, message)
+	default:
+		http.Error(w, message, status)
+	}
+}
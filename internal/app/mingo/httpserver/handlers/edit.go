@@ -1,12 +1,14 @@
 package handlers
 
 import (
-	"fmt"
+	"bytes"
 	"net/http"
 	"strconv"
 
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
 	"github.com/craigjperry2/mingo/internal/app/mingo/config"
 	"github.com/craigjperry2/mingo/internal/app/mingo/database"
+	"github.com/craigjperry2/mingo/internal/app/mingo/errors"
 )
 
 // Handle CRUD requests to the Person resource
@@ -25,33 +27,69 @@ func (h EditHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			http.NotFound(w, req)
 			return
 		}
+		if !authorize(w, req, auth.PersonWrite) {
+			return
+		}
 		id, err := strconv.Atoi(req.URL.Query().Get("id"))
 		if err != nil {
 			http.NotFound(w, req)
 			return
 		}
 		req.ParseForm()
-		p, _ := h.db.Update(id, req.FormValue("name"), req.FormValue("location"))
-		fmt.Fprintf(w, `<tr> <td>%d</td> <td>%s</td> <td>%s</td> <td><div class="buttons are-small"><button class="button is-info" hx-get="/edit?id=%d">Edit</button><button class="button is-danger" hx-delete="/crud?id=%d">Delete</button></div></td> </tr>`, p.Id, p.Name, p.Location, p.Id, p.Id)
+		p, err := h.db.Update(req.Context(), id, req.FormValue("name"), req.FormValue("location"))
+		if err == errors.ErrNotFound {
+			http.NotFound(w, req)
+			return
+		} else if err != nil {
+			databaseFailed(w, req, err)
+			return
+		}
+		renderTemplate(w, req, http.StatusOK, "person-row", newPersonRow(req, p))
 	case http.MethodPost:
 		if req.URL.Path != "/edit" {
 			http.NotFound(w, req)
 			return
 		}
+		if !authorize(w, req, auth.PersonWrite) {
+			return
+		}
 		req.ParseForm()
-		p, _ := h.db.Insert(req.FormValue("name"), req.FormValue("location"))
-		fmt.Fprintf(w, `<tr hx-swap-oob="afterbegin:.tablebody" hx-swap="outerHTML"><td>%d</td> <td>%s</td> <td>%s</td> <td><div class="buttons are-small"><button class="button is-info" hx-get="/edit?id=%d">Edit</button><button class="button is-danger" hx-delete="/crud?id=%d">Delete</button></div></td> </tr> <tr> <td></td> <td><input name="name" placeholder="name"></td> <td><input name="location" placeholder="location"></td> <td><div class="buttons are-small"><button class="button is-info" hx-post="/edit" hx-include="closest tr" hx-target="closest tr" hx-swap="outerHTML">Add</button></div></td> </tr>`, p.Id, p.Name, p.Location, p.Id, p.Id)
-	default: // GET
+		p, err := h.db.Insert(req.Context(), req.FormValue("name"), req.FormValue("location"))
+		if err != nil {
+			databaseFailed(w, req, err)
+			return
+		}
+		row := newPersonRow(req, p)
+		row.Oob = true
+		var buf bytes.Buffer
+		templates.ExecuteTemplate(&buf, "person-row", row)
+		templates.ExecuteTemplate(&buf, "person-add-row", nil)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		buf.WriteTo(w)
+	case http.MethodGet, http.MethodHead:
 		if req.URL.Path != "/edit" {
 			http.NotFound(w, req)
 			return
 		}
+		if !authorize(w, req, auth.PersonWrite) {
+			return
+		}
 		id, err := strconv.Atoi(req.URL.Query().Get("id"))
 		if err != nil {
 			http.NotFound(w, req)
 			return
 		}
-		row, _ := h.db.Get(id)
-		fmt.Fprintf(w, `<tr> <td>%d</td> <td><input name='name' value='%s'></td> <td><input name='location' value='%s'></td> <td><div class="buttons are-small"><button class="button is-info">Cancel</button><button class="button is-danger" hx-put="/edit?id=%d" hx-include="closest tr">Save</button></div></td> </tr>`, row.Id, row.Name, row.Location, row.Id)
+		row, err := h.db.Get(req.Context(), id)
+		if err == errors.ErrNotFound {
+			http.NotFound(w, req)
+			return
+		} else if err != nil {
+			databaseFailed(w, req, err)
+			return
+		}
+		renderTemplate(w, req, http.StatusOK, "person-edit-row", row)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 	}
 }
@@ -6,16 +6,96 @@ import (
 	"time"
 
 	"github.com/craigjperry2/mingo/internal/app/mingo/config"
+	"github.com/craigjperry2/mingo/internal/app/mingo/logger"
 )
 
-// Expose read-only server health status
-type HealthHandler struct{}
+// Expose read-only server health status, 503 while any component is unhealthy
+type HealthHandler struct {
+	report func() HealthReport
+}
+
+// What the orchestrator knows about the app's health
+type HealthReport struct {
+	Lifecycle  []LifecycleEvent  // every state the app has been in, oldest first
+	Components []ComponentHealth // each started component in start order
+}
+
+// The app entered State At this time, for Reason
+type LifecycleEvent struct {
+	State  string
+	At     time.Time
+	Reason string
+}
+
+// How one of the app's components is doing, Err is nil when it's healthy
+type ComponentHealth struct {
+	Name string
+	Err  error
+}
 
-func NewHealthHandler() HealthHandler {
-	return HealthHandler{}
+func NewHealthHandler(report func() HealthReport) HealthHandler {
+	return HealthHandler{report}
 }
 
 func (h HealthHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var report HealthReport
+	if h.report != nil {
+		report = h.report()
+	}
+	for _, c := range report.Components {
+		if c.Err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			break
+		}
+	}
+
 	// TODO: JSONify
 	fmt.Fprintf(w, "uptime: %s\n", config.GetInstance().GetClock()().UTC().Sub(time.Unix(0, config.GetInstance().GetStartUtc().UnixNano())))
+	fmt.Fprintf(w, "log levels: %s\n", logger.FormatLevels(logger.Levels()))
+	if n := len(report.Lifecycle); n > 0 {
+		fmt.Fprintf(w, "lifecycle: %s\n", report.Lifecycle[n-1].State)
+		for _, e := range report.Lifecycle {
+			if e.Reason != "" {
+				fmt.Fprintf(w, "  %s at %s, %s\n", e.State, e.At.Format(time.RFC3339Nano), e.Reason)
+			} else {
+				fmt.Fprintf(w, "  %s at %s\n", e.State, e.At.Format(time.RFC3339Nano))
+			}
+		}
+	}
+	for _, c := range report.Components {
+		if c.Err != nil {
+			fmt.Fprintf(w, "%s: %v\n", c.Name, c.Err)
+		} else {
+			fmt.Fprintf(w, "%s: ok\n", c.Name)
+		}
+	}
+}
+
+// Tell a load balancer whether to send the app traffic, 503 unless it's running with every component
+// healthy. Once told to stop the app carries on serving for --shutdown-delay while this reports 503
+type ReadyHandler struct {
+	report func() HealthReport
+}
+
+func NewReadyHandler(report func() HealthReport) ReadyHandler {
+	return ReadyHandler{report}
+}
+
+func (h ReadyHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var report HealthReport
+	if h.report != nil {
+		report = h.report()
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if n := len(report.Lifecycle); n == 0 || report.Lifecycle[n-1].State != "running" {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	for _, c := range report.Components {
+		if c.Err != nil {
+			http.Error(w, "not ready, "+c.Name+" is unhealthy", http.StatusServiceUnavailable)
+			return
+		}
+	}
+	fmt.Fprintln(w, "ready")
 }
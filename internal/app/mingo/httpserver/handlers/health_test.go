@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReady(t *testing.T) {
+	running := []LifecycleEvent{{State: "starting"}, {State: "running"}}
+	tests := []struct {
+		name   string
+		report HealthReport
+		code   int
+		body   string
+	}{
+		{"running & healthy", HealthReport{running, []ComponentHealth{{Name: "database"}}}, 200, "ready\n"},
+		{"starting", HealthReport{running[:1], nil}, 503, "not ready\n"},
+		{"stopping, draining before shutdown", HealthReport{append(running, LifecycleEvent{State: "stopping"}), nil}, 503, "not ready\n"},
+		{"unhealthy component", HealthReport{running, []ComponentHealth{{Name: "database", Err: fmt.Errorf("disk I/O error")}}}, 503, "not ready, database is unhealthy\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			report := tt.report
+			NewReadyHandler(func() HealthReport { return report }).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+			if rec.Code != tt.code || rec.Body.String() != tt.body {
+				t.Errorf("got %d %q, want %d %q", rec.Code, rec.Body.String(), tt.code, tt.body)
+			}
+			if !strings.Contains(rec.Header().Get("Cache-Control"), "no-store") {
+				t.Errorf("Cache-Control got %q", rec.Header().Get("Cache-Control"))
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+	"github.com/craigjperry2/mingo/internal/app/mingo/config"
+	"github.com/craigjperry2/mingo/internal/app/mingo/database"
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+// Where to go after logging in when the login page wasn't reached from somewhere else
+const defaultLandingPage = "/static/crud.html"
+
+// Render the login form and exchange a valid username & password for a session cookie
+type LoginHandler struct {
+	db     *database.Db
+	clock  system.Clock
+	ttl    time.Duration
+	secure bool // only send the cookie over HTTPS
+	sso    bool // offer single sign-on
+}
+
+type loginPage struct {
+	Next     string
+	Username string
+	Error    string
+	Sso      bool
+}
+
+func NewLoginHandler() LoginHandler {
+	c := config.GetInstance()
+	return LoginHandler{c.GetDatabase(), c.GetClock(), c.GetSessionTtl(), c.IsTlsEnabled(), c.GetOidcClient() != nil}
+}
+
+func (h LoginHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/login" {
+		http.NotFound(w, req)
+		return
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		renderTemplate(w, req, http.StatusOK, "login.html", loginPage{Next: safeNext(req.URL.Query().Get("next")), Sso: h.sso})
+	case http.MethodPost:
+		h.login(w, req)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h LoginHandler) login(w http.ResponseWriter, req *http.Request) {
+	req.Body = http.MaxBytesReader(w, req.Body, 64<<10)
+	if err := req.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	username := strings.TrimSpace(req.PostFormValue("username"))
+	next := safeNext(req.PostFormValue("next"))
+
+	// Same message and (roughly) same time for unknown, disabled & wrong password so usernames can't be probed
+	user, err := h.db.GetUserByUsername(req.Context(), username)
+	if err != nil {
+		user.PasswordHash = ""
+	}
+	if !auth.VerifyPassword(user.PasswordHash, req.PostFormValue("password")) || user.Disabled {
+		renderTemplate(w, req, http.StatusUnauthorized, "login.html", loginPage{next, username, "Invalid username or password", h.sso})
+		return
+	}
+
+	if err := startSession(w, req, h.db, h.clock, h.ttl, h.secure, user.Id); err != nil {
+		http.Error(w, "unable to create session", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, req, next, http.StatusSeeOther)
+}
+
+// Store a new session for the user and hand its token to the browser, for password & single sign-on logins
+func startSession(w http.ResponseWriter, req *http.Request, db *database.Db, clock system.Clock, ttl time.Duration, secure bool, userId int) error {
+	token, idHash, err := auth.NewSessionToken()
+	if err != nil {
+		return err
+	}
+	now := clock().UTC()
+	db.DeleteExpiredSessions(req.Context(), now) // housekeeping, logins are infrequent enough to piggyback on
+	if _, err := db.InsertSession(req.Context(), idHash, userId, now, now.Add(ttl)); err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.SessionCookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// End the session behind the cookie, on the server as well as in the browser
+type LogoutHandler struct {
+	db     *database.Db
+	secure bool
+}
+
+func NewLogoutHandler() LogoutHandler {
+	c := config.GetInstance()
+	return LogoutHandler{c.GetDatabase(), c.IsTlsEnabled()}
+}
+
+func (h LogoutHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/logout" {
+		http.NotFound(w, req)
+		return
+	}
+	if req.Method != http.MethodPost { // a GET could be triggered cross-site by an <img> tag
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if cookie, err := req.Cookie(auth.SessionCookieName); err == nil {
+		h.db.DeleteSession(req.Context(), auth.HashToken(cookie.Value))
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.SessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   h.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.CsrfCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   h.secure,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, req, "/login", http.StatusSeeOther)
+}
+
+// Only redirect back to a path on this site, never e.g. //evil.example or https://evil.example
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") ||
+		strings.HasPrefix(next, "/login") || strings.ContainsAny(next, "\r\n") {
+		return defaultLandingPage
+	}
+	return next
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+	"github.com/craigjperry2/mingo/internal/app/mingo/database"
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+func TestLoginAndLogout(t *testing.T) {
+	ctx := context.Background()
+	clock := system.ClockForTesting("2022-04-30T23:59:59Z")
+	db := database.NewRealDatabase(":memory:")
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("migrate err want nil, got %v", err)
+	}
+	hash, _ := auth.HashPassword("hunter2hunter2")
+	db.InsertUser(ctx, "alice", hash, "editor", clock())
+	db.InsertUser(ctx, "mallory", hash, "editor", clock())
+	db.SetUserDisabled(ctx, "mallory", true)
+
+	login := LoginHandler{db, clock, time.Hour, true, false}
+
+	get := httptest.NewRecorder()
+	login.ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/login?next=/crud", nil))
+	if get.Code != http.StatusOK || !strings.Contains(get.Body.String(), `name="next" value="/crud"`) {
+		t.Errorf("login form got %d %q, want 200 with next field", get.Code, get.Body.String())
+	}
+
+	var tests = []struct {
+		desc       string
+		username   string
+		password   string
+		wantStatus int
+	}{
+		{"wrong password", "alice", "hunter3hunter3", http.StatusUnauthorized},
+		{"unknown user", "bob", "hunter2hunter2", http.StatusUnauthorized},
+		{"disabled user", "mallory", "hunter2hunter2", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			rec := postForm(login, "/login", url.Values{"username": {tt.username}, "password": {tt.password}})
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status got %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if !strings.Contains(rec.Body.String(), "Invalid username or password") || len(rec.Result().Cookies()) != 0 {
+				t.Errorf("body got %q and cookies %v, want generic error and no cookie", rec.Body.String(), rec.Result().Cookies())
+			}
+		})
+	}
+
+	rec := postForm(login, "/login", url.Values{"username": {"Alice"}, "password": {"hunter2hunter2"}, "next": {"/crud?limit=2"}})
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/crud?limit=2" {
+		t.Fatalf("login got %d to %q, want 303 to /crud?limit=2", rec.Code, rec.Header().Get("Location"))
+	}
+	cookie := rec.Result().Cookies()[0]
+	if cookie.Name != auth.SessionCookieName || !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode || cookie.MaxAge != 3600 {
+		t.Errorf("cookie got %+v, want HttpOnly, Secure, SameSite=Lax session cookie for 1h", cookie)
+	}
+	if _, user, err := db.GetSession(ctx, auth.HashToken(cookie.Value)); err != nil || user.Username != "alice" {
+		t.Errorf("stored session got %v %v, want alice's", user, err)
+	}
+
+	logout := LogoutHandler{db, true}
+	req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	req.AddCookie(cookie)
+	rec = httptest.NewRecorder()
+	logout.ServeHTTP(rec, req)
+	if rec.Code != http.StatusSeeOther || rec.Result().Cookies()[0].MaxAge != -1 {
+		t.Errorf("logout got %d %v, want 303 clearing the cookie", rec.Code, rec.Result().Cookies())
+	}
+	if _, _, err := db.GetSession(ctx, auth.HashToken(cookie.Value)); err == nil {
+		t.Error("session after logout still exists")
+	}
+}
+
+func TestSafeNext(t *testing.T) {
+	var tests = []struct {
+		next string
+		want string
+	}{
+		{"/crud", "/crud"},
+		{"/static/crud.html?x=1", "/static/crud.html?x=1"},
+		{"", defaultLandingPage},
+		{"https://evil.example/", defaultLandingPage},
+		{"//evil.example/", defaultLandingPage},
+		{"/\\evil.example/", defaultLandingPage},
+		{"/login?next=/login", defaultLandingPage},
+	}
+	for _, tt := range tests {
+		if got := safeNext(tt.next); got != tt.want {
+			t.Errorf("safeNext(%q) got %q, want %q", tt.next, got, tt.want)
+		}
+	}
+}
+
+func postForm(h http.Handler, target string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+	"github.com/craigjperry2/mingo/internal/app/mingo/config"
+	"github.com/craigjperry2/mingo/internal/app/mingo/logger"
+)
+
+// Show and change each component's log level at /admin/log-levels without a restart, "*" is the
+// level of components without one of their own
+//
+//	GET /admin/log-levels			{"*":"info","access":"info","sql":"info",...}
+//	PUT /admin/log-levels {"sql":"debug"}	the levels after the change
+type LogLevelsHandler struct {
+	log *log.Logger
+}
+
+func NewLogLevelsHandler() LogLevelsHandler {
+	c := config.GetInstance()
+	return LogLevelsHandler{logger.NewComponentLogger(c.GetClock(), c.GetLoggingDestination(), c.GetHostname(), "admin")}
+}
+
+func (h LogLevelsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/admin/log-levels" {
+		writeJsonError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if !authorizeJson(w, req, auth.LogsManage) {
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		writeJson(w, http.StatusOK, logger.Levels())
+	case http.MethodPut:
+		var levels map[string]logger.Level
+		if err := json.NewDecoder(io.LimitReader(req.Body, maxApiBodyBytes)).Decode(&levels); err != nil {
+			writeJsonError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+			return
+		}
+		if len(levels) == 0 {
+			writeJsonError(w, http.StatusBadRequest, "no log levels to change")
+			return
+		}
+		logger.SetLevels(levels)
+		principal, _ := auth.GetPrincipal(req.Context())
+		logger.Warnf(logger.Scoped(req.Context(), h.log), "%s set log levels %s", principal.Username, logger.FormatLevels(levels))
+		writeJson(w, http.StatusOK, logger.Levels())
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		writeJsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+	"github.com/craigjperry2/mingo/internal/app/mingo/logger"
+)
+
+func TestLogLevels(t *testing.T) {
+	before := logger.Levels()
+	defer logger.SetLevels(before)
+	h := LogLevelsHandler{log.New(io.Discard, "", 0)}
+	admin := auth.Principal{Role: auth.RoleAdmin, Username: "alice"}
+
+	put := func(p auth.Principal, body string) (int, string) {
+		req := httptest.NewRequest(http.MethodPut, "/admin/log-levels", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req.WithContext(auth.WithPrincipal(req.Context(), p)))
+		return rec.Code, rec.Body.String()
+	}
+
+	if code, body := put(admin, `{"sql":"debug","*":"warn"}`); code != http.StatusOK || !strings.Contains(body, `"sql":"debug"`) || !strings.Contains(body, `"*":"warn"`) {
+		t.Errorf("put got %d %s", code, body)
+	}
+	if logger.GetLevel("sql") != logger.LevelDebug || logger.GetLevel("never-seen") != logger.LevelWarn {
+		t.Errorf("levels got sql %v, default %v", logger.GetLevel("sql"), logger.GetLevel("never-seen"))
+	}
+	if code, _ := put(admin, `{"sql":"loud"}`); code != http.StatusBadRequest {
+		t.Errorf("unknown level got %d, want 400", code)
+	}
+	if code, _ := put(auth.Principal{Role: auth.RoleEditor}, `{"sql":"off"}`); code != http.StatusForbidden || logger.GetLevel("sql") != logger.LevelDebug {
+		t.Errorf("editor put got %d, want 403 and no change", code)
+	}
+
+	rec := serveAs(h, admin, http.MethodGet, "/admin/log-levels", false)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"sql":"debug"`) {
+		t.Errorf("get got %d %s", rec.Code, rec.Body.String())
+	}
+}
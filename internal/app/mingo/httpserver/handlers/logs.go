@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+	"github.com/craigjperry2/mingo/internal/app/mingo/logger"
+)
+
+// Let admins read the recent log at /admin/logs, filtered by component, level and text such as a
+// request id, and follow it live from /admin/logs/stream as server-sent events
+type LogsHandler struct {
+	ring     *logger.Ring
+	draining <-chan struct{} // closed when the server starts shutting down
+}
+
+type logsPage struct {
+	Username   string
+	Entries    []logRow
+	Components []string
+	Levels     []string
+	Component  string
+	Level      string
+	Text       string
+	LastSeq    uint64
+}
+
+type logRow struct {
+	Time, Component, Level, Message string
+}
+
+// draining is closed when the server shuts down, streams end then so they don't hold up the drain
+func NewLogsHandler(draining <-chan struct{}) LogsHandler {
+	return LogsHandler{logger.Recent(), draining}
+}
+
+func (h LogsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/admin/logs" && req.URL.Path != "/admin/logs/stream" {
+		http.NotFound(w, req)
+		return
+	}
+	if !authorize(w, req, auth.LogsRead) {
+		return
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.ring == nil {
+		http.Error(w, "the recent log is turned off, see --log-buffer", http.StatusNotFound)
+		return
+	}
+
+	component, text := req.URL.Query().Get("component"), req.URL.Query().Get("q")
+	level, err := logger.ParseLevel(req.URL.Query().Get("level"))
+	if err != nil {
+		level = logger.LevelDebug
+	}
+	if req.URL.Path == "/admin/logs/stream" {
+		h.stream(w, req, component, level, text)
+		return
+	}
+
+	principal, _ := auth.GetPrincipal(req.Context())
+	page := logsPage{Username: principal.Username, Levels: []string{"debug", "info", "warn", "error"}, Component: component, Level: level.String(), Text: text}
+	for c := range logger.Levels() {
+		if c != logger.DefaultComponent {
+			page.Components = append(page.Components, c)
+		}
+	}
+	sort.Strings(page.Components)
+	for _, e := range h.ring.Entries(0) {
+		page.LastSeq = e.Seq
+		if e.Matches(component, level, text) {
+			page.Entries = append(page.Entries, logRow{e.Time.Format("2006-01-02T15:04:05.999Z"), e.Component, e.Level.String(), e.Message})
+		}
+	}
+	renderTemplate(w, req, http.StatusOK, "logs.html", page)
+}
+
+// Send matching entries after the viewer's last one as they're logged. The stream ends with the
+// request's deadline, short of the server's write timeout, or when the server starts draining, and the
+// browser's EventSource reconnects with Last-Event-ID so nothing is missed or repeated
+func (h LogsHandler) stream(w http.ResponseWriter, req *http.Request, component string, level logger.Level, text string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	after, _ := strconv.ParseUint(req.URL.Query().Get("after"), 10, 64)
+	if id, err := strconv.ParseUint(req.Header.Get("Last-Event-ID"), 10, 64); err == nil {
+		after = id
+	}
+
+	live, stop := h.ring.Subscribe(256) // before the backlog is read so nothing falls between the two
+	defer stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no") // ask a proxy in front not to hold events back
+	fmt.Fprint(w, "retry: 1000\n\n")
+
+	send := func(e logger.Entry) {
+		if e.Seq <= after {
+			return
+		}
+		after = e.Seq
+		if e.Matches(component, level, text) {
+			data, _ := json.Marshal(e)
+			fmt.Fprintf(w, "id: %d\ndata: %s\n\n", e.Seq, data)
+		} else {
+			fmt.Fprintf(w, "id: %d\n\n", e.Seq) // no data, the browser just remembers where it's up to
+		}
+	}
+	for _, e := range h.ring.Entries(after) {
+		send(e)
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-h.draining:
+			return
+		case e := <-live:
+			send(e)
+			flusher.Flush()
+		}
+	}
+}
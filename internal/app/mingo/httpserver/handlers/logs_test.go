@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+	"github.com/craigjperry2/mingo/internal/app/mingo/logger"
+)
+
+func TestLogsPage(t *testing.T) {
+	ring := logger.NewRing(10)
+	ring.Add(logger.Entry{Component: "sql", Level: logger.LevelWarn, Message: "req-42 GetAll was slow, 1s"})
+	ring.Add(logger.Entry{Component: "access", Level: logger.LevelInfo, Message: "req-42 GET 200 /crud"})
+	ring.Add(logger.Entry{Component: "access", Level: logger.LevelInfo, Message: "req-43 GET 200 /<script>"})
+	h := LogsHandler{ring: ring}
+
+	rec := serveAs(h, auth.Principal{Role: auth.RoleAdmin}, http.MethodGet, "/admin/logs?q=req-42", false)
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || !strings.Contains(body, "GetAll was slow") || !strings.Contains(body, "GET 200 /crud") || strings.Contains(body, "req-43") {
+		t.Errorf("filtered by request id got %d %s", rec.Code, body)
+	}
+	if !strings.Contains(body, `params.set("after", "3")`) {
+		t.Error("page doesn't tell the stream where it's up to")
+	}
+
+	rec = serveAs(h, auth.Principal{Role: auth.RoleAdmin}, http.MethodGet, "/admin/logs?level=warn", false)
+	if body := rec.Body.String(); !strings.Contains(body, "GetAll was slow") || strings.Contains(body, "GET 200") {
+		t.Errorf("filtered by level got %s", body)
+	}
+	rec = serveAs(h, auth.Principal{Role: auth.RoleAdmin}, http.MethodGet, "/admin/logs?component=access", false)
+	if body := rec.Body.String(); strings.Contains(body, "GetAll was slow") || !strings.Contains(body, "/&lt;script&gt;") {
+		t.Errorf("filtered by component got %s", body)
+	}
+
+	if rec := serveAs(h, auth.Principal{Role: auth.RoleEditor}, http.MethodGet, "/admin/logs", false); rec.Code != http.StatusForbidden {
+		t.Errorf("editor got %d, want 403", rec.Code)
+	}
+}
+
+func TestLogsStream(t *testing.T) {
+	ring := logger.NewRing(10)
+	ring.Add(logger.Entry{Component: "access", Message: "already seen"})
+	ring.Add(logger.Entry{Component: "access", Message: "req-42 missed while reconnecting"})
+	ring.Add(logger.Entry{Component: "access", Message: "req-43 someone else's"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, "/admin/logs/stream?q=req-42&after=0", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	req = req.WithContext(auth.WithPrincipal(ctx, auth.Principal{Role: auth.RoleAdmin}))
+	rec := httptest.NewRecorder()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		ring.Add(logger.Entry{Component: "sql", Message: "req-42 logged live"})
+	}()
+	LogsHandler{ring: ring}.ServeHTTP(rec, req)
+
+	body := rec.Body.String()
+	if rec.Header().Get("Content-Type") != "text/event-stream" || !strings.HasPrefix(body, "retry: 1000\n\n") {
+		t.Fatalf("got %v %q", rec.Header(), body)
+	}
+	for _, want := range []string{`id: 2` + "\n" + `data: {"seq":2,`, "id: 3\n\n", `id: 4` + "\n" + `data: {"seq":4,`, `"message":"req-42 logged live"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("stream %q, want %q", body, want)
+		}
+	}
+	if strings.Contains(body, "already seen") || strings.Contains(body, "someone else's") {
+		t.Errorf("stream %q sent entries it shouldn't", body)
+	}
+}
+
+func TestLogsStreamEndsWhenDraining(t *testing.T) {
+	draining := make(chan struct{})
+	req := httptest.NewRequest(http.MethodGet, "/admin/logs/stream", nil)
+	req = req.WithContext(auth.WithPrincipal(context.Background(), auth.Principal{Role: auth.RoleAdmin}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		LogsHandler{ring: logger.NewRing(10), draining: draining}.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	close(draining)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stream still open after the server started draining")
+	}
+}
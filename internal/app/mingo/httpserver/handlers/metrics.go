@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"expvar"
+	"net/http"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+)
+
+// Serve the expvar counters, e.g. throttled requests, as JSON at /debug/vars for admins & monitoring tokens
+type MetricsHandler struct{}
+
+func NewMetricsHandler() MetricsHandler {
+	return MetricsHandler{}
+}
+
+func (h MetricsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !authorizeJson(w, req, auth.MetricsRead) {
+		return
+	}
+	expvar.Handler().ServeHTTP(w, req)
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/config"
+	"github.com/craigjperry2/mingo/internal/app/mingo/database"
+	"github.com/craigjperry2/mingo/internal/app/mingo/errors"
+	"github.com/craigjperry2/mingo/internal/app/mingo/logger"
+	"github.com/craigjperry2/mingo/internal/app/mingo/oidc"
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+const (
+	oidcStartPath    = "/login/oidc"
+	oidcCallbackPath = "/login/oidc/callback"
+
+	// Holds state, nonce, PKCE verifier & where to go next while the browser is at the provider
+	oidcCookieName = "mingo_oidc"
+	oidcCookieTtl  = 10 * time.Minute
+)
+
+// Single sign-on: /login/oidc sends the browser to the provider, /login/oidc/callback exchanges the code
+// it comes back with for an ID token and starts a session. First time users are created with the
+// username from the token, every login re-applies the role the provider's claims map to
+type OidcHandler struct {
+	client        *oidc.Client // nil when single sign-on isn't configured
+	roles         oidc.RoleMap
+	usernameClaim string
+	redirectUrl   string // empty to derive from the request
+	db            *database.Db
+	clock         system.Clock
+	ttl           time.Duration
+	secure        bool
+	log           *log.Logger
+}
+
+func NewOidcHandler() OidcHandler {
+	c := config.GetInstance()
+	return OidcHandler{
+		c.GetOidcClient(), c.GetOidcRoleMap(), c.GetOidcUsernameClaim(), c.GetOidcRedirectUrl(),
+		c.GetDatabase(), c.GetClock(), c.GetSessionTtl(), c.IsTlsEnabled(),
+		logger.NewComponentLogger(c.GetClock(), c.GetLoggingDestination(), c.GetHostname(), "oidc"),
+	}
+}
+
+func (h OidcHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if h.client == nil || (req.URL.Path != oidcStartPath && req.URL.Path != oidcCallbackPath) {
+		http.NotFound(w, req)
+		return
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if req.URL.Path == oidcStartPath {
+		h.start(w, req)
+	} else {
+		h.callback(w, req)
+	}
+}
+
+func (h OidcHandler) start(w http.ResponseWriter, req *http.Request) {
+	attempt := url.Values{"next": {safeNext(req.URL.Query().Get("next"))}}
+	for _, name := range []string{"state", "nonce", "verifier"} {
+		value, err := oidc.RandomString()
+		if err != nil {
+			http.Error(w, "unable to start single sign-on", http.StatusInternalServerError)
+			return
+		}
+		attempt.Set(name, value)
+	}
+	authUrl, err := h.client.AuthCodeURL(h.callbackUrl(req), attempt.Get("state"), attempt.Get("nonce"), attempt.Get("verifier"))
+	if err != nil {
+		logger.Errorf(logger.Scoped(req.Context(), h.log), "provider %s unavailable: %v", h.client.Issuer(), err)
+		h.fail(w, req, http.StatusBadGateway, attempt.Get("next"), "Single sign-on is unavailable, try again later")
+		return
+	}
+
+	h.setAttemptCookie(w, base64.RawURLEncoding.EncodeToString([]byte(attempt.Encode())), int(oidcCookieTtl.Seconds()))
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, req, authUrl, http.StatusFound)
+}
+
+func (h OidcHandler) callback(w http.ResponseWriter, req *http.Request) {
+	attempt := url.Values{}
+	if cookie, err := req.Cookie(oidcCookieName); err == nil {
+		if b, err := base64.RawURLEncoding.DecodeString(cookie.Value); err == nil {
+			attempt, _ = url.ParseQuery(string(b))
+		}
+	}
+	h.setAttemptCookie(w, "", -1) // one go per attempt
+	next := safeNext(attempt.Get("next"))
+	log := logger.Scoped(req.Context(), h.log)
+
+	q := req.URL.Query()
+	state := attempt.Get("state")
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(q.Get("state"))) != 1 {
+		h.fail(w, req, http.StatusBadRequest, next, "Your single sign-on attempt expired, please try again")
+		return
+	}
+	if q.Get("error") != "" {
+		log.Printf("provider refused login: %q %q", q.Get("error"), q.Get("error_description")) // unauthenticated, quoted so they can't forge lines
+		h.fail(w, req, http.StatusUnauthorized, next, "Single sign-on was refused by the provider")
+		return
+	}
+
+	claims, err := h.client.Exchange(req.Context(), q.Get("code"), h.callbackUrl(req), attempt.Get("verifier"), attempt.Get("nonce"))
+	if err != nil {
+		log.Printf("login failed: %v", err)
+		h.fail(w, req, http.StatusUnauthorized, next, "Single sign-on failed")
+		return
+	}
+	role, ok := h.roles.Role(claims)
+	if !ok {
+		log.Printf("subject %s has no role, %s claim is %q", claims.String("sub"), h.roles.Claim, claims.Strings(h.roles.Claim))
+		h.fail(w, req, http.StatusForbidden, next, "Your account isn't allowed to use this site")
+		return
+	}
+
+	user, err := h.db.GetUserByOidcSubject(req.Context(), h.client.Issuer()+" "+claims.String("sub"))
+	switch {
+	case err == errors.ErrNotFound:
+		username := strings.TrimSpace(claims.String(h.usernameClaim))
+		if username == "" || len(username) > 64 || strings.ContainsAny(username, "\x00\r\n\t") {
+			log.Printf("subject %s has no usable %s claim", claims.String("sub"), h.usernameClaim)
+			h.fail(w, req, http.StatusForbidden, next, "Your account has no usable username")
+			return
+		}
+		user, err = h.db.InsertOidcUser(req.Context(), username, h.client.Issuer()+" "+claims.String("sub"), role, h.clock().UTC())
+		if err == errors.ErrDuplicate { // never take over a local account just because the provider names it
+			h.fail(w, req, http.StatusConflict, next, "The username "+username+" belongs to another account, ask an admin")
+			return
+		}
+	case err == nil && user.Disabled:
+		h.fail(w, req, http.StatusForbidden, next, "Your account is disabled")
+		return
+	case err == nil && user.Role != role:
+		err = h.db.SetUserRole(req.Context(), user.Username, role) // the provider is the source of truth for roles
+	}
+	if err != nil {
+		http.Error(w, "unable to log in", http.StatusInternalServerError)
+		return
+	}
+
+	if err := startSession(w, req, h.db, h.clock, h.ttl, h.secure, user.Id); err != nil {
+		http.Error(w, "unable to create session", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, req, next, http.StatusSeeOther)
+}
+
+// Must be byte for byte what's registered with the provider and the same in both legs of the flow
+func (h OidcHandler) callbackUrl(req *http.Request) string {
+	if h.redirectUrl != "" {
+		return h.redirectUrl
+	}
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + req.Host + oidcCallbackPath
+}
+
+// Lax, not Strict, because the provider's redirect back to us is a cross-site navigation
+func (h OidcHandler) setAttemptCookie(w http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookieName,
+		Value:    value,
+		Path:     oidcStartPath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   h.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (h OidcHandler) fail(w http.ResponseWriter, req *http.Request, status int, next string, message string) {
+	renderTemplate(w, req, status, "login.html", loginPage{Next: next, Error: message, Sso: true})
+}
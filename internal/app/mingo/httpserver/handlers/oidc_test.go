@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+	"github.com/craigjperry2/mingo/internal/app/mingo/database"
+	"github.com/craigjperry2/mingo/internal/app/mingo/oidc"
+	"github.com/craigjperry2/mingo/internal/app/mingo/oidc/fakeidp"
+)
+
+func TestOidcLogin(t *testing.T) {
+	ctx := context.Background()
+	db := database.NewRealDatabase(":memory:")
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("migrate err want nil, got %v", err)
+	}
+	db.InsertUser(ctx, "root", "hash", "admin", time.Now())
+	idp, err := fakeidp.New("https://idp.test", "mingo", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roles, _ := oidc.ParseRoleMap("groups", []string{"mingo-admins=admin", "staff=editor"})
+	h := OidcHandler{
+		oidc.NewClient(idp.Issuer, "mingo", "s3cret", idp.Client(), time.Now), roles, "preferred_username", "",
+		db, time.Now, time.Hour, false, log.New(ioutil.Discard, "", 0),
+	}
+
+	// Drive the browser through start, the provider and the callback, returning the final response
+	login := func(t *testing.T, tamperState bool) *httptest.ResponseRecorder {
+		start := httptest.NewRecorder()
+		h.ServeHTTP(start, httptest.NewRequest(http.MethodGet, "http://mingo.test/login/oidc?next=/crud", nil))
+		if start.Code != http.StatusFound || !strings.HasPrefix(start.Header().Get("Location"), "https://idp.test/authorize?") {
+			t.Fatalf("start got %d to %q, want 302 to the provider", start.Code, start.Header().Get("Location"))
+		}
+		browser := idp.Client()
+		browser.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+		resp, err := browser.Get(start.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		back := resp.Header.Get("Location")
+		if !strings.HasPrefix(back, "http://mingo.test/login/oidc/callback?") {
+			t.Fatalf("provider redirected to %q, want our callback", back)
+		}
+		if tamperState {
+			back = strings.Replace(back, "state=", "state=x", 1)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, back, nil)
+		for _, c := range start.Result().Cookies() {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	idp.Login(map[string]interface{}{"sub": "u-1", "preferred_username": "alice", "groups": []string{"staff"}})
+	rec := login(t, false)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/crud" {
+		t.Fatalf("callback got %d to %q: %s, want 303 to /crud", rec.Code, rec.Header().Get("Location"), rec.Body.String())
+	}
+	var session string
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == auth.SessionCookieName {
+			session = c.Value
+		}
+	}
+	if _, user, err := db.GetSession(ctx, auth.HashToken(session)); err != nil || user.Username != "alice" || user.Role != "editor" || user.PasswordHash != "" {
+		t.Errorf("session user got %+v %v, want a new password-less editor alice", user, err)
+	}
+
+	idp.Login(map[string]interface{}{"sub": "u-1", "preferred_username": "alice-renamed", "groups": []string{"staff", "mingo-admins"}})
+	if rec := login(t, false); rec.Code != http.StatusSeeOther {
+		t.Fatalf("second login got %d, want 303", rec.Code)
+	}
+	if user, _ := db.GetUserByUsername(ctx, "alice"); user.Role != "admin" {
+		t.Errorf("role got %q, want admin from the provider's groups", user.Role)
+	}
+
+	var tests = []struct {
+		desc        string
+		claims      map[string]interface{}
+		tamperState bool
+		wantStatus  int
+		wantMessage string
+	}{
+		{"forged state", map[string]interface{}{"sub": "u-1", "groups": "staff"}, true, http.StatusBadRequest, "expired"},
+		{"provider refuses", nil, false, http.StatusUnauthorized, "refused"},
+		{"no matching role", map[string]interface{}{"sub": "u-2", "preferred_username": "bob", "groups": "contractors"}, false, http.StatusForbidden, "allowed"},
+		{"local username taken", map[string]interface{}{"sub": "u-3", "preferred_username": "root", "groups": "staff"}, false, http.StatusConflict, "another account"},
+		{"no username", map[string]interface{}{"sub": "u-4", "groups": "staff"}, false, http.StatusForbidden, "username"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			idp.Login(tt.claims)
+			rec := login(t, tt.tamperState)
+			if rec.Code != tt.wantStatus || !strings.Contains(rec.Body.String(), tt.wantMessage) {
+				t.Errorf("got %d %q, want %d mentioning %q", rec.Code, rec.Body.String(), tt.wantStatus, tt.wantMessage)
+			}
+			for _, c := range rec.Result().Cookies() {
+				if c.Name == auth.SessionCookieName {
+					t.Errorf("got a session cookie, want none")
+				}
+			}
+		})
+	}
+
+	var logged bytes.Buffer
+	h.log = log.New(&logged, "", 0)
+	start := httptest.NewRecorder()
+	h.ServeHTTP(start, httptest.NewRequest(http.MethodGet, "http://mingo.test/login/oidc", nil))
+	state := start.Result().Header.Get("Location")
+	state = state[strings.Index(state, "state=")+len("state="):]
+	state, _, _ = strings.Cut(state, "&")
+	req := httptest.NewRequest(http.MethodGet, "http://mingo.test/login/oidc/callback?state="+state+"&error=access_denied&error_description=no%0Aforged+line", nil)
+	for _, c := range start.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if want := `provider refused login: "access_denied" "no\nforged line"` + "\n"; logged.String() != want {
+		t.Errorf("log got %q, want %q", logged.String(), want)
+	}
+
+	db.SetUserDisabled(ctx, "alice", true)
+	idp.Login(map[string]interface{}{"sub": "u-1", "groups": "staff"})
+	if rec := login(t, false); rec.Code != http.StatusForbidden {
+		t.Errorf("disabled user got %d, want 403", rec.Code)
+	}
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// Send plain HTTP requests to the same host & path on the HTTPS port
+type HttpsRedirectHandler struct {
+	httpsPort uint16
+}
+
+func NewHttpsRedirectHandler(httpsPort uint16) HttpsRedirectHandler {
+	return HttpsRedirectHandler{httpsPort}
+}
+
+func (h HttpsRedirectHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	host := req.Host
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	if host == "" {
+		http.Error(w, "missing Host header", http.StatusBadRequest)
+		return
+	}
+	if h.httpsPort != 443 {
+		host = net.JoinHostPort(host, strconv.Itoa(int(h.httpsPort)))
+	} else if net.ParseIP(host) != nil && net.ParseIP(host).To4() == nil {
+		host = "[" + host + "]"
+	}
+
+	// 301 lets browsers cache the upgrade but clients may turn other methods into a GET, 308 doesn't
+	code := http.StatusPermanentRedirect
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		code = http.StatusMovedPermanently
+	}
+	http.Redirect(w, req, "https://"+host+req.URL.RequestURI(), code)
+}
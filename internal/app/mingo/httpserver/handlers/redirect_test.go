@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHttpsRedirect(t *testing.T) {
+	var tests = []struct {
+		desc         string
+		port         uint16
+		method       string
+		target       string
+		host         string
+		wantStatus   int
+		wantLocation string
+	}{
+		{"get", 8443, http.MethodGet, "/crud?limit=2", "example.com:8080", 301, "https://example.com:8443/crud?limit=2"},
+		{"default port", 443, http.MethodGet, "/static/", "example.com", 301, "https://example.com/static/"},
+		{"ipv6", 443, http.MethodGet, "/", "[::1]:80", 301, "https://[::1]/"},
+		{"ipv6 port", 8443, http.MethodGet, "/", "[::1]:80", 301, "https://[::1]:8443/"},
+		{"post keeps method", 8443, http.MethodPost, "/edit", "example.com", 308, "https://example.com:8443/edit"},
+		{"no host", 8443, http.MethodGet, "/", "", 400, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			req.Host = tt.host
+			rec := httptest.NewRecorder()
+			NewHttpsRedirectHandler(tt.port).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status got %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("location got %q, want %q", got, tt.wantLocation)
+			}
+		})
+	}
+}
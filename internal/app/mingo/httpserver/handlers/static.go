@@ -1,35 +1,204 @@
 package handlers
 
 import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
 	"io/fs"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/craigjperry2/mingo/internal/app/mingo/config"
+	"github.com/craigjperry2/mingo/internal/app/mingo/httpserver/middleware"
 	"github.com/craigjperry2/mingo/web"
 )
 
+// Font types vary between the OS mime.types files so i pin the ones the embedded assets need
+var staticContentTypes = map[string]string{
+	".eot":   "application/vnd.ms-fontobject",
+	".otf":   "font/otf",
+	".svg":   "image/svg+xml",
+	".ttf":   "font/ttf",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+}
+
 // Handle requests for files (.js, .css) from static dir
+// Unlike http.FileServer: no directory listings unless enabled, no dotfiles and an optional SPA fallback page
 type StaticHandler struct {
-	handler http.Handler
+	fsys        fs.FS
+	mount       string
+	indexFiles  []string
+	listing     bool
+	spaFallback string
 }
 
 func NewStaticHandler(staticMount string) StaticHandler {
-	staticDir := config.GetInstance().GetStaticDir()
+	c := config.GetInstance()
+	staticDir := c.GetStaticDir()
+	var fSys fs.FS
 	if staticDir == "" {
-		fSys, err := fs.Sub(web.StaticDir, ".")
+		sub, err := fs.Sub(web.StaticDir, "static")
 		if err != nil {
 			panic(err)
 		}
-		return StaticHandler{http.FileServer(http.FS(fSys))}
+		fSys = sub
 	} else {
 		if _, err := os.Stat(staticDir); os.IsNotExist(err) {
 			panic("dir doesn't exist: " + staticDir)
 		}
-		return StaticHandler{http.StripPrefix(staticMount, http.FileServer(http.Dir(staticDir)))}
+		fSys = os.DirFS(staticDir)
 	}
+	return newStaticHandler(fSys, staticMount, c.GetStaticIndexFiles(), c.GetStaticDirListing(), c.GetStaticSpaFallback())
+}
+
+func newStaticHandler(fSys fs.FS, staticMount string, indexFiles []string, listing bool, spaFallback string) StaticHandler {
+	return StaticHandler{fSys, staticMount, indexFiles, listing, strings.TrimPrefix(spaFallback, "/")}
 }
 
 func (h StaticHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	h.handler.ServeHTTP(w, req)
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasPrefix(req.URL.Path, h.mount) {
+		http.NotFound(w, req)
+		return
+	}
+	rel := strings.TrimPrefix(req.URL.Path, h.mount)
+
+	// ServeMux already cleans paths but don't rely on the router to protect the filesystem
+	if strings.Contains(rel, "\\") || strings.Contains(rel, "\x00") {
+		http.Error(w, "invalid URL path", http.StatusBadRequest)
+		return
+	}
+	for _, segment := range strings.Split(rel, "/") {
+		if segment == ".." {
+			http.Error(w, "invalid URL path", http.StatusBadRequest)
+			return
+		}
+		if strings.HasPrefix(segment, ".") {
+			http.NotFound(w, req) // don't confirm hidden files exist
+			return
+		}
+	}
+
+	name := strings.TrimSuffix(rel, "/")
+	if name == "" {
+		name = "."
+	}
+	if !fs.ValidPath(name) {
+		http.Error(w, "invalid URL path", http.StatusBadRequest)
+		return
+	}
+
+	info, err := fs.Stat(h.fsys, name)
+	if err != nil {
+		if h.spaFallback != "" && path.Ext(name) == "" {
+			h.serveFile(w, req, h.spaFallback)
+			return
+		}
+		http.NotFound(w, req)
+		return
+	}
+
+	if !info.IsDir() {
+		h.serveFile(w, req, name)
+		return
+	}
+
+	if !strings.HasSuffix(req.URL.Path, "/") {
+		target := req.URL.Path + "/"
+		if req.URL.RawQuery != "" {
+			target += "?" + req.URL.RawQuery
+		}
+		http.Redirect(w, req, target, http.StatusMovedPermanently)
+		return
+	}
+	for _, index := range h.indexFiles {
+		candidate := path.Join(name, index)
+		if fi, err := fs.Stat(h.fsys, candidate); err == nil && !fi.IsDir() {
+			h.serveFile(w, req, candidate)
+			return
+		}
+	}
+	if h.listing {
+		h.listDirectory(w, req, name)
+		return
+	}
+	http.NotFound(w, req)
+}
+
+func (h StaticHandler) serveFile(w http.ResponseWriter, req *http.Request, name string) {
+	f, err := h.fsys.Open(name)
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, req)
+		return
+	}
+
+	if contentType, ok := staticContentTypes[strings.ToLower(path.Ext(name))]; ok {
+		w.Header().Set("Content-Type", contentType)
+	}
+
+	// Pages get this response's CSP nonce written in, so a cached copy would carry a stale one
+	if nonce := middleware.CspNonce(req.Context()); nonce != "" && strings.EqualFold(path.Ext(name), ".html") {
+		b, err := io.ReadAll(f)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		http.ServeContent(w, req, name, time.Time{}, bytes.NewReader(withCspNonce(b, nonce)))
+		return
+	}
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		b, err := io.ReadAll(f)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		content = bytes.NewReader(b)
+	}
+	http.ServeContent(w, req, name, info.ModTime(), content)
+}
+
+// Only reached when listings are enabled, hidden entries are still omitted
+func (h StaticHandler) listDirectory(w http.ResponseWriter, req *http.Request, name string) {
+	entries, err := fs.ReadDir(h.fsys, name)
+	if err != nil {
+		http.Error(w, "error reading directory", http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<pre>\n")
+	for _, e := range entries {
+		entry := e.Name()
+		if strings.HasPrefix(entry, ".") {
+			continue
+		}
+		if e.IsDir() {
+			entry += "/"
+		}
+		href := (&url.URL{Path: entry}).String()
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", html.EscapeString(href), html.EscapeString(entry))
+	}
+	fmt.Fprintf(w, "</pre>\n")
 }
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func testStaticFS() fstest.MapFS {
+	return fstest.MapFS{
+		"index.html":                 {Data: []byte("<html>home</html>")},
+		"app.html":                   {Data: []byte("<html>app</html>")},
+		".env":                       {Data: []byte("SECRET=1")},
+		".git/config":                {Data: []byte("[core]")},
+		"fa/webfonts/fa-solid.woff2": {Data: []byte("wOF2")},
+		"fa/webfonts/fa-solid.ttf":   {Data: []byte("ttf")},
+		"fa/webfonts/fa-solid.eot":   {Data: []byte("eot")},
+		"fa/webfonts/.hidden":        {Data: []byte("hidden")},
+		"htmx/htmx.min.js":           {Data: []byte("var htmx")},
+		"docs/default.htm":           {Data: []byte("docs")},
+	}
+}
+
+func TestStaticHandler(t *testing.T) {
+	h := newStaticHandler(testStaticFS(), "/static/", []string{"index.html", "default.htm"}, false, "")
+
+	var tests = []struct {
+		desc        string
+		method      string
+		path        string
+		wantStatus  int
+		wantBody    string
+		wantType    string
+		wantHeaders map[string]string
+	}{
+		{"root index", http.MethodGet, "/static/", 200, "<html>home</html>", "text/html; charset=utf-8", nil},
+		{"second index", http.MethodGet, "/static/docs/", 200, "docs", "", nil},
+		{"dir redirect", http.MethodGet, "/static/docs?x=1", 301, "", "", map[string]string{"Location": "/static/docs/?x=1"}},
+		{"no listing", http.MethodGet, "/static/fa/webfonts/", 404, "", "", nil},
+		{"dotfile", http.MethodGet, "/static/.env", 404, "", "", nil},
+		{"dot dir", http.MethodGet, "/static/.git/config", 404, "", "", nil},
+		{"nested dotfile", http.MethodGet, "/static/fa/webfonts/.hidden", 404, "", "", nil},
+		{"traversal", http.MethodGet, "/static/../crud.sql", 400, "", "", nil},
+		{"backslash", http.MethodGet, "/static/..\\crud.sql", 400, "", "", nil},
+		{"woff2", http.MethodGet, "/static/fa/webfonts/fa-solid.woff2", 200, "wOF2", "font/woff2", nil},
+		{"ttf", http.MethodGet, "/static/fa/webfonts/fa-solid.ttf", 200, "ttf", "font/ttf", nil},
+		{"eot", http.MethodGet, "/static/fa/webfonts/fa-solid.eot", 200, "eot", "application/vnd.ms-fontobject", nil},
+		{"js", http.MethodGet, "/static/htmx/htmx.min.js", 200, "var htmx", "text/javascript; charset=utf-8", nil},
+		{"head", http.MethodHead, "/static/htmx/htmx.min.js", 200, "", "text/javascript; charset=utf-8", nil},
+		{"unknown", http.MethodGet, "/static/nope", 404, "", "", nil},
+		{"post", http.MethodPost, "/static/index.html", 405, "", "", map[string]string{"Allow": "GET, HEAD"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status got %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body got %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+			if tt.wantType != "" && rec.Header().Get("Content-Type") != tt.wantType {
+				t.Errorf("content-type got %q, want %q", rec.Header().Get("Content-Type"), tt.wantType)
+			}
+			for k, v := range tt.wantHeaders {
+				if rec.Header().Get(k) != v {
+					t.Errorf("header %s got %q, want %q", k, rec.Header().Get(k), v)
+				}
+			}
+		})
+	}
+}
+
+func TestStaticHandlerListing(t *testing.T) {
+	h := newStaticHandler(testStaticFS(), "/static/", []string{"index.html"}, true, "")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/static/fa/webfonts/", nil))
+
+	if rec.Code != 200 {
+		t.Fatalf("status got %d, want 200", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `<a href="fa-solid.woff2">fa-solid.woff2</a>`) {
+		t.Errorf("listing missing file, got %q", rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), ".hidden") {
+		t.Errorf("listing shows hidden file, got %q", rec.Body.String())
+	}
+}
+
+func TestStaticHandlerSpaFallback(t *testing.T) {
+	h := newStaticHandler(testStaticFS(), "/static/", []string{"index.html"}, false, "/app.html")
+
+	var tests = []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"/static/people/42", 200, "<html>app</html>"},
+		{"/static/htmx/htmx.min.js", 200, "var htmx"},
+		{"/static/missing.js", 404, ""},
+		{"/static/.env", 404, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status got %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body got %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestWithCspNonce(t *testing.T) {
+	page := `<head><script src="/a.js"></script><SCRIPT>x()</SCRIPT><style>p{}</style><scripts></scripts></head>`
+	want := `<head><script nonce="n0nce" src="/a.js"></script><SCRIPT nonce="n0nce">x()</SCRIPT><style nonce="n0nce">p{}</style><scripts></scripts></head>`
+	if got := string(withCspNonce([]byte(page), "n0nce")); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got := string(withCspNonce([]byte(page), "")); got != page {
+		t.Errorf("without a nonce got %s", got)
+	}
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"regexp"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/httpserver/middleware"
+	"github.com/craigjperry2/mingo/web"
+)
+
+var templates = template.Must(template.ParseFS(web.Templates, "templates/*.html"))
+
+// Render into a buffer first so a template error doesn't leave a half written page with a 200 status
+func renderTemplate(w http.ResponseWriter, req *http.Request, status int, name string, data interface{}) {
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, name, data); err != nil {
+		http.Error(w, "template error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(withCspNonce(buf.Bytes(), middleware.CspNonce(req.Context())))
+}
+
+var inlineCodeTag = regexp.MustCompile(`(?i)<(script|style)([\s>])`)
+
+// Stamp the request's CSP nonce on the page's <script> & <style> tags so the browser runs them
+// Only the page's own markup can match, html/template escapes any "<" coming from data
+func withCspNonce(page []byte, nonce string) []byte {
+	if nonce == "" {
+		return page
+	}
+	return inlineCodeTag.ReplaceAll(page, []byte(`<$1 nonce="`+nonce+`"$2`))
+}
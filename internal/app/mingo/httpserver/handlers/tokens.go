@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo"
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+	"github.com/craigjperry2/mingo/internal/app/mingo/config"
+	"github.com/craigjperry2/mingo/internal/app/mingo/database"
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+// Let a logged in user list, create & revoke their own API tokens at /tokens
+type TokensHandler struct {
+	db    *database.Db
+	clock system.Clock
+}
+
+type tokensPage struct {
+	Username string
+	Tokens   []tokenRow
+	NewToken string
+	Error    string
+}
+
+type tokenRow struct {
+	Id, Name, Scopes, Created, Expires, LastUsed string
+}
+
+func NewTokensHandler() TokensHandler {
+	c := config.GetInstance()
+	return TokensHandler{c.GetDatabase(), c.GetClock()}
+}
+
+func (h TokensHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/tokens" {
+		http.NotFound(w, req)
+		return
+	}
+	if !authorize(w, req, auth.TokensManage) {
+		return
+	}
+	principal, _ := auth.GetPrincipal(req.Context())
+	if principal.UserId == 0 {
+		http.Error(w, "API tokens belong to user accounts, log in to manage yours", http.StatusForbidden)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		h.render(w, req, http.StatusOK, principal, tokensPage{})
+	case http.MethodPost:
+		req.ParseForm()
+		switch req.PostFormValue("action") {
+		case "create":
+			h.create(w, req, principal)
+		case "revoke":
+			h.db.DeleteApiToken(req.Context(), req.PostFormValue("id"), principal.UserId) // only ever the caller's own
+			http.Redirect(w, req, "/tokens", http.StatusSeeOther)
+		default:
+			http.Error(w, "unknown action", http.StatusBadRequest)
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h TokensHandler) create(w http.ResponseWriter, req *http.Request, principal auth.Principal) {
+	name := strings.TrimSpace(req.PostFormValue("name"))
+	if name == "" || len(name) > 64 {
+		h.render(w, req, http.StatusBadRequest, principal, tokensPage{Error: "Name is required, up to 64 characters"})
+		return
+	}
+	scopes, err := auth.ParseScopes(strings.Join(req.PostForm["scope"], ","))
+	if err != nil {
+		h.render(w, req, http.StatusBadRequest, principal, tokensPage{Error: "Pick at least one scope"})
+		return
+	}
+	for _, scope := range scopes {
+		if !principal.Allows(scope) { // a token can't mint a more powerful token than itself
+			h.render(w, req, http.StatusForbidden, principal, tokensPage{Error: "You can't grant the " + scope + " scope"})
+			return
+		}
+	}
+	days, err := strconv.Atoi(req.PostFormValue("expires"))
+	if err != nil || days < 0 || days > 365 {
+		h.render(w, req, http.StatusBadRequest, principal, tokensPage{Error: "Pick an expiry"})
+		return
+	}
+
+	token, id, secretHash, err := auth.NewApiToken()
+	if err != nil {
+		http.Error(w, "unable to create token", http.StatusInternalServerError)
+		return
+	}
+	now := h.clock().UTC()
+	t := mingo.ApiToken{Id: id, UserId: principal.UserId, Name: name, SecretHash: secretHash, Scopes: scopes, CreatedAt: now}
+	if days > 0 {
+		t.ExpiresAt = now.AddDate(0, 0, days)
+	}
+	if err := h.db.InsertApiToken(req.Context(), t); err != nil {
+		http.Error(w, "unable to create token", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store") // the page holds a secret
+	h.render(w, req, http.StatusCreated, principal, tokensPage{NewToken: token})
+}
+
+func (h TokensHandler) render(w http.ResponseWriter, req *http.Request, status int, principal auth.Principal, page tokensPage) {
+	tokens, err := h.db.ListApiTokens(req.Context(), principal.UserId)
+	if err != nil {
+		http.Error(w, "unable to list tokens", http.StatusInternalServerError)
+		return
+	}
+	page.Username = principal.Username
+	for _, t := range tokens {
+		page.Tokens = append(page.Tokens, tokenRow{t.Id, t.Name, strings.Join(t.Scopes, ", "), formatDate(t.CreatedAt, ""), formatDate(t.ExpiresAt, "never"), formatDate(t.LastUsedAt, "never")})
+	}
+	renderTemplate(w, req, status, "tokens.html", page)
+}
+
+func formatDate(t time.Time, zero string) string {
+	if t.IsZero() {
+		return zero
+	}
+	return t.Format("2006-01-02 15:04 MST")
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+)
+
+func TestTokensNeedAUserAndTheAdminScope(t *testing.T) {
+	h := TokensHandler{}
+	var tests = []struct {
+		desc      string
+		principal auth.Principal
+		want      string
+	}{
+		{"read token", auth.Principal{UserId: 1, Role: auth.RoleAdmin, Via: auth.ViaToken, Scopes: []string{auth.ScopeRead}}, "permission to manage API tokens"},
+		{"client certificate", auth.Principal{Role: auth.RoleAdmin, Via: auth.ViaCertificate}, "belong to user accounts"},
+	}
+	for _, tt := range tests {
+		rec := serveAs(h, tt.principal, http.MethodGet, "/tokens", false)
+		if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), tt.want) {
+			t.Errorf("%s got %d %q, want 403 with %q", tt.desc, rec.Code, rec.Body.String(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+	"github.com/craigjperry2/mingo/internal/app/mingo/config"
+	"github.com/craigjperry2/mingo/internal/app/mingo/database"
+)
+
+// Let admins change users' roles and disable or re-enable them at /users
+// Creating users & setting passwords stays on the command line where the password can be typed privately
+type UsersHandler struct {
+	db *database.Db
+}
+
+type usersPage struct {
+	Username string
+	Users    []userRow
+	Roles    []string
+	Error    string
+}
+
+type userRow struct {
+	Username, Role, Created string
+	Disabled                bool
+	Self                    bool // admins can't demote or disable themselves, it's too easy to lock everyone out
+}
+
+func NewUsersHandler() UsersHandler {
+	return UsersHandler{config.GetInstance().GetDatabase()}
+}
+
+func (h UsersHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/users" {
+		http.NotFound(w, req)
+		return
+	}
+	if !authorize(w, req, auth.UserManage) {
+		return
+	}
+	principal, _ := auth.GetPrincipal(req.Context())
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		h.render(w, req, http.StatusOK, principal, "")
+	case http.MethodPost:
+		req.ParseForm()
+		username := req.PostFormValue("username")
+		if user, err := h.db.GetUserByUsername(req.Context(), username); err != nil {
+			h.render(w, req, http.StatusNotFound, principal, "No such user "+username)
+			return
+		} else if user.Id == principal.UserId {
+			h.render(w, req, http.StatusForbidden, principal, "You can't change your own account")
+			return
+		}
+
+		var err error
+		switch req.PostFormValue("action") {
+		case "role":
+			role, parseErr := auth.ParseRole(req.PostFormValue("role"))
+			if parseErr != nil {
+				h.render(w, req, http.StatusBadRequest, principal, "Pick a role")
+				return
+			}
+			err = h.db.SetUserRole(req.Context(), username, role)
+		case "disable":
+			err = h.db.SetUserDisabled(req.Context(), username, true)
+		case "enable":
+			err = h.db.SetUserDisabled(req.Context(), username, false)
+		default:
+			http.Error(w, "unknown action", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "unable to update user", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, req, "/users", http.StatusSeeOther)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h UsersHandler) render(w http.ResponseWriter, req *http.Request, status int, principal auth.Principal, message string) {
+	users, err := h.db.ListUsers(req.Context())
+	if err != nil {
+		http.Error(w, "unable to list users", http.StatusInternalServerError)
+		return
+	}
+	page := usersPage{Username: principal.Username, Roles: []string{auth.RoleViewer, auth.RoleEditor, auth.RoleAdmin}, Error: message}
+	for _, u := range users {
+		page.Users = append(page.Users, userRow{u.Username, u.Role, formatDate(u.CreatedAt, ""), u.Disabled, u.Id == principal.UserId})
+	}
+	renderTemplate(w, req, status, "users.html", page)
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+	"github.com/craigjperry2/mingo/internal/app/mingo/database"
+)
+
+func TestUsersAdmin(t *testing.T) {
+	ctx := context.Background()
+	db := database.NewRealDatabase(":memory:")
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("migrate err want nil, got %v", err)
+	}
+	now := time.Date(2022, 4, 30, 23, 59, 59, 0, time.UTC)
+	alice, _ := db.InsertUser(ctx, "alice", "unused", auth.RoleAdmin, now)
+	db.InsertUser(ctx, "bob", "unused", auth.RoleViewer, now)
+	h := UsersHandler{db}
+	admin := auth.Principal{UserId: alice.Id, Username: "alice", Role: auth.RoleAdmin, Via: auth.ViaSession}
+
+	var tests = []struct {
+		desc         string
+		form         string
+		wantCode     int
+		want         string // in the body
+		wantRole     string // bob's afterwards
+		wantDisabled bool
+	}{
+		{"promote", "action=role&username=bob&role=editor", http.StatusSeeOther, "", auth.RoleEditor, false},
+		{"unknown role", "action=role&username=bob&role=owner", http.StatusBadRequest, "Pick a role", auth.RoleEditor, false},
+		{"disable", "action=disable&username=bob", http.StatusSeeOther, "", auth.RoleEditor, true},
+		{"enable", "action=enable&username=bob", http.StatusSeeOther, "", auth.RoleEditor, false},
+		{"unknown action", "action=delete&username=bob", http.StatusBadRequest, "unknown action", auth.RoleEditor, false},
+		{"unknown user", "action=disable&username=carol", http.StatusNotFound, "No such user carol", auth.RoleEditor, false},
+	}
+	for _, tt := range tests {
+		rec := postUsers(h, admin, tt.form)
+		if rec.Code != tt.wantCode || !strings.Contains(rec.Body.String(), tt.want) {
+			t.Errorf("%s got %d %q, want %d with %q", tt.desc, rec.Code, rec.Body.String(), tt.wantCode, tt.want)
+		}
+		if tt.wantCode == http.StatusSeeOther && rec.Header().Get("Location") != "/users" {
+			t.Errorf("%s redirected to %q, want /users", tt.desc, rec.Header().Get("Location"))
+		}
+		if bob, _ := db.GetUserByUsername(ctx, "bob"); bob.Role != tt.wantRole || bob.Disabled != tt.wantDisabled {
+			t.Errorf("%s left bob %s disabled %v, want %s disabled %v", tt.desc, bob.Role, bob.Disabled, tt.wantRole, tt.wantDisabled)
+		}
+	}
+
+	for _, form := range []string{"action=role&username=alice&role=viewer", "action=disable&username=alice"} {
+		rec := postUsers(h, admin, form)
+		if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "You can&#39;t change your own account") {
+			t.Errorf("%s got %d %q, want 403", form, rec.Code, rec.Body.String())
+		}
+	}
+	if a, _ := db.GetUserByUsername(ctx, "alice"); a.Role != auth.RoleAdmin || a.Disabled {
+		t.Errorf("alice got %s disabled %v, want an enabled admin still", a.Role, a.Disabled)
+	}
+
+	rec := serveAs(h, admin, http.MethodGet, "/users", false)
+	if body := rec.Body.String(); rec.Code != http.StatusOK || strings.Count(body, `name="username" value="alice"`) != 0 || strings.Count(body, `name="username" value="bob"`) != 2 {
+		t.Errorf("page got %d %q, want forms for bob's role & status but none for alice's own", rec.Code, body)
+	}
+}
+
+func TestUsersNeedAnAdmin(t *testing.T) {
+	db := database.NewRealDatabase(":memory:")
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("migrate err want nil, got %v", err)
+	}
+	db.InsertUser(context.Background(), "bob", "unused", auth.RoleViewer, time.Now())
+	h := UsersHandler{db}
+
+	var tests = []struct {
+		desc      string
+		principal auth.Principal
+	}{
+		{"editor", auth.Principal{UserId: 2, Role: auth.RoleEditor, Via: auth.ViaSession}},
+		{"admin's write token", auth.Principal{UserId: 3, Role: auth.RoleAdmin, Via: auth.ViaToken, Scopes: []string{auth.ScopeWrite}}},
+	}
+	for _, tt := range tests {
+		if rec := serveAs(h, tt.principal, http.MethodGet, "/users", false); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "permission to manage users") {
+			t.Errorf("%s list got %d %q, want 403", tt.desc, rec.Code, rec.Body.String())
+		}
+		if rec := postUsers(h, tt.principal, "action=role&username=bob&role=admin"); rec.Code != http.StatusForbidden {
+			t.Errorf("%s promote got %d, want 403", tt.desc, rec.Code)
+		}
+	}
+	if bob, _ := db.GetUserByUsername(context.Background(), "bob"); bob.Role != auth.RoleViewer {
+		t.Errorf("bob got %s, want still a viewer", bob.Role)
+	}
+}
+
+func postUsers(h http.Handler, p auth.Principal, form string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(form))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(auth.WithPrincipal(req.Context(), p))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+	"github.com/craigjperry2/mingo/internal/app/mingo/config"
+	"github.com/craigjperry2/mingo/internal/app/mingo/database"
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+// A middleware that identifies the caller from their session cookie or verified client certificate, unless the
+// bearer token middleware already did. Everything except static assets, health & readiness checks and the login page requires one
+func NewAuthenticationMiddleware() middleware {
+	c := config.GetInstance()
+	return newAuthenticationMiddleware(c.GetDatabase(), c.GetClock(), c.GetClientCertRole())
+}
+
+func newAuthenticationMiddleware(db *database.Db, clock system.Clock, certRole string) middleware {
+	return func(hdlr http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if _, ok := auth.GetPrincipal(req.Context()); ok {
+				hdlr.ServeHTTP(w, req) // already identified by an API token
+				return
+			}
+			principal, ok := sessionPrincipal(db, clock, req)
+			if !ok {
+				principal, ok = certificatePrincipal(req, certRole)
+			}
+			if ok {
+				noteIdentified(req.Context())
+				if principal.Via == auth.ViaSession {
+					noteUser(req.Context(), principal.Username)
+				}
+				req = req.WithContext(auth.WithPrincipal(req.Context(), principal))
+			} else if !isPublicPath(req.URL.Path) {
+				challenge(w, req)
+				return
+			}
+			hdlr.ServeHTTP(w, req)
+		})
+	}
+}
+
+func isPublicPath(path string) bool {
+	return strings.HasPrefix(path, "/static/") || path == "/health" || path == "/ready" || path == "/login" || strings.HasPrefix(path, "/login/") || path == "/logout" || path == "/csp-report"
+}
+
+func sessionPrincipal(db *database.Db, clock system.Clock, req *http.Request) (auth.Principal, bool) {
+	cookie, err := req.Cookie(auth.SessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return auth.Principal{}, false
+	}
+	session, user, err := db.GetSession(req.Context(), auth.HashToken(cookie.Value))
+	if err != nil || user.Disabled || !clock().Before(session.ExpiresAt) {
+		return auth.Principal{}, false
+	}
+	return auth.Principal{UserId: user.Id, Username: user.Username, Via: auth.ViaSession, Role: user.Role}, true
+}
+
+// Services calling with a client certificate have no user account, they all get the --client-cert-role
+func certificatePrincipal(req *http.Request, role string) (auth.Principal, bool) {
+	subject := clientCertSubject(req)
+	if subject == "" {
+		return auth.Principal{}, false
+	}
+	return auth.Principal{Username: subject, Via: auth.ViaCertificate, Role: role}, true
+}
+
+// Send the caller to the login page in whichever way their client understands
+func challenge(w http.ResponseWriter, req *http.Request) {
+	switch {
+	case req.Header.Get("HX-Request") == "true":
+		// Return to the page hosting the fragment rather than to the fragment itself
+		next := req.URL.RequestURI()
+		if current, err := url.Parse(req.Header.Get("HX-Current-URL")); err == nil && current.Path != "" {
+			next = current.RequestURI()
+		}
+		w.Header().Set("HX-Redirect", "/login?next="+url.QueryEscape(next))
+		http.Error(w, "login required", http.StatusUnauthorized)
+	case req.URL.Path == "/api" || strings.HasPrefix(req.URL.Path, "/api/"):
+		w.Header().Set("WWW-Authenticate", `Bearer realm="mingo"`)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":"authentication required"}` + "\n"))
+	case req.Method == http.MethodGet || req.Method == http.MethodHead:
+		http.Redirect(w, req, "/login?next="+url.QueryEscape(req.URL.RequestURI()), http.StatusSeeOther)
+	default:
+		http.Error(w, "login required", http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+	"github.com/craigjperry2/mingo/internal/app/mingo/certs"
+	"github.com/craigjperry2/mingo/internal/app/mingo/database"
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+func TestAuthentication(t *testing.T) {
+	ctx := context.Background()
+	clock := system.ClockForTesting("2022-04-30T23:59:59Z")
+	db := database.NewRealDatabase(":memory:")
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("migrate err want nil, got %v", err)
+	}
+	now := clock()
+	alice, _ := db.InsertUser(ctx, "alice", "unused", "editor", now)
+	mallory, _ := db.InsertUser(ctx, "mallory", "unused", "editor", now)
+	db.SetUserDisabled(ctx, "mallory", true)
+	live, liveHash, _ := auth.NewSessionToken()
+	db.InsertSession(ctx, liveHash, alice.Id, now, now.Add(time.Hour))
+	expired, expiredHash, _ := auth.NewSessionToken()
+	db.InsertSession(ctx, expiredHash, alice.Id, now.Add(-2*time.Hour), now.Add(-time.Hour))
+	disabled, disabledHash, _ := auth.NewSessionToken()
+	db.InsertSession(ctx, disabledHash, mallory.Id, now, now.Add(time.Hour))
+
+	ca, _ := certs.NewAuthority("test CA", clock)
+	client, _ := ca.IssueClient("svc-reporting", clock)
+
+	var got auth.Principal
+	hdlr := newAuthenticationMiddleware(db, clock, auth.RoleViewer)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got, _ = auth.GetPrincipal(req.Context())
+	}))
+
+	var tests = []struct {
+		desc         string
+		method       string
+		path         string
+		token        string
+		cert         bool
+		htmx         bool
+		wantStatus   int
+		wantLocation string
+		wantUser     string
+	}{
+		{"static is public", "GET", "/static/crud.html", "", false, false, 200, "", ""},
+		{"health is public", "GET", "/health", "", false, false, 200, "", ""},
+		{"ready is public", "GET", "/ready", "", false, false, 200, "", ""},
+		{"login is public", "GET", "/login", "", false, false, 200, "", ""},
+		{"single sign-on is public", "GET", "/login/oidc/callback", "", false, false, 200, "", ""},
+		{"csp reports are public", "POST", "/csp-report", "", false, false, 200, "", ""},
+		{"page redirects to login", "GET", "/crud?limit=2", "", false, false, 303, "/login?next=%2Fcrud%3Flimit%3D2", ""},
+		{"htmx gets HX-Redirect", "DELETE", "/crud?id=1", "", false, true, 401, "", ""},
+		{"api gets 401", "GET", "/api/people", "", false, false, 401, "", ""},
+		{"form post gets 401", "POST", "/edit", "", false, false, 401, "", ""},
+		{"live session", "DELETE", "/crud?id=1", live, false, false, 200, "", "alice"},
+		{"expired session", "GET", "/crud", expired, false, false, 303, "/login?next=%2Fcrud", ""},
+		{"disabled user", "GET", "/crud", disabled, false, false, 303, "/login?next=%2Fcrud", ""},
+		{"unknown token", "GET", "/crud", "forged", false, false, 303, "/login?next=%2Fcrud", ""},
+		{"client certificate", "GET", "/api/people", "", true, false, 200, "", "CN=svc-reporting,O=mingo"},
+		{"public path still identifies", "GET", "/static/crud.html", live, false, false, 200, "", "alice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			got = auth.Principal{}
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				req.AddCookie(&http.Cookie{Name: auth.SessionCookieName, Value: tt.token})
+			}
+			if tt.cert {
+				req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{client.Cert, ca.Cert}}}
+			}
+			if tt.htmx {
+				req.Header.Set("HX-Request", "true")
+				req.Header.Set("HX-Current-URL", "https://example.com/static/crud.html")
+			}
+			rec := httptest.NewRecorder()
+			hdlr.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status got %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if loc := rec.Header().Get("Location"); loc != tt.wantLocation {
+				t.Errorf("location got %q, want %q", loc, tt.wantLocation)
+			}
+			if tt.htmx && rec.Header().Get("HX-Redirect") != "/login?next=%2Fstatic%2Fcrud.html" {
+				t.Errorf("HX-Redirect got %q, want the hosting page", rec.Header().Get("HX-Redirect"))
+			}
+			if got.Username != tt.wantUser {
+				t.Errorf("principal got %q, want %q", got.Username, tt.wantUser)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+	"github.com/craigjperry2/mingo/internal/app/mingo/config"
+	"github.com/craigjperry2/mingo/internal/app/mingo/database"
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+// A middleware that authenticates scripts by an API token sent as "Authorization: Bearer mgo_..."
+// A presented but unusable token is rejected outright rather than falling back to other credentials
+func NewBearerTokenMiddleware() middleware {
+	c := config.GetInstance()
+	return newBearerTokenMiddleware(c.GetDatabase(), c.GetClock())
+}
+
+func newBearerTokenMiddleware(db *database.Db, clock system.Clock) middleware {
+	return func(hdlr http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			scheme, token, _ := strings.Cut(req.Header.Get("Authorization"), " ")
+			if !strings.EqualFold(scheme, "Bearer") {
+				hdlr.ServeHTTP(w, req) // no header, or a scheme that isn't ours
+				return
+			}
+
+			id, secret, ok := auth.ParseApiToken(strings.TrimSpace(token))
+			if !ok {
+				bearerError(w, http.StatusUnauthorized, "invalid_token", "malformed API token")
+				return
+			}
+			noteToken(req.Context(), id)
+			t, user, err := db.GetApiToken(req.Context(), id)
+			// Compare the hashes in constant time even though the id lookup already leaks existence, the id is public
+			if err != nil || subtle.ConstantTimeCompare([]byte(t.SecretHash), []byte(auth.HashToken(secret))) != 1 {
+				bearerError(w, http.StatusUnauthorized, "invalid_token", "unknown or revoked API token")
+				return
+			}
+			now := clock().UTC()
+			if user.Disabled || (!t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt)) {
+				bearerError(w, http.StatusUnauthorized, "invalid_token", "expired API token")
+				return
+			}
+			db.TouchApiToken(req.Context(), id, now)
+
+			principal := auth.Principal{UserId: user.Id, Username: user.Username, Via: auth.ViaToken, Role: user.Role, TokenId: id, Scopes: t.Scopes}
+			noteUser(req.Context(), principal.Username)
+			noteIdentified(req.Context())
+			if !principal.Allows(auth.ScopeForMethod(req.Method)) {
+				bearerError(w, http.StatusForbidden, "insufficient_scope", "API token lacks the "+auth.ScopeForMethod(req.Method)+" scope")
+				return
+			}
+			hdlr.ServeHTTP(w, req.WithContext(auth.WithPrincipal(req.Context(), principal)))
+		})
+	}
+}
+
+// Errors per RFC 6750, the body is JSON as bearer clients are scripts rather than browsers
+func bearerError(w http.ResponseWriter, status int, code string, description string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="mingo", error="`+code+`", error_description="`+description+`"`)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": description})
+}
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo"
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+	"github.com/craigjperry2/mingo/internal/app/mingo/database"
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+func TestBearerToken(t *testing.T) {
+	ctx := context.Background()
+	clock := system.ClockForTesting("2022-04-30T23:59:59Z")
+	db := database.NewRealDatabase(":memory:")
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("migrate err want nil, got %v", err)
+	}
+	now := clock()
+	alice, _ := db.InsertUser(ctx, "alice", "unused", "editor", now)
+	mallory, _ := db.InsertUser(ctx, "mallory", "unused", "editor", now)
+	db.SetUserDisabled(ctx, "mallory", true)
+
+	newToken := func(userId int, scopes []string, expires time.Time) (string, string) {
+		token, id, secretHash, _ := auth.NewApiToken()
+		db.InsertApiToken(ctx, mingo.ApiToken{Id: id, UserId: userId, Name: "test", SecretHash: secretHash, Scopes: scopes, CreatedAt: now, ExpiresAt: expires})
+		return token, id
+	}
+	reader, readerId := newToken(alice.Id, []string{auth.ScopeRead}, time.Time{})
+	writer, _ := newToken(alice.Id, []string{auth.ScopeWrite}, now.Add(time.Hour))
+	expired, _ := newToken(alice.Id, []string{auth.ScopeWrite}, now.Add(-time.Hour))
+	disabled, _ := newToken(mallory.Id, []string{auth.ScopeWrite}, time.Time{})
+	forged := reader[:len(reader)-4] + "AAAA"
+
+	var got auth.Principal
+	hdlr := newBearerTokenMiddleware(db, clock)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got, _ = auth.GetPrincipal(req.Context())
+	}))
+
+	var tests = []struct {
+		desc       string
+		method     string
+		header     string
+		wantStatus int
+		wantUser   string
+	}{
+		{"no header passes through", "GET", "", 200, ""},
+		{"basic auth passes through", "GET", "Basic YWxpY2U6cHc=", 200, ""},
+		{"read token reads", "GET", "Bearer " + reader, 200, "alice"},
+		{"scheme is case insensitive", "GET", "bearer " + reader, 200, "alice"},
+		{"read token can't write", "DELETE", "Bearer " + reader, 403, ""},
+		{"write token writes", "DELETE", "Bearer " + writer, 200, "alice"},
+		{"expired token", "GET", "Bearer " + expired, 401, ""},
+		{"disabled user", "GET", "Bearer " + disabled, 401, ""},
+		{"forged secret", "GET", "Bearer " + forged, 401, ""},
+		{"malformed", "GET", "Bearer hunter2", 401, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			got = auth.Principal{}
+			req := httptest.NewRequest(tt.method, "/crud?id=1", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			hdlr.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status got %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got.Username != tt.wantUser {
+				t.Errorf("principal got %q, want %q", got.Username, tt.wantUser)
+			}
+			if rec.Code >= 400 && !strings.HasPrefix(rec.Header().Get("WWW-Authenticate"), "Bearer ") {
+				t.Errorf("WWW-Authenticate got %q, want a Bearer challenge", rec.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+
+	if tok, _, _ := db.GetApiToken(ctx, readerId); !tok.LastUsedAt.Equal(now) {
+		t.Errorf("last used got %v, want %v", tok.LastUsedAt, now)
+	}
+}
+
+func TestAccessNoteRecordsTokenId(t *testing.T) {
+	note := &accessNote{}
+	ctx := context.WithValue(context.Background(), accessNoteKey{}, note)
+	noteToken(ctx, "0123456789abcdef")
+	noteUser(ctx, "alice")
+	if note.token != "0123456789abcdef" || note.user != "alice" {
+		t.Errorf("note got %+v, want token id and user", note)
+	}
+}
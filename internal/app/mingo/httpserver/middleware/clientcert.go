@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/config"
+)
+
+type clientSubjectKey struct{}
+
+// A middleware that requires a verified client certificate for requests under the configured path prefixes
+// Other routes accept a client certificate if presented but don't require one, e.g. the browser UI
+func NewClientCertMiddleware() middleware {
+	c := config.GetInstance()
+	if c.GetTlsClientCaFile() == "" {
+		return newClientCertMiddleware(nil)
+	}
+	return newClientCertMiddleware(c.GetClientCertPaths())
+}
+
+func newClientCertMiddleware(requiredPrefixes []string) middleware {
+	return func(hdlr http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			subject := clientCertSubject(req)
+			if subject == "" && hasAnyPrefix(req.URL.Path, requiredPrefixes) {
+				http.Error(w, "client certificate required", http.StatusForbidden)
+				return
+			}
+			if subject != "" {
+				req = req.WithContext(context.WithValue(req.Context(), clientSubjectKey{}, subject))
+			}
+			hdlr.ServeHTTP(w, req)
+		})
+	}
+}
+
+// GetClientSubject returns the distinguished name of the verified client certificate, or "" if there wasn't one
+func GetClientSubject(ctx context.Context) string {
+	subject, _ := ctx.Value(clientSubjectKey{}).(string)
+	return subject
+}
+
+// Only certificates that chained to the client CA count, the handshake allows a connection without one
+func clientCertSubject(req *http.Request) string {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return req.TLS.VerifiedChains[0][0].Subject.String()
+}
+
+func hasAnyPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) || path+"/" == prefix {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/certs"
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+func TestClientCertRequiredPerRoute(t *testing.T) {
+	clock := system.ClockForTesting("2022-04-30T23:59:59Z")
+	ca, _ := certs.NewAuthority("test CA", clock)
+	client, _ := ca.IssueClient("svc-reporting", clock)
+
+	var gotSubject string
+	hdlr := newClientCertMiddleware([]string{"/api/"})(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		gotSubject = GetClientSubject(req.Context())
+	}))
+
+	var tests = []struct {
+		desc        string
+		path        string
+		verified    *x509.Certificate
+		wantStatus  int
+		wantSubject string
+	}{
+		{"api with cert", "/api/people", client.Cert, 200, "CN=svc-reporting,O=mingo"},
+		{"api without cert", "/api/people", nil, 403, ""},
+		{"api root without cert", "/api", nil, 403, ""},
+		{"ui without cert", "/crud", nil, 200, ""},
+		{"ui with cert", "/crud", client.Cert, 200, "CN=svc-reporting,O=mingo"},
+		{"lookalike prefix", "/apiary", nil, 200, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			gotSubject = ""
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.TLS = &tls.ConnectionState{}
+			if tt.verified != nil {
+				req.TLS.PeerCertificates = []*x509.Certificate{tt.verified}
+				req.TLS.VerifiedChains = [][]*x509.Certificate{{tt.verified, ca.Cert}}
+			}
+			rec := httptest.NewRecorder()
+			hdlr.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status got %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if gotSubject != tt.wantSubject {
+				t.Errorf("subject got %q, want %q", gotSubject, tt.wantSubject)
+			}
+		})
+	}
+}
+
+func TestUnverifiedClientCertIsIgnored(t *testing.T) {
+	clock := system.ClockForTesting("2022-04-30T23:59:59Z")
+	rogue, _ := certs.NewAuthority("rogue", clock)
+
+	hdlr := newClientCertMiddleware([]string{"/api/"})(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "/api/people", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{rogue.Cert}}
+	rec := httptest.NewRecorder()
+	hdlr.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status got %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
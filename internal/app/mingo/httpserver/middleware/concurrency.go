@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/config"
+	"github.com/craigjperry2/mingo/internal/app/mingo/logger"
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+// A middleware that sheds load: past maxInFlight concurrent requests, further ones get a quick 503
+// with Retry-After instead of queueing up behind a server that's already struggling
+// /health and /ready are never shed, an orchestrator probing them would otherwise restart a merely busy server
+func NewConcurrencyLimitMiddleware() middleware {
+	c := config.GetInstance()
+	return newConcurrencyLimitMiddleware(c.GetMaxInFlight(), c.GetClock(),
+		logger.NewComponentLogger(c.GetClock(), c.GetLoggingDestination(), c.GetHostname(), "throttle"))
+}
+
+func newConcurrencyLimitMiddleware(maxInFlight int, clock system.Clock, log *log.Logger) middleware {
+	return func(hdlr http.Handler) http.Handler {
+		if maxInFlight <= 0 {
+			return hdlr
+		}
+		slots := make(chan struct{}, maxInFlight)
+		shedLog := &shedLogger{log: log, clock: clock}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/health" || req.URL.Path == "/ready" {
+				hdlr.ServeHTTP(w, req)
+				return
+			}
+			select {
+			case slots <- struct{}{}:
+				throttleMetrics.Add("in_flight", 1)
+				defer func() {
+					throttleMetrics.Add("in_flight", -1)
+					<-slots
+				}()
+				hdlr.ServeHTTP(w, req)
+			default:
+				throttleMetrics.Add("shed", 1)
+				shedLog.shed(maxInFlight)
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "server busy, try again shortly", http.StatusServiceUnavailable)
+			}
+		})
+	}
+}
+
+// Summarise shedding at most once a second, under overload a line per request would make things worse
+type shedLogger struct {
+	log    *log.Logger
+	clock  system.Clock
+	mu     sync.Mutex
+	last   time.Time
+	missed int
+}
+
+func (s *shedLogger) shed(maxInFlight int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.clock()
+	if now.Sub(s.last) < time.Second {
+		s.missed++
+		return
+	}
+	logger.Warnf(s.log, "shedding load, %d requests in flight, %d more shed since the last report", maxInFlight, s.missed)
+	s.last, s.missed = now, 0
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimitShedsLoad(t *testing.T) {
+	var logged bytes.Buffer
+	entered, release := make(chan struct{}), make(chan struct{})
+	hdlr := newConcurrencyLimitMiddleware(2, time.Now, log.New(&logged, "", 0))(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/slow" {
+			entered <- struct{}{}
+			<-release
+		}
+	}))
+	serve := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		hdlr.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serve("/slow")
+		}()
+		<-entered
+	}
+
+	w := serve("/crud")
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("over the limit got %d Retry-After %q, want 503 after 1", w.Code, w.Header().Get("Retry-After"))
+	}
+	serve("/crud")
+	if n := strings.Count(logged.String(), "shedding load"); n != 1 {
+		t.Errorf("log lines got %d in %q, want 1 per second", n, logged.String())
+	}
+	if w := serve("/health"); w.Code != http.StatusOK {
+		t.Errorf("health while busy got %d, want 200", w.Code)
+	}
+	if w := serve("/ready"); w.Code != http.StatusOK {
+		t.Errorf("ready while busy got %d, want 200", w.Code)
+	}
+
+	close(release)
+	wg.Wait()
+	if w := serve("/crud"); w.Code != http.StatusOK {
+		t.Errorf("after the load got %d, want 200", w.Code)
+	}
+}
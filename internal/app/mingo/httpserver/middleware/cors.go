@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/config"
+	"github.com/craigjperry2/mingo/internal/app/mingo/cors"
+)
+
+// A middleware that lets browser scripts on other origins call the URL prefixes a --cors policy covers
+// Preflight requests are answered here, before authentication, since browsers send them without credentials
+func NewCorsMiddleware() middleware {
+	return newCorsMiddleware(config.GetInstance().GetCorsPolicies())
+}
+
+func newCorsMiddleware(policies cors.Policies) middleware {
+	return func(hdlr http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			policy, ok := policies.For(req.URL.Path)
+			if !ok {
+				hdlr.ServeHTTP(w, req)
+				return
+			}
+			h := w.Header()
+			h.Add("Vary", "Origin") // caches mustn't hand one origin's answer to another
+			origin := req.Header.Get("Origin")
+
+			if requestedMethod := req.Header.Get("Access-Control-Request-Method"); req.Method == http.MethodOptions && origin != "" && requestedMethod != "" {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+				if !policy.AllowsOrigin(origin) || !policy.AllowsMethod(requestedMethod) || !policy.AllowsHeaders(req.Header.Get("Access-Control-Request-Headers")) {
+					// Without the allow headers the browser refuses, the status is for whoever reads the access log
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				allowOrigin(h, policy, origin)
+				h.Set("Access-Control-Allow-Methods", strings.Join(policy.Methods, ", "))
+				if len(policy.Headers) > 0 {
+					h.Set("Access-Control-Allow-Headers", strings.Join(policy.Headers, ", "))
+				}
+				if policy.MaxAge > 0 {
+					h.Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge.Seconds())))
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			if origin != "" && policy.AllowsOrigin(origin) {
+				allowOrigin(h, policy, origin)
+				if len(policy.Expose) > 0 {
+					h.Set("Access-Control-Expose-Headers", strings.Join(policy.Expose, ", "))
+				}
+			}
+			hdlr.ServeHTTP(w, req)
+		})
+	}
+}
+
+// The origin is echoed rather than "*", which browsers refuse for a request with credentials or
+// an Authorization header
+func allowOrigin(h http.Header, policy cors.Policy, origin string) {
+	h.Set("Access-Control-Allow-Origin", origin)
+	if policy.Credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/cors"
+)
+
+func TestCors(t *testing.T) {
+	policies := cors.Policies{
+		{Prefix: "/api/", Origins: []string{"https://*.example.com"}, Methods: []string{"GET", "POST", "DELETE"}, Headers: []string{"Content-Type", "Authorization"}, Expose: []string{"Location"}, Credentials: true, MaxAge: 10 * time.Minute},
+		{Prefix: "/api/public/", Origins: []string{"*"}, Methods: []string{"GET"}},
+	}
+	reached := false
+	hdlr := newCorsMiddleware(policies)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { reached = true }))
+
+	var tests = []struct {
+		desc        string
+		method      string
+		path        string
+		headers     map[string]string
+		wantStatus  int
+		wantReached bool
+		wantHeaders map[string]string
+	}{
+		{"preflight", "OPTIONS", "/api/people", map[string]string{"Origin": "https://app.example.com", "Access-Control-Request-Method": "DELETE", "Access-Control-Request-Headers": "authorization,content-type"}, 204, false,
+			map[string]string{"Access-Control-Allow-Origin": "https://app.example.com", "Access-Control-Allow-Methods": "GET, POST, DELETE", "Access-Control-Allow-Headers": "Content-Type, Authorization", "Access-Control-Allow-Credentials": "true", "Access-Control-Max-Age": "600"}},
+		{"preflight from unknown origin", "OPTIONS", "/api/people", map[string]string{"Origin": "https://evil.test", "Access-Control-Request-Method": "GET"}, 403, false,
+			map[string]string{"Access-Control-Allow-Origin": ""}},
+		{"preflight for unlisted method", "OPTIONS", "/api/people", map[string]string{"Origin": "https://app.example.com", "Access-Control-Request-Method": "PUT"}, 403, false, nil},
+		{"preflight for unlisted header", "OPTIONS", "/api/people", map[string]string{"Origin": "https://app.example.com", "Access-Control-Request-Method": "GET", "Access-Control-Request-Headers": "x-secret"}, 403, false, nil},
+		{"plain options reaches the handler", "OPTIONS", "/api/people", nil, 200, true, nil},
+		{"actual request", "GET", "/api/people", map[string]string{"Origin": "https://app.example.com"}, 200, true,
+			map[string]string{"Access-Control-Allow-Origin": "https://app.example.com", "Access-Control-Allow-Credentials": "true", "Access-Control-Expose-Headers": "Location"}},
+		{"actual request from unknown origin", "GET", "/api/people", map[string]string{"Origin": "https://evil.test"}, 200, true,
+			map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Allow-Credentials": ""}},
+		{"longest prefix wins", "GET", "/api/public/x", map[string]string{"Origin": "https://evil.test"}, 200, true,
+			map[string]string{"Access-Control-Allow-Origin": "https://evil.test", "Access-Control-Allow-Credentials": ""}},
+		{"uncovered path", "OPTIONS", "/crud", map[string]string{"Origin": "https://app.example.com", "Access-Control-Request-Method": "GET"}, 200, true,
+			map[string]string{"Access-Control-Allow-Origin": "", "Vary": ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			reached = false
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			hdlr.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus || reached != tt.wantReached {
+				t.Errorf("got %d reached %v, want %d reached %v", rec.Code, reached, tt.wantStatus, tt.wantReached)
+			}
+			for k, v := range tt.wantHeaders {
+				if got := rec.Header().Get(k); got != v {
+					t.Errorf("%s got %q, want %q", k, got, v)
+				}
+			}
+			if tt.path != "/crud" && rec.Header().Values("Vary")[0] != "Origin" {
+				t.Errorf("Vary got %q, want Origin", rec.Header().Values("Vary"))
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"encoding/json"
+	"html"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+	"github.com/craigjperry2/mingo/internal/app/mingo/config"
+)
+
+// A middleware that rejects cross-site state changes. Requests other than GET, HEAD & OPTIONS must come
+// from this origin, per the browser's Sec-Fetch-Site or Origin header, and when made with a login session
+// must also echo the session's CSRF token. It also hands the token to pages in a script-readable cookie
+// API token callers are exempt, a bearer token isn't sent by the browser on its own
+// Behind a trusted reverse proxy this origin is the one the proxy was asked for, per X-Forwarded-Proto & -Host
+func NewCsrfMiddleware() middleware {
+	c := config.GetInstance()
+	return newCsrfMiddleware(c.IsTlsEnabled(), c.GetTrustedProxies())
+}
+
+func newCsrfMiddleware(secure bool, trusted []*net.IPNet) middleware {
+	return func(hdlr http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			principal, _ := auth.GetPrincipal(req.Context())
+			sessionToken := ""
+			if principal.Via == auth.ViaSession {
+				if cookie, err := req.Cookie(auth.SessionCookieName); err == nil {
+					sessionToken = cookie.Value
+				}
+			}
+
+			if isSafeMethod(req.Method) {
+				if sessionToken != "" {
+					offerCsrfCookie(w, req, sessionToken, secure || requestScheme(req, trusted) == "https")
+				}
+				hdlr.ServeHTTP(w, req)
+				return
+			}
+			// Browsers post violation reports without a token, and a forged one only adds a log line
+			if principal.Via == auth.ViaToken || req.URL.Path == "/csp-report" {
+				hdlr.ServeHTTP(w, req)
+				return
+			}
+			if reason := crossSiteReason(req, trusted); reason != "" {
+				csrfError(w, req, reason)
+				return
+			}
+			if sessionToken != "" && !auth.ValidCsrfToken(sessionToken, presentedCsrfToken(req)) {
+				csrfError(w, req, "missing or stale CSRF token, reload the page and try again")
+				return
+			}
+			hdlr.ServeHTTP(w, req)
+		})
+	}
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// Set the CSRF cookie unless the browser already holds the current one, e.g. after logging in again
+func offerCsrfCookie(w http.ResponseWriter, req *http.Request, sessionToken string, secure bool) {
+	token := auth.CsrfToken(sessionToken)
+	if cookie, err := req.Cookie(auth.CsrfCookieName); err == nil && cookie.Value == token {
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.CsrfCookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: false, // the page's script copies it into the X-CSRF-Token header
+		Secure:   secure,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// Browsers send Sec-Fetch-Site, older ones at least Origin. Clients sending neither aren't browsers
+// and so can't be tricked into a cross-site request
+func crossSiteReason(req *http.Request, trusted []*net.IPNet) string {
+	switch site := req.Header.Get("Sec-Fetch-Site"); site {
+	case "", "same-origin", "none":
+	default:
+		return "cross-site request (Sec-Fetch-Site: " + site + ")"
+	}
+
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return ""
+	}
+	u, err := url.Parse(origin)
+	if err != nil || !strings.EqualFold(u.Host, requestHost(req, trusted)) || u.Scheme != requestScheme(req, trusted) {
+		return "cross-origin request from " + origin
+	}
+	return ""
+}
+
+// The scheme & host the browser used, a TLS terminating proxy in front says which in X-Forwarded-Proto & -Host
+func requestScheme(req *http.Request, trusted []*net.IPNet) string {
+	if proto := forwarded(req, "X-Forwarded-Proto", trusted); proto == "http" || proto == "https" {
+		return proto
+	}
+	if req.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+func requestHost(req *http.Request, trusted []*net.IPNet) string {
+	if host := forwarded(req, "X-Forwarded-Host", trusted); host != "" {
+		return host
+	}
+	return req.Host
+}
+
+// The value the nearest proxy set, only believed from a trusted peer, the client may have sent its own ahead of it
+func forwarded(req *http.Request, name string, trusted []*net.IPNet) string {
+	if !isTrusted(remoteIp(req.RemoteAddr), trusted) {
+		return ""
+	}
+	values := strings.Split(strings.Join(req.Header.Values(name), ","), ",")
+	return strings.ToLower(strings.TrimSpace(values[len(values)-1]))
+}
+
+// The header is set by htmx requests, plain HTML forms carry a hidden field instead
+func presentedCsrfToken(req *http.Request) string {
+	if token := req.Header.Get(auth.CsrfHeader); token != "" {
+		return token
+	}
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		return req.PostFormValue(auth.CsrfFormField) // handlers can still read the parsed form
+	}
+	return ""
+}
+
+func csrfError(w http.ResponseWriter, req *http.Request, reason string) {
+	message := "Request rejected: " + reason
+	switch {
+	case req.Header.Get("HX-Request") == "true":
+		w.Header().Set("HX-Retarget", "#flash")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`<div id="flash" class="notification is-danger is-light">` + html.EscapeString(message) + `</div>`))
+	case req.URL.Path == "/api" || strings.HasPrefix(req.URL.Path, "/api/"):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+	default:
+		http.Error(w, message, http.StatusForbidden)
+	}
+}
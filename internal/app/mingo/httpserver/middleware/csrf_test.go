@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+)
+
+func TestCsrf(t *testing.T) {
+	const session = "session-token"
+	token := auth.CsrfToken(session)
+	hdlr := newCsrfMiddleware(false, nil)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+
+	var tests = []struct {
+		desc       string
+		method     string
+		via        string
+		headers    map[string]string
+		form       string
+		wantStatus int
+	}{
+		{"reads need no token", "GET", auth.ViaSession, nil, "", 200},
+		{"session write without token", "DELETE", auth.ViaSession, nil, "", 403},
+		{"session write with header", "DELETE", auth.ViaSession, map[string]string{"X-CSRF-Token": token}, "", 200},
+		{"session write with wrong header", "DELETE", auth.ViaSession, map[string]string{"X-CSRF-Token": auth.CsrfToken("other")}, "", 403},
+		{"session form post with field", "POST", auth.ViaSession, nil, "csrf_token=" + token, 200},
+		{"same origin", "POST", auth.ViaSession, map[string]string{"X-CSRF-Token": token, "Origin": "http://mingo.test", "Sec-Fetch-Site": "same-origin"}, "", 200},
+		{"cross origin", "POST", auth.ViaSession, map[string]string{"X-CSRF-Token": token, "Origin": "http://evil.test"}, "", 403},
+		{"opaque origin", "POST", auth.ViaSession, map[string]string{"X-CSRF-Token": token, "Origin": "null"}, "", 403},
+		{"other scheme", "POST", auth.ViaSession, map[string]string{"X-CSRF-Token": token, "Origin": "https://mingo.test"}, "", 403},
+		{"cross site fetch", "POST", auth.ViaSession, map[string]string{"X-CSRF-Token": token, "Sec-Fetch-Site": "cross-site"}, "", 403},
+		{"sibling site fetch", "POST", auth.ViaSession, map[string]string{"X-CSRF-Token": token, "Sec-Fetch-Site": "same-site"}, "", 403},
+		{"cross site login", "POST", "", map[string]string{"Origin": "http://evil.test"}, "", 403},
+		{"anonymous same origin login", "POST", "", map[string]string{"Origin": "http://mingo.test"}, "", 200},
+		{"api token needs no csrf token", "DELETE", auth.ViaToken, nil, "", 200},
+		{"certificate needs no csrf token", "DELETE", auth.ViaCertificate, nil, "", 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "http://mingo.test/crud", strings.NewReader(tt.form))
+			if tt.form != "" {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			if tt.via != "" {
+				req.AddCookie(&http.Cookie{Name: auth.SessionCookieName, Value: session})
+				req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{UserId: 1, Username: "alice", Via: tt.via}))
+			}
+			w := httptest.NewRecorder()
+			hdlr.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status got %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
+
+// A TLS terminating proxy at mingo.example.com forwards plain HTTP to this server at 10.0.0.5:8080
+func TestCsrfBehindProxy(t *testing.T) {
+	const session = "session-token"
+	token := auth.CsrfToken(session)
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	hdlr := newCsrfMiddleware(false, []*net.IPNet{proxies})(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+
+	var tests = []struct {
+		desc       string
+		method     string
+		remoteAddr string
+		origin     string
+		forwarded  map[string]string
+		wantStatus int
+	}{
+		{"htmx write through the proxy", "DELETE", "10.0.0.1:1234", "https://mingo.example.com", map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "mingo.example.com"}, 200},
+		{"forwarded host in another case", "DELETE", "10.0.0.1:1234", "https://mingo.example.com", map[string]string{"X-Forwarded-Proto": "HTTPS", "X-Forwarded-Host": "Mingo.Example.com"}, 200},
+		{"nearest proxy's value wins", "DELETE", "10.0.0.1:1234", "https://mingo.example.com", map[string]string{"X-Forwarded-Proto": "http, https", "X-Forwarded-Host": "evil.test, mingo.example.com"}, 200},
+		{"cross origin through the proxy", "DELETE", "10.0.0.1:1234", "https://evil.test", map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "mingo.example.com"}, 403},
+		{"proxy without the headers", "DELETE", "10.0.0.1:1234", "https://mingo.example.com", nil, 403},
+		{"untrusted peer can't claim the origin", "DELETE", "192.0.2.1:1234", "https://evil.test", map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "evil.test"}, 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "http://10.0.0.5:8080/crud?id=1", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("HX-Request", "true")
+			req.Header.Set("X-CSRF-Token", token)
+			req.Header.Set("Sec-Fetch-Site", "same-origin")
+			req.Header.Set("Origin", tt.origin)
+			for k, v := range tt.forwarded {
+				req.Header.Set(k, v)
+			}
+			req.AddCookie(&http.Cookie{Name: auth.SessionCookieName, Value: session})
+			req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{UserId: 1, Via: auth.ViaSession}))
+			w := httptest.NewRecorder()
+			hdlr.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status got %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+
+	req := httptest.NewRequest("GET", "http://10.0.0.5:8080/static/crud.html", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.AddCookie(&http.Cookie{Name: auth.SessionCookieName, Value: session})
+	req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{UserId: 1, Via: auth.ViaSession}))
+	w := httptest.NewRecorder()
+	hdlr.ServeHTTP(w, req)
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || !cookies[0].Secure {
+		t.Errorf("cookies got %v, want a secure one since the browser is on https", cookies)
+	}
+}
+
+func TestCsrfCookieOfferedToSessions(t *testing.T) {
+	const session = "session-token"
+	hdlr := newCsrfMiddleware(true, nil)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	get := func(cookies ...*http.Cookie) *http.Response {
+		req := httptest.NewRequest("GET", "https://mingo.test/static/crud.html", nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{UserId: 1, Via: auth.ViaSession}))
+		w := httptest.NewRecorder()
+		hdlr.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	sessionCookie := &http.Cookie{Name: auth.SessionCookieName, Value: session}
+	cookies := get(sessionCookie).Cookies()
+	if len(cookies) != 1 || cookies[0].Name != auth.CsrfCookieName || cookies[0].Value != auth.CsrfToken(session) || cookies[0].HttpOnly || !cookies[0].Secure {
+		t.Fatalf("cookies got %v, want a script readable, secure %s cookie", cookies, auth.CsrfCookieName)
+	}
+	if again := get(sessionCookie, cookies[0]).Cookies(); len(again) != 0 {
+		t.Errorf("cookies got %v, want none once the browser holds the current token", again)
+	}
+}
+
+func TestCsrfRejectionForHtmx(t *testing.T) {
+	hdlr := newCsrfMiddleware(false, nil)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	req := httptest.NewRequest("DELETE", "http://mingo.test/crud?id=1", nil)
+	req.Header.Set("HX-Request", "true")
+	req.AddCookie(&http.Cookie{Name: auth.SessionCookieName, Value: "session-token"})
+	req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{UserId: 1, Via: auth.ViaSession}))
+	w := httptest.NewRecorder()
+	hdlr.ServeHTTP(w, req)
+	if w.Code != 403 || w.Header().Get("HX-Retarget") != "#flash" || !strings.Contains(w.Body.String(), "CSRF token") {
+		t.Errorf("got %d %q %q, want 403 retargeted to #flash explaining the CSRF token", w.Code, w.Header().Get("HX-Retarget"), w.Body.String())
+	}
+}
@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// A middleware that gives each request's context a deadline a little short of the server's write
+// timeout, so a slow database call is abandoned while there's still time to answer with a 503
+// rather than the connection being cut with nothing written
+func NewDeadlineMiddleware(timeout time.Duration) middleware {
+	return func(hdlr http.Handler) http.Handler {
+		if timeout <= 0 {
+			return hdlr
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx, cancel := context.WithTimeout(req.Context(), timeout)
+			defer cancel()
+			hdlr.ServeHTTP(w, req.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeadline(t *testing.T) {
+	var deadline time.Time
+	var ok bool
+	hdlr := NewDeadlineMiddleware(time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		deadline, ok = req.Context().Deadline()
+	}))
+	hdlr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/crud", nil))
+
+	if !ok {
+		t.Fatal("request context has no deadline")
+	}
+	if until := time.Until(deadline); until <= 0 || until > time.Minute {
+		t.Errorf("deadline is %v away, want within a minute", until)
+	}
+}
+
+func TestNoDeadlineWhenDisabled(t *testing.T) {
+	hdlr := NewDeadlineMiddleware(0)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if _, ok := req.Context().Deadline(); ok {
+			t.Error("request context has a deadline")
+		}
+	}))
+	hdlr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/crud", nil))
+}
@@ -1,57 +1,112 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
+	"strings"
 
 	"github.com/craigjperry2/mingo/internal/app/mingo/config"
 	"github.com/craigjperry2/mingo/internal/app/mingo/logger"
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
 )
 
-// A middleware that can log accesses
+// A middleware that can log accesses, in the --access-log-format, skipping --access-log-exclude paths
 func NewLoggingMiddleware() middleware {
-	clock := config.GetInstance().GetClock()
-	loggingDestination := config.GetInstance().GetLoggingDestination()
-	hostname := config.GetInstance().GetHostname()
-
-	accessLogger := logger.NewComponentLogger(clock, loggingDestination, hostname, "access")
+	c := config.GetInstance()
+	return newLoggingMiddleware(c.GetClock(), logger.NewAccessLogger(c.GetAccessLogFormat(), c.GetClock(), c.GetAccessLogDestination(), c.GetHostname()), c.GetAccessLogExclude())
+}
 
+func newLoggingMiddleware(clock system.Clock, accessLogger *logger.AccessLogger, exclude []string) middleware {
 	return func(hdlr http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			for _, prefix := range exclude {
+				if strings.HasPrefix(req.URL.Path, prefix) {
+					hdlr.ServeHTTP(w, req)
+					return
+				}
+			}
 			start := clock().UTC()
 			lrw := NewLoggingResponseWriter(w)
+			note := &accessNote{}
+			req = req.WithContext(context.WithValue(req.Context(), accessNoteKey{}, note))
 			defer func() {
-				requestID := w.Header().Get("X-Request-Id")
-				if requestID == "" {
-					requestID = "unknown"
-				}
 				var pathWithQuery string
 				if req.URL.RawQuery != "" {
 					pathWithQuery = req.URL.Path + "?" + req.URL.RawQuery
 				} else {
 					pathWithQuery = req.URL.Path
 				}
-				accessLogger.Println(requestID, req.Method, lrw.statusCode, pathWithQuery, req.RemoteAddr, req.UserAgent(), clock().UTC().Sub(start))
-
+				accessLogger.Log(logger.AccessEntry{
+					Time:       start,
+					RequestId:  logger.RequestId(req.Context()),
+					RemoteAddr: req.RemoteAddr,
+					Method:     req.Method,
+					Uri:        pathWithQuery,
+					Proto:      req.Proto,
+					Status:     lrw.statusCode,
+					Bytes:      lrw.bytes,
+					Duration:   clock().UTC().Sub(start),
+					User:       note.user,
+					Token:      note.token,
+					ClientCert: clientCertSubject(req),
+					Referer:    req.Referer(),
+					UserAgent:  req.UserAgent(),
+				})
 			}()
 			hdlr.ServeHTTP(lrw, req)
 		})
 	}
 }
 
+// Details learned by inner middlewares that belong on the access log line, e.g. who made the request
+// Inner middlewares can't change the request the logging middleware holds so it shares a pointer instead
+type accessNote struct {
+	user  string
+	token string // API token id, never the secret
+}
+
+type accessNoteKey struct{}
+
+func noteUser(ctx context.Context, user string) {
+	if note, ok := ctx.Value(accessNoteKey{}).(*accessNote); ok {
+		note.user = user
+	}
+}
+
+func noteToken(ctx context.Context, tokenId string) {
+	if note, ok := ctx.Value(accessNoteKey{}).(*accessNote); ok {
+		note.token = tokenId
+	}
+}
+
 // I want to log the HTTP Status code of each request
 // with thanks to https://gist.github.com/Boerworz/b683e46ae0761056a636
 type loggingResponseWriter struct {
 	http.ResponseWriter
 	statusCode int
+	bytes      int64 // of the body, for the access log
 }
 
 func NewLoggingResponseWriter(w http.ResponseWriter) *loggingResponseWriter {
 	// WriteHeader(int) is not called if our response implicitly returns 200 OK, so
 	// we default to that status code.
-	return &loggingResponseWriter{w, http.StatusOK}
+	return &loggingResponseWriter{w, http.StatusOK, 0}
 }
 
 func (lrw *loggingResponseWriter) WriteHeader(code int) {
 	lrw.statusCode = code
 	lrw.ResponseWriter.WriteHeader(code)
 }
+
+func (lrw *loggingResponseWriter) Write(b []byte) (int, error) {
+	n, err := lrw.ResponseWriter.Write(b)
+	lrw.bytes += int64(n)
+	return n, err
+}
+
+// Pass flushes through for streamed responses, e.g. the live log
+func (lrw *loggingResponseWriter) Flush() {
+	if f, ok := lrw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
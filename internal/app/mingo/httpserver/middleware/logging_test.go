@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/logger"
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+func TestAccessLog(t *testing.T) {
+	var logged bytes.Buffer
+	clock := system.ClockForTesting("2022-04-30T23:59:59Z")
+	hdlr := newTracingMiddleware(func() string { return "req-42" }, nil, log.New(io.Discard, "", 0))(
+		newLoggingMiddleware(clock, logger.NewAccessLogger(logger.AccessJson, clock, &logged, "testhost"), []string{"/health", "/static/"})(
+			http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				noteUser(req.Context(), "alice")
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte("hello, "))
+				w.Write([]byte("world"))
+			})))
+
+	for _, path := range []string{"/health", "/static/crud.html", "/api/people?limit=2"} {
+		hdlr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", path, nil))
+	}
+
+	var entry struct {
+		RequestId string `json:"request_id"`
+		Uri       string `json:"uri"`
+		Status    int    `json:"status"`
+		Bytes     int64  `json:"bytes"`
+		User      string `json:"user"`
+	}
+	if err := json.Unmarshal(logged.Bytes(), &entry); err != nil {
+		t.Fatalf("want exactly one JSON line, got %q: %v", logged.String(), err)
+	}
+	if entry.RequestId != "req-42" || entry.Uri != "/api/people?limit=2" || entry.Status != http.StatusCreated || entry.Bytes != 12 || entry.User != "alice" {
+		t.Errorf("got %+v", entry)
+	}
+}
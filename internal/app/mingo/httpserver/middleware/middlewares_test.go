@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo"
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+	"github.com/craigjperry2/mingo/internal/app/mingo/cors"
+	"github.com/craigjperry2/mingo/internal/app/mingo/database"
+	"github.com/craigjperry2/mingo/internal/app/mingo/logger"
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+// A script on a sibling origin calling the API through every middleware, in MakeHttpServer's order
+func TestCrossOriginThroughTheChain(t *testing.T) {
+	ctx := context.Background()
+	clock := system.ClockForTesting("2022-04-30T23:59:59Z")
+	db := database.NewRealDatabase(":memory:")
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("migrate err want nil, got %v", err)
+	}
+	now := clock()
+	alice, _ := db.InsertUser(ctx, "alice", "unused", "editor", now)
+	token, id, secretHash, _ := auth.NewApiToken()
+	db.InsertApiToken(ctx, mingo.ApiToken{Id: id, UserId: alice.Id, Name: "app", SecretHash: secretHash, Scopes: []string{auth.ScopeWrite}, CreatedAt: now})
+	session, sessionHash, _ := auth.NewSessionToken()
+	db.InsertSession(ctx, sessionHash, alice.Id, now, now.Add(time.Hour))
+
+	policies := cors.Policies{{Prefix: "/api/", Origins: []string{"https://app.example.com"}, Methods: []string{"GET", "DELETE"}, Headers: []string{"Authorization"}, Credentials: true}}
+	discard := log.New(io.Discard, "", 0)
+	var reached bool
+	hdlr := (Middlewares{
+		newCsrfMiddleware(false, nil),
+		newRateLimitMiddleware(0, 1, clock, discard),
+		newAuthenticationMiddleware(db, clock, auth.RoleViewer),
+		newBearerTokenMiddleware(db, clock),
+		newClientCertMiddleware(nil),
+		newClientRateLimitMiddleware(0, 1, nil, clock, discard),
+		newConcurrencyLimitMiddleware(0, clock, discard),
+		NewDeadlineMiddleware(time.Second),
+		newRecoveryMiddleware(discard),
+		newCorsMiddleware(policies),
+		newSecurityHeadersMiddleware("", false, 0),
+		newLoggingMiddleware(clock, logger.NewAccessLogger(logger.AccessMingo, clock, io.Discard, "testhost"), nil),
+		newTracingMiddleware(func() string { return "req-42" }, nil, discard),
+	}).Apply(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { reached = true }))
+
+	var tests = []struct {
+		desc        string
+		method      string
+		headers     map[string]string
+		session     bool
+		wantStatus  int
+		wantReached bool
+	}{
+		{"preflight", "OPTIONS", map[string]string{"Access-Control-Request-Method": "DELETE", "Access-Control-Request-Headers": "authorization"}, false, 204, false},
+		{"write with an API token", "DELETE", map[string]string{"Authorization": "Bearer " + token}, false, 200, true},
+		{"read with a session cookie", "GET", nil, true, 200, true},
+		{"write with a session cookie", "DELETE", nil, true, 403, false},
+		{"anonymous read", "GET", nil, false, 401, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			reached = false
+			req := httptest.NewRequest(tt.method, "https://api.example.com/api/people/1", nil)
+			req.Header.Set("Origin", "https://app.example.com")
+			req.Header.Set("Sec-Fetch-Site", "same-site")
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			if tt.session { // the origins are same-site, so the browser sends the Lax session cookie along
+				req.AddCookie(&http.Cookie{Name: auth.SessionCookieName, Value: session})
+			}
+			rec := httptest.NewRecorder()
+			hdlr.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus || reached != tt.wantReached {
+				t.Errorf("got %d reached %v: %s, want %d reached %v", rec.Code, reached, rec.Body.String(), tt.wantStatus, tt.wantReached)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+				t.Errorf("Access-Control-Allow-Origin got %q, want the caller's origin so its script can read the answer", got)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+				t.Errorf("Access-Control-Allow-Credentials got %q, want true so the script can read answers made with the cookie", got)
+			}
+		})
+	}
+}
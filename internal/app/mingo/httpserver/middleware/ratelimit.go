@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+	"github.com/craigjperry2/mingo/internal/app/mingo/config"
+	"github.com/craigjperry2/mingo/internal/app/mingo/logger"
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+// Counters published at /debug/vars
+var throttleMetrics = expvar.NewMap("throttle")
+
+// A middleware that limits each logged in user & API token to a steady rate of requests with some burst
+// allowance, replying 429 with Retry-After beyond that. It sits inside authentication, anonymous
+// requests are limited per client address by NewClientRateLimitMiddleware instead
+func NewRateLimitMiddleware() middleware {
+	c := config.GetInstance()
+	return newRateLimitMiddleware(c.GetRateLimit(), c.GetRateBurst(), c.GetClock(),
+		logger.NewComponentLogger(c.GetClock(), c.GetLoggingDestination(), c.GetHostname(), "throttle"))
+}
+
+func newRateLimitMiddleware(rate float64, burst int, clock system.Clock, log *log.Logger) middleware {
+	limiter := newRateLimiter(rate, burst, clock)
+	return func(hdlr http.Handler) http.Handler {
+		if rate <= 0 {
+			return hdlr
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			var key string
+			if p, ok := auth.GetPrincipal(req.Context()); ok && p.TokenId != "" {
+				key = "token " + p.TokenId
+			} else if ok && p.Username != "" {
+				key = "user " + p.Username
+			} else {
+				hdlr.ServeHTTP(w, req) // already counted against its address
+				return
+			}
+			if wait, first := limiter.take(key); wait > 0 {
+				tooManyRequests(w, req, log, key, wait, first)
+				return
+			}
+			hdlr.ServeHTTP(w, req)
+		})
+	}
+}
+
+// A middleware in front of the bearer token & authentication middlewares that limits each client address,
+// so guessing passwords & tokens is throttled and a flood of anonymous requests can't make a session
+// lookup each. Only requests that end up anonymous are counted, callers behind one NAT address don't
+// starve each other once they've logged in, NewRateLimitMiddleware limits them per principal instead
+func NewClientRateLimitMiddleware() middleware {
+	c := config.GetInstance()
+	return newClientRateLimitMiddleware(c.GetRateLimit(), c.GetRateBurst(), c.GetTrustedProxies(), c.GetClock(),
+		logger.NewComponentLogger(c.GetClock(), c.GetLoggingDestination(), c.GetHostname(), "throttle"))
+}
+
+func newClientRateLimitMiddleware(rate float64, burst int, trusted []*net.IPNet, clock system.Clock, log *log.Logger) middleware {
+	limiter := newRateLimiter(rate, burst, clock)
+	return func(hdlr http.Handler) http.Handler {
+		if rate <= 0 {
+			return hdlr
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			key := "ip " + clientIp(req, trusted)
+			if wait, first := limiter.peek(key); wait > 0 {
+				tooManyRequests(w, req, log, key, wait, first)
+				return
+			}
+			identified := false
+			hdlr.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), identifiedKey{}, &identified)))
+			if !identified {
+				limiter.spend(key)
+			}
+		})
+	}
+}
+
+type identifiedKey struct{}
+
+// noteIdentified tells the client rate limiter the caller proved who they are, so the request counts
+// against them rather than their address
+func noteIdentified(ctx context.Context) {
+	if identified, ok := ctx.Value(identifiedKey{}).(*bool); ok {
+		*identified = true
+	}
+}
+
+func tooManyRequests(w http.ResponseWriter, req *http.Request, log *log.Logger, key string, wait time.Duration, first bool) {
+	throttleMetrics.Add("rate_limited", 1)
+	if first { // once per burst of throttling, not once per request, or an attacker fills the log
+		logger.Warnf(logger.Scoped(req.Context(), log), "rate limited %s at %s %s", key, req.Method, req.URL.Path)
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "too many requests, slow down", http.StatusTooManyRequests)
+}
+
+type rateLimiter struct {
+	rate      float64 // tokens added per second
+	burst     float64 // bucket capacity
+	clock     system.Clock
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens    float64
+	updated   time.Time
+	throttled bool
+}
+
+func newRateLimiter(rate float64, burst int, clock system.Clock) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: float64(burst), clock: clock, buckets: map[string]*bucket{}}
+}
+
+// Take a token from key's bucket, or say how long until one is available and whether this is the
+// first refusal since the key was last allowed through
+func (l *rateLimiter) take(key string) (wait time.Duration, first bool) {
+	return l.check(key, true)
+}
+
+// peek is take without taking the token, for requests that are only counted once they're served
+func (l *rateLimiter) peek(key string) (wait time.Duration, first bool) {
+	return l.check(key, false)
+}
+
+// spend a token after peek let the request through, concurrent requests can leave the bucket owing
+func (l *rateLimiter) spend(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(key, l.clock()).tokens--
+}
+
+func (l *rateLimiter) check(key string, take bool) (wait time.Duration, first bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock()
+	l.sweep(now)
+	b := l.refill(key, now)
+	if b.tokens >= 1 {
+		if take {
+			b.tokens--
+		}
+		b.throttled = false
+		return 0, false
+	}
+	first = !b.throttled
+	b.throttled = true
+	return time.Duration((1 - b.tokens) / l.rate * float64(time.Second)), first
+}
+
+func (l *rateLimiter) refill(key string, now time.Time) *bucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+	return b
+}
+
+// Forget buckets that have refilled, they're indistinguishable from new ones, so memory stays
+// proportional to the clients active in the last little while
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= full {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+)
+
+func TestRateLimit(t *testing.T) {
+	now := time.Date(2022, 4, 30, 23, 59, 59, 0, time.UTC)
+	var logged bytes.Buffer
+	hdlr := newRateLimitMiddleware(2, 3, func() time.Time { return now }, log.New(&logged, "", 0))(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+
+	get := func(principal *auth.Principal) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/crud", nil)
+		if principal != nil {
+			req = req.WithContext(auth.WithPrincipal(req.Context(), *principal))
+		}
+		w := httptest.NewRecorder()
+		hdlr.ServeHTTP(w, req)
+		return w
+	}
+
+	alice := &auth.Principal{Username: "alice", Via: auth.ViaSession}
+	for i := 0; i < 3; i++ {
+		if w := get(alice); w.Code != 200 {
+			t.Fatalf("request %d within burst got %d, want 200", i, w.Code)
+		}
+	}
+	w := get(alice)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("beyond burst got %d Retry-After %q, want 429 after 1", w.Code, w.Header().Get("Retry-After"))
+	}
+	get(alice)
+	if n := strings.Count(logged.String(), "rate limited user alice"); n != 1 {
+		t.Errorf("log lines got %d in %q, want 1 per burst of throttling", n, logged.String())
+	}
+
+	if w := get(&auth.Principal{Username: "alice", Via: auth.ViaToken, TokenId: "t1"}); w.Code != 200 {
+		t.Errorf("alice's token got %d, want its own bucket", w.Code)
+	}
+	for i := 0; i < 10; i++ {
+		if w := get(nil); w.Code != 200 {
+			t.Fatalf("anonymous request %d got %d, want 200, they're limited per address outside authentication", i, w.Code)
+		}
+	}
+
+	now = now.Add(500 * time.Millisecond) // refills one token at 2 per second
+	if w := get(alice); w.Code != 200 {
+		t.Errorf("after refill got %d, want 200", w.Code)
+	}
+	if w := get(alice); w.Code != http.StatusTooManyRequests {
+		t.Errorf("refill spent got %d, want 429", w.Code)
+	}
+}
+
+func TestClientRateLimit(t *testing.T) {
+	now := time.Date(2022, 4, 30, 23, 59, 59, 0, time.UTC)
+	var logged bytes.Buffer
+	limit := newClientRateLimitMiddleware(2, 3, nil, func() time.Time { return now }, log.New(&logged, "", 0))
+	// Only the good token identifies its caller, like the bearer token middleware inside this one
+	hdlr := limit(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") == "Bearer good" {
+			noteIdentified(req.Context())
+			return
+		}
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+	}))
+
+	get := func(addr, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/people", nil)
+		req.RemoteAddr = addr
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		hdlr.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 3; i++ {
+		if w := get("192.0.2.1:1234", "guess"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("guess %d within burst got %d, want 401", i, w.Code)
+		}
+	}
+	w := get("192.0.2.1:5678", "guess")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("guess beyond burst got %d Retry-After %q, want 429 after 1", w.Code, w.Header().Get("Retry-After"))
+	}
+	get("192.0.2.1:5678", "")
+	if n := strings.Count(logged.String(), "rate limited ip 192.0.2.1"); n != 1 {
+		t.Errorf("log lines got %d in %q, want 1 per burst of throttling", n, logged.String())
+	}
+	if w := get("192.0.2.2:1234", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("another address got %d, want its own bucket", w.Code)
+	}
+
+	now = now.Add(500 * time.Millisecond) // refills one token at 2 per second
+	for i := 0; i < 10; i++ {
+		if w := get("192.0.2.1:1234", "good"); w.Code != 200 {
+			t.Fatalf("identified request %d got %d, want 200 without spending the address's tokens", i, w.Code)
+		}
+	}
+	if w := get("192.0.2.1:1234", "guess"); w.Code != http.StatusUnauthorized {
+		t.Errorf("after refill got %d, want 401", w.Code)
+	}
+	if w := get("192.0.2.1:1234", "good"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("refill spent got %d, want 429 until the address has a token again", w.Code)
+	}
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	hdlr := newClientRateLimitMiddleware(0, 1, nil, time.Now, log.New(&bytes.Buffer{}, "", 0))(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	for i := 0; i < 100; i++ {
+		w := httptest.NewRecorder()
+		hdlr.ServeHTTP(w, httptest.NewRequest("GET", "/crud", nil))
+		if w.Code != 200 {
+			t.Fatalf("request %d got %d, want 200 with no limit", i, w.Code)
+		}
+	}
+}
+
+func TestRateLimiterSweepsIdleBuckets(t *testing.T) {
+	now := time.Date(2022, 4, 30, 23, 59, 59, 0, time.UTC)
+	l := &rateLimiter{rate: 1, burst: 10, clock: func() time.Time { return now }, buckets: map[string]*bucket{}, lastSweep: now}
+	l.take("a")
+	now = now.Add(5 * time.Second)
+	l.take("b")
+	now = now.Add(61 * time.Second)
+	l.take("c")
+	if _, ok := l.buckets["a"]; ok || len(l.buckets) != 1 {
+		t.Errorf("buckets got %v, want only c once a & b refilled", l.buckets)
+	}
+}
+
+func TestClientIp(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	trusted := []*net.IPNet{proxies}
+
+	var tests = []struct {
+		desc       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"direct", "192.0.2.1:1234", nil, "192.0.2.1"},
+		{"untrusted peer can't spoof", "192.0.2.1:1234", []string{"198.51.100.7"}, "192.0.2.1"},
+		{"trusted proxy", "10.0.0.1:1234", []string{"198.51.100.7"}, "198.51.100.7"},
+		{"client supplied prefix ignored", "10.0.0.1:1234", []string{"6.6.6.6, 198.51.100.7"}, "198.51.100.7"},
+		{"chain of trusted proxies", "10.0.0.1:1234", []string{"198.51.100.7, 10.0.0.2"}, "198.51.100.7"},
+		{"repeated headers", "10.0.0.1:1234", []string{"198.51.100.7", "10.0.0.2"}, "198.51.100.7"},
+		{"garbage stops the walk", "10.0.0.1:1234", []string{"198.51.100.7, junk"}, "10.0.0.1"},
+		{"proxy without header", "10.0.0.1:1234", nil, "10.0.0.1"},
+		{"ipv6", "[2001:db8::1]:1234", nil, "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		for _, f := range tt.forwarded {
+			req.Header.Add("X-Forwarded-For", f)
+		}
+		if got := clientIp(req, trusted); got != tt.want {
+			t.Errorf("%s got %q, want %q", tt.desc, got, tt.want)
+		}
+	}
+}
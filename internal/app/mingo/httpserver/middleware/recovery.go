@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"encoding/json"
+	"expvar"
+	"html"
+	"html/template"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/config"
+	"github.com/craigjperry2/mingo/internal/app/mingo/logger"
+	"github.com/craigjperry2/mingo/web"
+)
+
+// Counters published at /debug/vars
+var errorMetrics = expvar.NewMap("errors")
+
+var errorPage = template.Must(template.ParseFS(web.Templates, "templates/error.html"))
+
+// A middleware that turns a panic in any handler, e.g. the database's on a failed query, into a logged
+// stack trace and a 500 naming the request id, so a user's report can be matched to the log
+// It sits inside tracing so the request id is known and inside logging so the 500 is logged
+func NewRecoveryMiddleware() middleware {
+	c := config.GetInstance()
+	return newRecoveryMiddleware(logger.NewComponentLogger(c.GetClock(), c.GetLoggingDestination(), c.GetHostname(), "error"))
+}
+
+func newRecoveryMiddleware(log *log.Logger) middleware {
+	return func(hdlr http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			tw := &headerTrackingWriter{ResponseWriter: w}
+			outer := w.Header().Clone() // what outer middleware set, e.g. the request id & security headers
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if v == http.ErrAbortHandler { // the handler deliberately aborted, not a bug
+					panic(v)
+				}
+				requestID := logger.RequestId(req.Context())
+				errorMetrics.Add("panics", 1)
+				logger.Errorf(logger.Scoped(req.Context(), log), "panic serving %s %s: %v\n%s", req.Method, req.URL.Path, v, debug.Stack())
+				if tw.wroteHeader {
+					panic(http.ErrAbortHandler) // too late for an error page, cut the response short instead
+				}
+				internalError(w, req, requestID, outer)
+			}()
+			hdlr.ServeHTTP(tw, req)
+		})
+	}
+}
+
+func internalError(w http.ResponseWriter, req *http.Request, requestID string, outer http.Header) {
+	for name := range w.Header() { // whatever the handler had set described the response it didn't finish
+		w.Header().Del(name)
+	}
+	for name, values := range outer {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	switch {
+	case req.Header.Get("HX-Request") == "true":
+		w.Header().Set("HX-Retarget", "#flash")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`<div id="flash" class="notification is-danger is-light">Something went wrong, request id <code>` + html.EscapeString(requestID) + `</code></div>`))
+	case req.URL.Path == "/api" || strings.HasPrefix(req.URL.Path, "/api/"):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "internal server error", "request_id": requestID})
+	default:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		errorPage.Execute(w, requestID)
+	}
+}
+
+// Remembers whether the response has started, after which an error page can't replace it
+type headerTrackingWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (tw *headerTrackingWriter) WriteHeader(code int) {
+	tw.wroteHeader = true
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *headerTrackingWriter) Write(b []byte) (int, error) {
+	tw.wroteHeader = true
+	return tw.ResponseWriter.Write(b)
+}
+
+// Pass flushes through for streamed responses, e.g. the live log
+func (tw *headerTrackingWriter) Flush() {
+	tw.wroteHeader = true
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"bytes"
+	"expvar"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecovery(t *testing.T) {
+	var logged bytes.Buffer
+	hdlr := newTracingMiddleware(func() string { return "req-42" }, nil, log.New(io.Discard, "", 0))(newRecoveryMiddleware(log.New(&logged, "", 0))(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		panic("no such table: Person")
+	})))
+
+	panics := func() int64 {
+		if v, ok := errorMetrics.Get("panics").(*expvar.Int); ok {
+			return v.Value()
+		}
+		return 0
+	}
+
+	var tests = []struct {
+		desc        string
+		path        string
+		htmx        bool
+		wantType    string
+		wantContent string
+	}{
+		{"page", "/crud", false, "text/html; charset=utf-8", "<code>req-42</code>"},
+		{"htmx", "/crud", true, "text/html; charset=utf-8", `<div id="flash"`},
+		{"api", "/api/people", false, "application/json", `"request_id":"req-42"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			before := panics()
+			logged.Reset()
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.htmx {
+				req.Header.Set("HX-Request", "true")
+			}
+			w := httptest.NewRecorder()
+			hdlr.ServeHTTP(w, req)
+
+			if w.Code != http.StatusInternalServerError || w.Header().Get("Content-Type") != tt.wantType || !strings.Contains(w.Body.String(), tt.wantContent) || !strings.Contains(w.Body.String(), "req-42") {
+				t.Errorf("got %d %q %q, want 500 %s containing %s", w.Code, w.Header().Get("Content-Type"), w.Body.String(), tt.wantType, tt.wantContent)
+			}
+			if tt.htmx && w.Header().Get("HX-Retarget") != "#flash" {
+				t.Errorf("HX-Retarget got %q, want #flash", w.Header().Get("HX-Retarget"))
+			}
+			if !strings.Contains(logged.String(), "req-42 panic serving GET "+tt.path+": no such table: Person") || !strings.Contains(logged.String(), "recovery_test.go") {
+				t.Errorf("log got %q, want the request id, panic value and stack", logged.String())
+			}
+			if after := panics(); after != before+1 {
+				t.Errorf("panics metric got %d, want %d", after, before+1)
+			}
+		})
+	}
+}
+
+func TestRecoveryAfterResponseStarted(t *testing.T) {
+	hdlr := newRecoveryMiddleware(log.New(&bytes.Buffer{}, "", 0))(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("partial"))
+		panic("mid stream")
+	}))
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler so the server drops the connection", v)
+		}
+	}()
+	hdlr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/crud", nil))
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	var seen string
+	next := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { seen = CspNonce(req.Context()) })
+	hdlr := newSecurityHeadersMiddleware("script-src 'nonce-{nonce}'; style-src 'nonce-{nonce}'", false, time.Hour)
+
+	rec := httptest.NewRecorder()
+	hdlr(next).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	for k, v := range map[string]string{"X-Content-Type-Options": "nosniff", "X-Frame-Options": "DENY", "Referrer-Policy": "same-origin", "Strict-Transport-Security": ""} {
+		if got := rec.Header().Get(k); got != v {
+			t.Errorf("%s got %q, want %q", k, got, v)
+		}
+	}
+	if seen == "" {
+		t.Fatal("handler saw no nonce")
+	}
+	if got, want := rec.Header().Get("Content-Security-Policy"), "script-src 'nonce-"+seen+"'; style-src 'nonce-"+seen+"'"; got != want {
+		t.Errorf("policy got %q, want %q", got, want)
+	}
+
+	first := seen
+	hdlr(next).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if seen == first {
+		t.Error("nonce reused across requests")
+	}
+}
+
+func TestSecurityHeadersHstsOnlyOverTls(t *testing.T) {
+	hdlr := newSecurityHeadersMiddleware("", false, 365*24*time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	req := httptest.NewRequest("GET", "https://mingo.test/", nil)
+	req.TLS = &tls.ConnectionState{}
+	rec := httptest.NewRecorder()
+	hdlr.ServeHTTP(rec, req)
+	if got := rec.Header().Get("Strict-Transport-Security"); got != "max-age=31536000" {
+		t.Errorf("hsts got %q", got)
+	}
+	if got := rec.Header().Get("Content-Security-Policy"); got != "" {
+		t.Errorf("empty policy still sent %q", got)
+	}
+}
+
+func TestSecurityHeadersReportOnly(t *testing.T) {
+	hdlr := newSecurityHeadersMiddleware("default-src 'self'", true, 0)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	rec := httptest.NewRecorder()
+	hdlr.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if got := rec.Header().Get("Content-Security-Policy-Report-Only"); !strings.HasPrefix(got, "default-src") {
+		t.Errorf("report-only got %q", got)
+	}
+	if got := rec.Header().Get("Content-Security-Policy"); got != "" {
+		t.Errorf("enforcing policy sent %q", got)
+	}
+}
@@ -1,31 +1,82 @@
 package middleware
 
 import (
+	"crypto/rand"
+	"encoding/binary"
+	"log"
+	"net"
 	"net/http"
+	"regexp"
 	"strconv"
 
 	"github.com/craigjperry2/mingo/internal/app/mingo/config"
+	"github.com/craigjperry2/mingo/internal/app/mingo/logger"
+	"github.com/craigjperry2/mingo/internal/app/mingo/tracing"
 )
 
 // Facilitate tracing requests by assigning unique id's where they don't exist already
 type IdFountain func() string
 
+// Random rather than time based ids, concurrent requests can arrive within the same clock tick
 func NewIdFountain() IdFountain {
-	clock := config.GetInstance().GetClock()
 	return func() string {
-		return strconv.FormatInt(clock().UTC().UnixNano(), 36)
+		var b [8]byte
+		rand.Read(b[:])
+		return strconv.FormatUint(binary.BigEndian.Uint64(b[:]), 36)
 	}
 }
 
+// A request id from the caller, e.g. a proxy, is kept when it looks like one. It ends up in log lines,
+// headers & spans, so anything longer or with other characters is replaced rather than trusted
+var callerRequestId = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
 func NewTracingMiddleware(nextRequestID IdFountain) middleware {
+	c := config.GetInstance()
+	return newTracingMiddleware(nextRequestID, c.GetTracer(), logger.NewComponentLogger(c.GetClock(), c.GetLoggingDestination(), c.GetHostname(), "request"))
+}
+
+// Each request gets a server span, in the caller's trace when it sent a W3C traceparent header,
+// which handlers reach through the request's context to hang their own spans, e.g. database calls, off
+// The context also carries the request id and a logger for the request, see logger.FromContext
+// It's the outermost middleware so every other one, logging included, can log against the request
+func newTracingMiddleware(nextRequestID IdFountain, tracer *tracing.Tracer, log *log.Logger) middleware {
 	return func(hdlr http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 			requestID := req.Header.Get("X-Request-Id")
-			if requestID == "" {
+			if !callerRequestId.MatchString(requestID) {
 				requestID = nextRequestID()
 			}
 			w.Header().Set("X-Request-Id", requestID)
-			hdlr.ServeHTTP(w, req)
+			req = req.WithContext(logger.WithRequest(req.Context(), requestID, log))
+
+			ctx, span := tracer.StartRequest(req.Context(), req.Header, req.Method+" "+req.URL.Path)
+			if span == nil {
+				hdlr.ServeHTTP(w, req)
+				return
+			}
+			span.SetAttribute("http.method", req.Method)
+			span.SetAttribute("http.target", req.URL.RequestURI())
+			span.SetAttribute("http.user_agent", req.UserAgent())
+			if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+				span.SetAttribute("net.peer.ip", host)
+			}
+			span.SetAttribute("mingo.request_id", requestID)
+
+			lrw := NewLoggingResponseWriter(w)
+			defer func() {
+				span.SetAttribute("http.status_code", lrw.statusCode)
+				if lrw.statusCode >= 500 {
+					span.SetError(errStatus(lrw.statusCode))
+				}
+				span.End()
+			}()
+			hdlr.ServeHTTP(lrw, req.WithContext(ctx))
 		})
 	}
 }
+
+type errStatus int
+
+func (e errStatus) Error() string {
+	return strconv.Itoa(int(e)) + " " + http.StatusText(int(e))
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/logger"
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+	"github.com/craigjperry2/mingo/internal/app/mingo/tracing"
+)
+
+func TestIdFountainIsUnique(t *testing.T) {
+	next := NewIdFountain()
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		id := next()
+		if seen[id] {
+			t.Fatalf("id %s repeated after %d", id, i)
+		}
+		seen[id] = true
+	}
+}
+
+func TestCallerRequestId(t *testing.T) {
+	hdlr := newTracingMiddleware(func() string { return "req-42" }, nil, log.New(io.Discard, "", 0))(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	for _, tt := range []struct {
+		sent string
+		want string
+	}{
+		{"", "req-42"},
+		{"lb-7f3a.01_x", "lb-7f3a.01_x"},
+		{strings.Repeat("a", 64), strings.Repeat("a", 64)},
+		{strings.Repeat("a", 65), "req-42"},
+		{"x\n2022-04-30T23:59:59Z | host | main | forged", "req-42"},
+		{"a b", "req-42"},
+		{"<script>", "req-42"},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Request-Id", tt.sent)
+		rec := httptest.NewRecorder()
+		hdlr.ServeHTTP(rec, req)
+		if got := rec.Header().Get("X-Request-Id"); got != tt.want {
+			t.Errorf("%q got %q, want %q", tt.sent, got, tt.want)
+		}
+	}
+}
+
+func TestTracing(t *testing.T) {
+	var exported bytes.Buffer
+	tracer := tracing.NewTracer(system.NewClock(), "mingo-test", tracing.NewFileExporter(&exported), log.New(io.Discard, "", 0))
+	var inner tracing.SpanContext
+	var innerID string
+	var logged bytes.Buffer
+	hdlr := newTracingMiddleware(func() string { return "req-42" }, tracer, log.New(&logged, "", 0))(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		inner = tracing.FromContext(req.Context()).SpanContext()
+		innerID = logger.RequestId(req.Context())
+		logger.FromContext(req.Context()).Println("looking up people")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+
+	req := httptest.NewRequest("GET", "/api/people?limit=2", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	hdlr.ServeHTTP(rec, req)
+	tracer.Close(context.Background())
+
+	if rec.Header().Get("X-Request-Id") != "req-42" || innerID != "req-42" {
+		t.Errorf("request id got %q, in the handler's context %q", rec.Header().Get("X-Request-Id"), innerID)
+	}
+	if logged.String() != "req-42 looking up people\n" {
+		t.Errorf("request's logger got %q, want lines starting with the request id", logged.String())
+	}
+	if inner.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || inner.SpanID.String() == "00f067aa0ba902b7" {
+		t.Errorf("handler's span got %+v, want a new span in the caller's trace", inner)
+	}
+	for _, want := range []string{`"name":"GET /api/people"`, `"parentSpanId":"00f067aa0ba902b7"`, `"spanId":"` + inner.SpanID.String() + `"`,
+		`{"key":"http.status_code","value":{"intValue":"503"}}`, `{"key":"mingo.request_id","value":{"stringValue":"req-42"}}`, `"status":{"code":2,"message":"503 Service Unavailable"}`} {
+		if !strings.Contains(exported.String(), want) {
+			t.Errorf("exported %s, want %s", exported.String(), want)
+		}
+	}
+}
@@ -10,28 +10,64 @@ import (
 	"github.com/craigjperry2/mingo/internal/app/mingo/logger"
 )
 
+const (
+	readTimeout  = 5 * time.Second
+	writeTimeout = 10 * time.Second
+	idleTimeout  = 15 * time.Second
+)
+
 // Configure an HTTP server with routes, handlers, middleware & graceful shutdown ability
 // with thanks to https://gist.github.com/creack/4c00ee404f2d7bd5983382cc93af5147
-func MakeHttpServer() (*http.Server) {
+// health reports on the app's lifecycle & components for /health and /ready
+func MakeHttpServer(health func() handlers.HealthReport) *http.Server {
+	draining := make(chan struct{}) // closed once Shutdown is called, long-lived streams end then
 
 	router := http.NewServeMux()
 	router.Handle("/", handlers.NewIndexHandler())
-	router.Handle("/health", handlers.NewHealthHandler())
+	router.Handle("/health", handlers.NewHealthHandler(health))
+	router.Handle("/ready", handlers.NewReadyHandler(health))
+	router.Handle("/debug/vars", handlers.NewMetricsHandler())
+	router.Handle("/login", handlers.NewLoginHandler())
+	oidcHandler := handlers.NewOidcHandler()
+	router.Handle("/login/oidc", oidcHandler)
+	router.Handle("/login/oidc/callback", oidcHandler)
+	router.Handle("/logout", handlers.NewLogoutHandler())
+	router.Handle("/tokens", handlers.NewTokensHandler())
+	router.Handle("/users", handlers.NewUsersHandler())
+	router.Handle("/csp-report", handlers.NewCspReportHandler())
+	router.Handle("/admin/log-levels", handlers.NewLogLevelsHandler())
+	logsHandler := handlers.NewLogsHandler(draining)
+	router.Handle("/admin/logs", logsHandler)
+	router.Handle("/admin/logs/stream", logsHandler)
 	router.Handle("/static/", handlers.NewStaticHandler("/static/"))
 	router.Handle("/crud", handlers.NewCrudHandler())
 	router.Handle("/edit", handlers.NewEditHandler())
+	router.Handle("/api/people", handlers.NewApiHandler("/api/people"))
+	router.Handle("/api/people/", handlers.NewApiHandler("/api/people"))
 
 	server := &http.Server{
 		Addr: "0.0.0.0:" + config.GetInstance().GetListenPortStr(), // TODO: IPv6 controls
 		Handler: (middleware.Middlewares{
-			middleware.NewTracingMiddleware(middleware.NewIdFountain()),
+			middleware.NewCsrfMiddleware(),
+			middleware.NewRateLimitMiddleware(),
+			middleware.NewAuthenticationMiddleware(),
+			middleware.NewBearerTokenMiddleware(),
+			middleware.NewClientCertMiddleware(),
+			middleware.NewClientRateLimitMiddleware(), // outside authentication so failed attempts count too
+			middleware.NewConcurrencyLimitMiddleware(),
+			middleware.NewDeadlineMiddleware(writeTimeout - time.Second), // leaves a second to write the 503
+			middleware.NewRecoveryMiddleware(),
+			middleware.NewCorsMiddleware(),
+			middleware.NewSecurityHeadersMiddleware(),
 			middleware.NewLoggingMiddleware(),
+			middleware.NewTracingMiddleware(middleware.NewIdFountain()),
 		}).Apply(router),
 		ErrorLog:     logger.NewComponentLogger(config.GetInstance().GetClock(), config.GetInstance().GetLoggingDestination(), config.GetInstance().GetHostname(), "error"),
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  15 * time.Second,
+		ReadTimeout:  readTimeout,
+		WriteTimeout: writeTimeout,
+		IdleTimeout:  idleTimeout,
 	}
+	server.RegisterOnShutdown(func() { close(draining) })
 
 	return server
 }
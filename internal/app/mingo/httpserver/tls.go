@@ -0,0 +1,62 @@
+package httpserver
+
+import (
+	"crypto/x509"
+	"net/http"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/certs"
+	"github.com/craigjperry2/mingo/internal/app/mingo/config"
+	"github.com/craigjperry2/mingo/internal/app/mingo/errors"
+	"github.com/craigjperry2/mingo/internal/app/mingo/httpserver/handlers"
+	"github.com/craigjperry2/mingo/internal/app/mingo/logger"
+)
+
+// Switch the server to HTTPS when configured
+// It returns the keypair so the certificate can be reloaded later, or nil when serving plain HTTP
+func ConfigureTls(server *http.Server) (*certs.Keypair, error) {
+	c := config.GetInstance()
+	if !c.IsTlsEnabled() {
+		return nil, nil
+	}
+
+	var keypair *certs.Keypair
+	var err error
+	if c.GetTlsSelfSigned() {
+		keypair, err = certs.NewSelfSignedKeypair(c.GetTlsDir(), c.GetHostname(), c.GetClock())
+	} else {
+		keypair, err = certs.NewKeypair(c.GetTlsCertFile(), c.GetTlsKeyFile())
+	}
+	if err != nil {
+		logger.Errorf(server.ErrorLog, "Could not load TLS certificate: %v\n", err)
+		return nil, errors.ErrTlsUnavailable
+	}
+
+	var clientCAs *x509.CertPool
+	if c.GetTlsClientCaFile() != "" {
+		if clientCAs, err = certs.LoadCertPool(c.GetTlsClientCaFile()); err != nil {
+			logger.Errorf(server.ErrorLog, "Could not load TLS client CA: %v\n", err)
+			return nil, errors.ErrTlsUnavailable
+		}
+	}
+
+	server.TLSConfig = certs.ServerTlsConfig(keypair, clientCAs)
+	return keypair, nil
+}
+
+// Plain HTTP listener that only redirects to the HTTPS server, nil when not configured
+func MakeRedirectServer() *http.Server {
+	c := config.GetInstance()
+	if c.GetRedirectPort() == 0 {
+		return nil
+	}
+
+	return &http.Server{
+		Addr:         "0.0.0.0:" + c.GetRedirectPortStr(),
+		Handler:      handlers.NewHttpsRedirectHandler(c.GetListenPort()),
+		ErrorLog:     logger.NewComponentLogger(c.GetClock(), c.GetLoggingDestination(), c.GetHostname(), "error"),
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 5 * time.Second,
+		IdleTimeout:  15 * time.Second,
+	}
+}
@@ -0,0 +1,155 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+// How access log lines are written
+//
+//	mingo	the component format, "<time> | <host> | access | <request id> <method> <status> ..."
+//	combined	Apache's Combined Log Format, understood by most log analysers
+//	json	a JSON object per line for log shippers
+type AccessFormat string
+
+const (
+	AccessMingo    AccessFormat = "mingo"
+	AccessCombined AccessFormat = "combined"
+	AccessJson     AccessFormat = "json"
+)
+
+func ParseAccessFormat(s string) (AccessFormat, error) {
+	switch f := AccessFormat(s); f {
+	case AccessMingo, AccessCombined, AccessJson:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown access log format %q, want mingo, combined or json", s)
+}
+
+// One request as the access log sees it
+type AccessEntry struct {
+	Time       time.Time
+	RequestId  string
+	RemoteAddr string
+	Method     string
+	Uri        string
+	Proto      string
+	Status     int
+	Bytes      int64
+	Duration   time.Duration
+	User       string // "" when anonymous
+	Token      string // API token id, never the secret
+	ClientCert string // subject of a verified client certificate
+	Referer    string
+	UserAgent  string
+}
+
+type AccessLogger struct {
+	format AccessFormat
+	c      componentLogger
+	l      *log.Logger // serialises lines from concurrent requests
+}
+
+func NewAccessLogger(format AccessFormat, clock system.Clock, w io.Writer, hostname string) *AccessLogger {
+	register("access")
+	return &AccessLogger{format, componentLogger{clock: clock, w: w, hostname: hostname, component: "access"}, log.New(w, "", 0)}
+}
+
+func (a *AccessLogger) Log(e AccessEntry) {
+	if GetLevel("access") > LevelInfo {
+		return
+	}
+	if a.format == AccessMingo {
+		a.c.log(Entry{Time: a.c.clock().UTC(), Component: "access", Level: LevelInfo, RequestId: e.RequestId, Message: mingoAccessLine(e)})
+		return
+	}
+	// the recent log has every component's lines in the one format
+	record(Entry{Time: e.Time, Component: "access", Level: LevelInfo, RequestId: e.RequestId, Message: strings.TrimSuffix(mingoAccessLine(e), "\n")})
+
+	var line string
+	if a.format == AccessCombined {
+		line = combined(e)
+	} else {
+		b, _ := json.Marshal(jsonEntry{
+			e.Time.UTC().Format(time.RFC3339Nano), e.RequestId, e.RemoteAddr, e.Method, e.Uri, e.Proto, e.Status, e.Bytes,
+			float64(e.Duration.Microseconds()) / 1000, e.User, e.Token, e.ClientCert, e.Referer, e.UserAgent,
+		})
+		line = string(b)
+	}
+	if sink, ok := a.c.w.(Sink); ok {
+		sink.Send(Entry{Time: e.Time, Component: "access", Level: LevelInfo, RequestId: e.RequestId, Message: line})
+		return
+	}
+	a.l.Println(line)
+}
+
+func mingoAccessLine(e AccessEntry) string {
+	cert := "-"
+	if e.ClientCert != "" {
+		cert = strconv.Quote(e.ClientCert)
+	}
+	return fmt.Sprintln(e.RequestId, e.Method, e.Status, e.Uri, e.RemoteAddr, cert, orDash(e.User), orDash(e.Token), e.UserAgent, e.Duration)
+}
+
+type jsonEntry struct {
+	Time       string  `json:"time"`
+	RequestId  string  `json:"request_id"`
+	RemoteAddr string  `json:"remote_addr"`
+	Method     string  `json:"method"`
+	Uri        string  `json:"uri"`
+	Proto      string  `json:"proto"`
+	Status     int     `json:"status"`
+	Bytes      int64   `json:"bytes"`
+	DurationMs float64 `json:"duration_ms"`
+	User       string  `json:"user,omitempty"`
+	Token      string  `json:"token,omitempty"`
+	ClientCert string  `json:"client_cert,omitempty"`
+	Referer    string  `json:"referer,omitempty"`
+	UserAgent  string  `json:"user_agent,omitempty"`
+}
+
+// host ident user [time] "request" status bytes "referer" "user agent"
+func combined(e AccessEntry) string {
+	host := e.RemoteAddr
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	size := "-"
+	if e.Bytes > 0 {
+		size = strconv.FormatInt(e.Bytes, 10)
+	}
+	return fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %s "%s" "%s"`, host, orDash(escape(e.User)), e.Time.UTC().Format("02/Jan/2006:15:04:05 -0700"),
+		escape(e.Method), escape(e.Uri), escape(e.Proto), e.Status, size, orDash(escape(e.Referer)), orDash(escape(e.UserAgent)))
+}
+
+// Escape quotes, backslashes & control characters the way Apache does, a client can't forge a log line
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
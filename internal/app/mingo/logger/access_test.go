@@ -0,0 +1,63 @@
+package logger
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+func TestAccessFormats(t *testing.T) {
+	entry := AccessEntry{
+		Time:       time.Date(2022, 4, 30, 23, 59, 59, 0, time.UTC),
+		RequestId:  "req-42",
+		RemoteAddr: "192.0.2.7:51234",
+		Method:     "GET",
+		Uri:        "/crud?limit=2",
+		Proto:      "HTTP/1.1",
+		Status:     200,
+		Bytes:      1234,
+		Duration:   1500 * time.Microsecond,
+		User:       "alice",
+		Referer:    "https://example.com/",
+		UserAgent:  `curl "evil"` + "\n",
+	}
+
+	var tests = []struct {
+		format AccessFormat
+		want   string
+	}{
+		{AccessMingo, "2022-04-30T23:59:59Z | testhost | access | req-42 GET 200 /crud?limit=2 192.0.2.7:51234 - alice - curl \"evil\"\n 1.5ms\n"},
+		{AccessCombined, `192.0.2.7 - alice [30/Apr/2022:23:59:59 +0000] "GET /crud?limit=2 HTTP/1.1" 200 1234 "https://example.com/" "curl \"evil\"\x0a"` + "\n"},
+		{AccessJson, `{"time":"2022-04-30T23:59:59Z","request_id":"req-42","remote_addr":"192.0.2.7:51234","method":"GET","uri":"/crud?limit=2","proto":"HTTP/1.1",` +
+			`"status":200,"bytes":1234,"duration_ms":1.5,"user":"alice","referer":"https://example.com/","user_agent":"curl \"evil\"\n"}` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			var buf bytes.Buffer
+			NewAccessLogger(tt.format, system.ClockForTesting("2022-04-30T23:59:59Z"), &buf, "testhost").Log(entry)
+			if buf.String() != tt.want {
+				t.Errorf("got %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestCombinedWithoutBytesOrUser(t *testing.T) {
+	var buf bytes.Buffer
+	NewAccessLogger(AccessCombined, system.NewClock(), &buf, "testhost").Log(AccessEntry{RemoteAddr: "[::1]:8080", Method: "HEAD", Uri: "/", Proto: "HTTP/2.0", Status: 304})
+	want := `::1 - - [01/Jan/0001:00:00:00 +0000] "HEAD / HTTP/2.0" 304 - "-" "-"` + "\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestParseAccessFormat(t *testing.T) {
+	if f, err := ParseAccessFormat("json"); err != nil || f != AccessJson {
+		t.Errorf("json got %q, %v", f, err)
+	}
+	if _, err := ParseAccessFormat("apache"); err == nil {
+		t.Error("apache want err, got nil")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/craigjperry2/mingo/internal/app/mingo/system"
 	"io"
 	"log"
+	"strings"
 )
 
 // I want logging in the format of "<ISO8601 date/time> | <hostname> | <component> | <message...>"
@@ -13,14 +14,42 @@ type componentLogger struct {
 	w         io.Writer
 	hostname  string
 	component string
+	requestId string // set for a request's lines, see Scoped
 }
 
 // TODO: suspect this is not idiomatic Go. This New* func is returning a *log.Logger not a *componentLogger
 func NewComponentLogger(clock system.Clock, loggingDestination io.Writer, hostname string, component string) *log.Logger {
-	logger := log.New(componentLogger{clock, loggingDestination, hostname, component}, "", 0)
+	register(component)
+	logger := log.New(componentLogger{clock: clock, w: loggingDestination, hostname: hostname, component: component}, "", 0)
 	return logger
 }
 
+// Lines written through the *log.Logger are info, dropped when the component's level is above that
 func (logger componentLogger) Write(bytes []byte) (int, error) {
-	return fmt.Fprint(logger.w, logger.clock().UTC().Format("2006-01-02T15:04:05.999Z"), " | ", logger.hostname, " | ", logger.component, " | ", string(bytes))
+	if GetLevel(logger.component) > LevelInfo {
+		return len(bytes), nil
+	}
+	return logger.write(LevelInfo, string(bytes))
+}
+
+func (logger componentLogger) write(level Level, message string) (int, error) {
+	return logger.log(Entry{Time: logger.clock().UTC(), Component: logger.component, Level: level, Message: message})
+}
+
+// Write the line, or send it when the destination is a Sink, and tee it into the recent log
+func (logger componentLogger) log(e Entry) (int, error) {
+	e.Message = strings.TrimSuffix(e.Message, "\n")
+	if logger.requestId != "" {
+		e.RequestId = logger.requestId
+		e.Message = logger.requestId + " " + e.Message
+	}
+	record(e)
+	if sink, ok := logger.w.(Sink); ok {
+		return len(e.Message) + 1, sink.Send(e)
+	}
+	return io.WriteString(logger.w, formatLine(e, logger.hostname))
+}
+
+func formatLine(e Entry, hostname string) string {
+	return fmt.Sprint(e.Time.Format("2006-01-02T15:04:05.999Z"), " | ", hostname, " | ", e.Component, " | ", e.Message, "\n")
 }
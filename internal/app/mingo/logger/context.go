@@ -0,0 +1,53 @@
+package logger
+
+import (
+	"context"
+	"log"
+)
+
+type requestIdKey struct{}
+
+type loggerKey struct{}
+
+// WithRequestId marks the context as serving a request, so lines logged on its behalf can say which
+func WithRequestId(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, requestId)
+}
+
+// WithRequest marks the context as serving a request and carries l, scoped to it, for FromContext
+func WithRequest(ctx context.Context, requestId string, l *log.Logger) context.Context {
+	ctx = WithRequestId(ctx, requestId)
+	return context.WithValue(ctx, loggerKey{}, Scoped(ctx, l))
+}
+
+// RequestId of the request the context serves, "-" outside of one
+func RequestId(ctx context.Context) string {
+	if id, ok := ctx.Value(requestIdKey{}).(string); ok && id != "" {
+		return id
+	}
+	return "-"
+}
+
+// FromContext is the logger of the request the context serves, for handlers without a component
+// logger of their own, or the standard logger outside of one
+func FromContext(ctx context.Context) *log.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*log.Logger); ok {
+		return l
+	}
+	return log.Default()
+}
+
+// Scoped is l for the request the context serves, its lines start with the request id and carry it
+// to a Sink, or l itself outside of a request
+func Scoped(ctx context.Context, l *log.Logger) *log.Logger {
+	id, ok := ctx.Value(requestIdKey{}).(string)
+	if !ok || id == "" {
+		return l
+	}
+	c, ok := l.Writer().(componentLogger)
+	if !ok { // not a component logger, e.g. a test's
+		return log.New(l.Writer(), l.Prefix()+id+" ", l.Flags())
+	}
+	c.requestId = id
+	return log.New(c, "", 0)
+}
@@ -0,0 +1,45 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"testing"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+func TestScopedLinesCarryTheRequestId(t *testing.T) {
+	restoreLevels(t)
+	r := NewRing(10)
+	SetRecent(r)
+	defer SetRecent(nil)
+
+	var buf bytes.Buffer
+	l := NewComponentLogger(system.ClockForTesting("2022-04-30T23:59:59Z"), &buf, "testhost", "sql")
+	ctx := WithRequest(context.Background(), "req-42", l)
+
+	Warnf(Scoped(ctx, l), "GetAll was slow, %v", "1s")
+	FromContext(ctx).Println("from the request's logger")
+	Scoped(context.Background(), l).Println("outside a request")
+
+	want := "2022-04-30T23:59:59Z | testhost | sql | req-42 GetAll was slow, 1s\n" +
+		"2022-04-30T23:59:59Z | testhost | sql | req-42 from the request's logger\n" +
+		"2022-04-30T23:59:59Z | testhost | sql | outside a request\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+	entries := r.Entries(0)
+	if len(entries) != 3 || entries[0].RequestId != "req-42" || entries[0].Level != LevelWarn || entries[2].RequestId != "" {
+		t.Errorf("recent got %+v", entries)
+	}
+}
+
+func TestFromContextOutsideARequest(t *testing.T) {
+	if FromContext(context.Background()) != log.Default() {
+		t.Error("want the standard logger outside of a request")
+	}
+	if RequestId(context.Background()) != "-" {
+		t.Errorf("request id got %q, want -", RequestId(context.Background()))
+	}
+}
@@ -0,0 +1,51 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"strings"
+)
+
+// Sends lines to systemd's journal in its native protocol, a datagram of KEY=value fields per line,
+// so `journalctl -p warning` and `journalctl COMPONENT=sql` or `REQUEST_ID=...` work
+type Journald struct {
+	*sinkConn
+}
+
+// Syslog severities, which journald's PRIORITY field shares
+var severities = map[Level]int{LevelDebug: 7, LevelInfo: 6, LevelWarn: 4, LevelError: 3}
+
+func (j *Journald) Send(e Entry) error {
+	return j.send(e, journalFields(e))
+}
+
+func (j *Journald) Write(p []byte) (int, error) {
+	return writeLines(j, j.clock, p)
+}
+
+func journalFields(e Entry) []byte {
+	var b bytes.Buffer
+	journalField(&b, "MESSAGE", e.Message)
+	journalField(&b, "PRIORITY", strconv.Itoa(severities[e.Level]))
+	journalField(&b, "SYSLOG_IDENTIFIER", "mingo")
+	if e.Component != "" {
+		journalField(&b, "COMPONENT", e.Component)
+	}
+	if e.RequestId != "" {
+		journalField(&b, "REQUEST_ID", e.RequestId)
+	}
+	return b.Bytes()
+}
+
+// A value with a newline is sent as the name, a newline, its length as 64 bit little endian, then
+// the value, otherwise it's just NAME=value
+func journalField(b *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		b.WriteString(name + "=" + value + "\n")
+		return
+	}
+	b.WriteString(name + "\n")
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value + "\n")
+}
@@ -0,0 +1,174 @@
+package logger
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Level is how much a component logs, lines less severe than its level are dropped
+// Lines logged with Println etc are info, Debugf, Warnf & Errorf log at their own level
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelOff
+)
+
+var levelNames = []string{"debug", "info", "warn", "error", "off"}
+
+// The level of components without one of their own
+const DefaultComponent = "*"
+
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if s == name {
+			return Level(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q, want debug, info, warn, error or off", s)
+}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelOff {
+		return fmt.Sprintf("Level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// Levels are JSON strings, e.g. {"sql":"debug"}
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l *Level) UnmarshalText(b []byte) error {
+	parsed, err := ParseLevel(string(b))
+	if err != nil {
+		return err
+	}
+	*l = parsed
+	return nil
+}
+
+// ParseLevels reads comma separated <component>=<level> pairs, a bare level sets the default,
+// e.g. "warn,access=off,sql=debug"
+func ParseLevels(spec string) (map[string]Level, error) {
+	levels := map[string]Level{}
+	for _, item := range strings.Split(spec, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		component, name, found := strings.Cut(item, "=")
+		if !found {
+			component, name = DefaultComponent, item
+		}
+		level, err := ParseLevel(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		levels[strings.TrimSpace(component)] = level
+	}
+	if len(levels) == 0 {
+		return nil, fmt.Errorf("no log levels in %q", spec)
+	}
+	return levels, nil
+}
+
+// The levels in force, read on every line so changes take effect immediately
+var registry = struct {
+	sync.RWMutex
+	fallback   Level
+	components map[string]Level
+	known      map[string]bool // every component a logger has been made for
+}{fallback: LevelInfo, components: map[string]Level{}, known: map[string]bool{}}
+
+// SetLevels changes the given components' levels, DefaultComponent changes the level of the rest
+func SetLevels(levels map[string]Level) {
+	registry.Lock()
+	defer registry.Unlock()
+	for component, level := range levels {
+		if component == DefaultComponent {
+			registry.fallback = level
+		} else {
+			registry.components[component] = level
+			registry.known[component] = true
+		}
+	}
+}
+
+func GetLevel(component string) Level {
+	registry.RLock()
+	defer registry.RUnlock()
+	if level, ok := registry.components[component]; ok {
+		return level
+	}
+	return registry.fallback
+}
+
+// Levels of every known component and the default
+func Levels() map[string]Level {
+	registry.RLock()
+	defer registry.RUnlock()
+	levels := map[string]Level{DefaultComponent: registry.fallback}
+	for component := range registry.known {
+		levels[component] = registry.fallback
+	}
+	for component, level := range registry.components {
+		levels[component] = level
+	}
+	return levels
+}
+
+// FormatLevels as ParseLevels reads them, the default first then components alphabetically
+func FormatLevels(levels map[string]Level) string {
+	var items []string
+	for component, level := range levels {
+		if component != DefaultComponent {
+			items = append(items, component+"="+level.String())
+		}
+	}
+	sort.Strings(items)
+	if level, ok := levels[DefaultComponent]; ok {
+		items = append([]string{level.String()}, items...)
+	}
+	return strings.Join(items, ",")
+}
+
+func register(component string) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.known[component] = true
+}
+
+// Debugf logs when l's component is at debug level, e.g. every SQL statement
+func Debugf(l *log.Logger, format string, v ...interface{}) {
+	logAt(l, LevelDebug, format, v...)
+}
+
+// Warnf logs something that's wrong but handled, e.g. a slow SQL statement
+func Warnf(l *log.Logger, format string, v ...interface{}) {
+	logAt(l, LevelWarn, format, v...)
+}
+
+// Errorf logs a failure, it's only silenced by turning the component off
+func Errorf(l *log.Logger, format string, v ...interface{}) {
+	logAt(l, LevelError, format, v...)
+}
+
+func logAt(l *log.Logger, level Level, format string, v ...interface{}) {
+	c, ok := l.Writer().(componentLogger)
+	if !ok { // not a component logger, e.g. a test's, treat it as being at info
+		if level >= LevelInfo {
+			l.Printf(format, v...)
+		}
+		return
+	}
+	if level >= GetLevel(c.component) {
+		c.write(level, fmt.Sprintf(format, v...))
+	}
+}
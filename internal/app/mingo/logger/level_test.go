@@ -0,0 +1,81 @@
+package logger
+
+import (
+	"bytes"
+	"log"
+	"testing"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+// Put the global levels back as they were once the test is done
+func restoreLevels(t *testing.T) {
+	before := Levels()
+	t.Cleanup(func() {
+		registry.Lock()
+		registry.components = map[string]Level{}
+		registry.Unlock()
+		SetLevels(before)
+	})
+}
+
+func TestLevelsFilterLines(t *testing.T) {
+	restoreLevels(t)
+	var buf bytes.Buffer
+	clock := system.ClockForTesting("2022-04-30T23:59:59Z")
+	sql := NewComponentLogger(clock, &buf, "testhost", "sql")
+	access := NewComponentLogger(clock, &buf, "testhost", "access")
+
+	Debugf(sql, "hidden at info")
+	SetLevels(map[string]Level{"sql": LevelDebug, "access": LevelWarn})
+	Debugf(sql, "select %d", 1)
+	access.Println("hidden at warn")
+	Warnf(access, "shown at warn")
+	SetLevels(map[string]Level{"access": LevelOff})
+	Errorf(access, "hidden when off")
+
+	want := "2022-04-30T23:59:59Z | testhost | sql | select 1\n" +
+		"2022-04-30T23:59:59Z | testhost | access | shown at warn\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestLevelsListKnownComponents(t *testing.T) {
+	restoreLevels(t)
+	NewComponentLogger(system.NewClock(), &bytes.Buffer{}, "testhost", "tracing")
+	SetLevels(map[string]Level{DefaultComponent: LevelWarn, "sql": LevelDebug})
+
+	levels := Levels()
+	if levels[DefaultComponent] != LevelWarn || levels["tracing"] != LevelWarn || levels["sql"] != LevelDebug {
+		t.Errorf("got %v", levels)
+	}
+	if got := GetLevel("never-seen"); got != LevelWarn {
+		t.Errorf("unknown component got %v, want the default", got)
+	}
+}
+
+func TestParseLevels(t *testing.T) {
+	levels, err := ParseLevels("warn, access=off,sql=debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := FormatLevels(levels); got != "warn,access=off,sql=debug" {
+		t.Errorf("got %q", got)
+	}
+	for _, bad := range []string{"", "sql=verbose", "loud"} {
+		if _, err := ParseLevels(bad); err == nil {
+			t.Errorf("%q want err, got nil", bad)
+		}
+	}
+}
+
+func TestLevelsOfOtherLoggers(t *testing.T) {
+	var buf bytes.Buffer
+	l := log.New(&buf, "", 0)
+	Debugf(l, "hidden at info")
+	Warnf(l, "shown at info")
+	if buf.String() != "shown at info\n" {
+		t.Errorf("got %q", buf.String())
+	}
+}
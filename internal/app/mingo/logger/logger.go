@@ -8,6 +8,7 @@ import (
 )
 
 func Setup(loggingDestination io.Writer, clock system.Clock, hostname string) {
+	register("main")
 	log.SetFlags(0)
-	log.SetOutput(componentLogger{clock, loggingDestination, hostname, "main"})
+	log.SetOutput(componentLogger{clock: clock, w: loggingDestination, hostname: hostname, component: "main"})
 }
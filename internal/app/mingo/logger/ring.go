@@ -0,0 +1,107 @@
+package logger
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// A logged line as the recent log keeps it
+type Entry struct {
+	Seq       uint64    `json:"seq"` // increases by one per line, lets a reconnecting viewer resume
+	Time      time.Time `json:"time"`
+	Component string    `json:"component"`
+	Level     Level     `json:"level"`
+	RequestId string    `json:"request_id,omitempty"` // when the line is about a request
+	Message   string    `json:"message"`
+}
+
+// Matches reports whether the entry is from component ("" for any), at level or above, and contains
+// text, e.g. a request id, ("" for any)
+func (e Entry) Matches(component string, level Level, text string) bool {
+	return (component == "" || e.Component == component) && e.Level >= level && strings.Contains(e.Message, text)
+}
+
+// The most recent log lines, held in memory so they can be read from the browser, and fanned out to
+// live viewers. A viewer that can't keep up misses lines rather than holding up the logging
+type Ring struct {
+	mu          sync.Mutex
+	entries     []Entry
+	next        int // where the next entry goes once the ring is full
+	seq         uint64
+	subscribers map[chan Entry]struct{}
+}
+
+func NewRing(size int) *Ring {
+	return &Ring{entries: make([]Entry, 0, size), subscribers: map[chan Entry]struct{}{}}
+}
+
+func (r *Ring) Add(e Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq++
+	e.Seq = r.seq
+	if len(r.entries) < cap(r.entries) {
+		r.entries = append(r.entries, e)
+	} else if cap(r.entries) > 0 {
+		r.entries[r.next] = e
+		r.next = (r.next + 1) % cap(r.entries)
+	}
+	for ch := range r.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Entries after seq, oldest first, 0 for all of them
+func (r *Ring) Entries(after uint64) []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var entries []Entry
+	for _, e := range append(r.entries[r.next:len(r.entries):len(r.entries)], r.entries[:r.next]...) {
+		if e.Seq > after {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Subscribe to entries as they're added, call the returned func to stop
+func (r *Ring) Subscribe(buffer int) (<-chan Entry, func()) {
+	ch := make(chan Entry, buffer)
+	r.mu.Lock()
+	r.subscribers[ch] = struct{}{}
+	r.mu.Unlock()
+	return ch, func() {
+		r.mu.Lock()
+		delete(r.subscribers, ch)
+		r.mu.Unlock()
+	}
+}
+
+// The ring every component logger tees into, nil until SetRecent
+var recent struct {
+	sync.RWMutex
+	ring *Ring
+}
+
+func SetRecent(r *Ring) {
+	recent.Lock()
+	defer recent.Unlock()
+	recent.ring = r
+}
+
+// Recent is the ring component loggers tee into, nil when there's none
+func Recent() *Ring {
+	recent.RLock()
+	defer recent.RUnlock()
+	return recent.ring
+}
+
+func record(e Entry) {
+	if r := Recent(); r != nil {
+		r.Add(e)
+	}
+}
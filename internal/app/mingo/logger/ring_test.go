@@ -0,0 +1,68 @@
+package logger
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+func messages(entries []Entry) []string {
+	var m []string
+	for _, e := range entries {
+		m = append(m, e.Message)
+	}
+	return m
+}
+
+func TestRingKeepsTheNewest(t *testing.T) {
+	r := NewRing(3)
+	for _, m := range []string{"one", "two", "three", "four", "five"} {
+		r.Add(Entry{Message: m})
+	}
+	if got := messages(r.Entries(0)); !equal(got, []string{"three", "four", "five"}) {
+		t.Errorf("entries got %v", got)
+	}
+	if got := r.Entries(4); len(got) != 1 || got[0].Seq != 5 {
+		t.Errorf("entries after 4 got %+v, want just seq 5", got)
+	}
+}
+
+func TestRingSubscribers(t *testing.T) {
+	r := NewRing(10)
+	ch, stop := r.Subscribe(1)
+	r.Add(Entry{Message: "seen"})
+	r.Add(Entry{Message: "dropped, the subscriber is behind"})
+	stop()
+	r.Add(Entry{Message: "after stopping"})
+
+	if e := <-ch; e.Message != "seen" {
+		t.Errorf("got %q", e.Message)
+	}
+	select {
+	case e := <-ch:
+		t.Errorf("got %q, want nothing more", e.Message)
+	default:
+	}
+}
+
+func TestComponentLoggersTeeIntoRecent(t *testing.T) {
+	restoreLevels(t)
+	r := NewRing(10)
+	SetRecent(r)
+	defer SetRecent(nil)
+
+	l := NewComponentLogger(system.ClockForTesting("2022-04-30T23:59:59Z"), &bytes.Buffer{}, "testhost", "sql")
+	l.Println("req-42 GetAll took 1ms")
+	Warnf(l, "req-42 GetAll was slow, 1s")
+	SetLevels(map[string]Level{"sql": LevelError})
+	l.Println("not logged so not kept")
+
+	entries := r.Entries(0)
+	if len(entries) != 2 || entries[1].Component != "sql" || entries[1].Level != LevelWarn || entries[1].Message != "req-42 GetAll was slow, 1s" {
+		t.Fatalf("entries got %+v", entries)
+	}
+	if !entries[1].Matches("sql", LevelWarn, "req-42") || entries[0].Matches("", LevelWarn, "") || entries[0].Matches("access", LevelDebug, "") {
+		t.Error("filters don't match as expected")
+	}
+}
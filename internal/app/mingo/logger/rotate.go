@@ -0,0 +1,239 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+// When a log file is rotated and what becomes of the rotated files
+type Rotation struct {
+	MaxSize  int64 // bytes, 0 for no limit
+	Daily    bool  // also rotate when the UTC day changes
+	Keep     int   // rotated files to keep, 0 keeps them all
+	Compress bool  // gzip rotated files
+}
+
+// A log file that rotates itself, e.g. mingo.log is renamed mingo.log.20220430-235959 and a new mingo.log
+// started. Every Write is a single append so a crash can't interleave or tear lines, rotated files are
+// compressed to a temporary name and renamed so a half written archive never replaces a log
+type RotatingFile struct {
+	path     string
+	rotation Rotation
+	clock    system.Clock
+	problems io.Writer // rotation failures are reported here, the log file itself may be the problem
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	day    string
+	closed bool
+	wg     sync.WaitGroup // background compression & pruning
+	bg     sync.Mutex     // one rotation's background work at a time
+}
+
+func NewRotatingFile(path string, rotation Rotation, clock system.Clock, problems io.Writer) (*RotatingFile, error) {
+	r := &RotatingFile{path: path, rotation: rotation, clock: clock, problems: problems}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+
+	now := r.clock().UTC()
+	if r.size > 0 && (r.rotation.MaxSize > 0 && r.size+int64(len(p)) > r.rotation.MaxSize || r.rotation.Daily && day(now) != r.day) {
+		if err := r.rotate(now); err != nil {
+			fmt.Fprintf(r.problems, "Could not rotate %s, still writing to it: %v\n", r.path, err)
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Reopen the file by name, e.g. after an external logrotate has moved it aside on SIGUSR1
+func (r *RotatingFile) Reopen() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return os.ErrClosed
+	}
+	old := r.f
+	if err := r.open(); err != nil {
+		return err
+	}
+	return old.Close()
+}
+
+// Close the file once any rotated files have been compressed
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	err := r.f.Close()
+	r.mu.Unlock()
+	r.wg.Wait()
+	return err
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, info.Size()
+	r.day = day(r.clock().UTC())
+	if r.size > 0 {
+		r.day = day(info.ModTime().UTC()) // yesterday's file is rotated by the first write today
+	}
+	return nil
+}
+
+func (r *RotatingFile) rotate(now time.Time) error {
+	archive := r.path + "." + now.Format("20060102-150405")
+	for i := 1; exists(archive) || exists(archive+".gz"); i++ {
+		archive = r.path + "." + now.Format("20060102-150405") + "." + strconv.Itoa(i)
+	}
+	if err := os.Rename(r.path, archive); err != nil {
+		return err
+	}
+	old := r.f
+	if err := r.open(); err != nil {
+		os.Rename(archive, r.path)
+		return err
+	}
+	old.Close()
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.bg.Lock()
+		defer r.bg.Unlock()
+		if r.rotation.Compress {
+			if err := compress(archive); err != nil {
+				fmt.Fprintf(r.problems, "Could not compress %s: %v\n", archive, err)
+			}
+		}
+		if err := r.prune(); err != nil {
+			fmt.Fprintf(r.problems, "Could not remove old logs of %s: %v\n", r.path, err)
+		}
+	}()
+	return nil
+}
+
+func compress(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(path+".gz.tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name()) // a no-op once renamed
+
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(out.Name(), path+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// Remove all but the newest Keep rotated files
+func (r *RotatingFile) prune() error {
+	if r.rotation.Keep <= 0 {
+		return nil
+	}
+	matches, err := filepath.Glob(r.path + ".*")
+	if err != nil {
+		return err
+	}
+	type archive struct {
+		path    string
+		modTime time.Time
+	}
+	var archives []archive
+	for _, m := range matches {
+		if !isArchiveSuffix(strings.TrimPrefix(m, r.path+".")) {
+			continue // e.g. a .tmp being compressed, or another log named after this one
+		}
+		if info, err := os.Stat(m); err == nil {
+			archives = append(archives, archive{m, info.ModTime()})
+		}
+	}
+	sort.Slice(archives, func(i, j int) bool {
+		if archives[i].modTime.Equal(archives[j].modTime) {
+			return archives[i].path > archives[j].path
+		}
+		return archives[i].modTime.After(archives[j].modTime)
+	})
+	for i := r.rotation.Keep; i < len(archives); i++ {
+		if err := os.Remove(archives[i].path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// 20220430-235959, optionally followed by .1 etc & .gz
+func isArchiveSuffix(s string) bool {
+	s = strings.TrimSuffix(s, ".gz")
+	stamp, n, found := strings.Cut(s, ".")
+	if _, err := time.Parse("20060102-150405", stamp); err != nil {
+		return false
+	}
+	if found {
+		_, err := strconv.Atoi(n)
+		return err == nil
+	}
+	return true
+}
+
+func day(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,140 @@
+package logger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// A clock the test moves forward by hand
+func steppingClock(start string) (func() time.Time, func(time.Duration)) {
+	now, _ := time.Parse(time.RFC3339, start)
+	return func() time.Time { return now }, func(d time.Duration) { now = now.Add(d) }
+}
+
+func listDir(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRotateBySizeKeepsNewest(t *testing.T) {
+	dir := t.TempDir()
+	clock, advance := steppingClock("2022-04-30T10:00:00Z")
+	var problems bytes.Buffer
+	r, err := NewRotatingFile(filepath.Join(dir, "mingo.log"), Rotation{MaxSize: 10, Keep: 2}, clock, &problems)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		r.Write([]byte(line))
+		advance(time.Second)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"mingo.log", "mingo.log.20220430-100002", "mingo.log.20220430-100003"}
+	if got := listDir(t, dir); !equal(got, want) {
+		t.Errorf("files got %v, want %v", got, want)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "mingo.log")); string(b) != "fourth\n" {
+		t.Errorf("current log got %q", b)
+	}
+	if problems.Len() > 0 {
+		t.Errorf("problems got %q", problems.String())
+	}
+}
+
+func TestRotateDailyAndCompress(t *testing.T) {
+	dir := t.TempDir()
+	clock, advance := steppingClock("2022-04-30T23:59:59Z")
+	r, err := NewRotatingFile(filepath.Join(dir, "mingo.log"), Rotation{Daily: true, Compress: true}, clock, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Write([]byte("saturday\n"))
+	r.Write([]byte("still saturday\n"))
+	advance(2 * time.Second)
+	r.Write([]byte("sunday\n"))
+	r.Close()
+
+	want := []string{"mingo.log", "mingo.log.20220501-000001.gz"}
+	if got := listDir(t, dir); !equal(got, want) {
+		t.Fatalf("files got %v, want %v", got, want)
+	}
+	f, _ := os.Open(filepath.Join(dir, want[1]))
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := io.ReadAll(zr); string(b) != "saturday\nstill saturday\n" {
+		t.Errorf("archive got %q", b)
+	}
+}
+
+func TestReopenAfterExternalRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mingo.log")
+	r, err := NewRotatingFile(path, Rotation{}, time.Now, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.Write([]byte("before\n"))
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	r.Write([]byte("still the moved file\n"))
+	if err := r.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	r.Write([]byte("after\n"))
+
+	if b, _ := os.ReadFile(path + ".1"); string(b) != "before\nstill the moved file\n" {
+		t.Errorf("moved log got %q", b)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "after\n" {
+		t.Errorf("reopened log got %q", b)
+	}
+}
+
+func TestPruneLeavesOtherFilesAlone(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mingo.log")
+	for _, name := range []string{"mingo.log.access", "mingo.log.20220429-000000.gz", "mingo.log.20220430-000000.1"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+	r := &RotatingFile{path: path, rotation: Rotation{Keep: 1}}
+	if err := r.prune(); err != nil {
+		t.Fatal(err)
+	}
+	if got := listDir(t, dir); len(got) != 2 || got[1] != "mingo.log.access" {
+		t.Errorf("files got %v, want mingo.log.access and one archive", got)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
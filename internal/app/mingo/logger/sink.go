@@ -0,0 +1,191 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+// A Sink takes whole lines with their component, level & request id rather than text, so a collector
+// like journald or syslog can keep them apart. Component loggers whose destination is a Sink send
+// to it instead of writing the "<time> | <host> | <component> | <message>" format
+type Sink interface {
+	io.Writer // text from anything that isn't a component logger, sent as info lines
+	Send(e Entry) error
+	Close() error
+}
+
+// Where --log-sink sends the log
+//
+//	journald	the native protocol over /run/systemd/journal/socket
+//	syslog	RFC 5424 over /dev/log
+//	syslog+unix:///path	RFC 5424 over another Unix datagram socket
+//	syslog+udp://host[:port]	RFC 5424 over UDP, port 514 by default
+//	syslog+tcp://host[:port]	RFC 5424 over TCP with octet counting framing, port 514 by default
+type SinkAddress struct {
+	Protocol string // journald or syslog
+	Network  string // unixgram, udp or tcp
+	Address  string
+}
+
+const (
+	journalSocket = "/run/systemd/journal/socket"
+	syslogSocket  = "/dev/log"
+)
+
+func ParseSinkAddress(spec string) (SinkAddress, error) {
+	switch spec {
+	case "journald":
+		return SinkAddress{"journald", "unixgram", journalSocket}, nil
+	case "syslog":
+		return SinkAddress{"syslog", "unixgram", syslogSocket}, nil
+	}
+	u, err := url.Parse(spec)
+	if err != nil || !strings.HasPrefix(u.Scheme, "syslog+") {
+		return SinkAddress{}, fmt.Errorf("unknown log sink %q, want journald, syslog or syslog+{unix,udp,tcp}://<address>", spec)
+	}
+	switch network := strings.TrimPrefix(u.Scheme, "syslog+"); network {
+	case "unix":
+		if u.Path == "" {
+			return SinkAddress{}, fmt.Errorf("log sink %q has no socket path", spec)
+		}
+		return SinkAddress{"syslog", "unixgram", u.Path}, nil
+	case "udp", "tcp":
+		if u.Hostname() == "" {
+			return SinkAddress{}, fmt.Errorf("log sink %q has no host", spec)
+		}
+		port := u.Port()
+		if port == "" {
+			port = "514"
+		}
+		return SinkAddress{"syslog", network, net.JoinHostPort(u.Hostname(), port)}, nil
+	}
+	return SinkAddress{}, fmt.Errorf("unknown log sink %q, want journald, syslog or syslog+{unix,udp,tcp}://<address>", spec)
+}
+
+// String as ParseSinkAddress reads it
+func (a SinkAddress) String() string {
+	switch {
+	case a.Protocol == "":
+		return ""
+	case a.Protocol == "journald":
+		return "journald"
+	case a.Network == "unixgram" && a.Address == syslogSocket:
+		return "syslog"
+	case a.Network == "unixgram":
+		return "syslog+unix://" + a.Address
+	}
+	return "syslog+" + a.Network + "://" + a.Address
+}
+
+// OpenSink connects to the address. When the collector can't take a line, e.g. it's restarting, the
+// line is written to fallback in the component format instead and the sink reconnects a little later
+func OpenSink(a SinkAddress, clock system.Clock, hostname string, fallback io.Writer) (Sink, error) {
+	conn := &sinkConn{network: a.Network, address: a.Address, clock: clock, hostname: hostname, fallback: fallback}
+	if err := conn.dial(); err != nil {
+		return nil, err
+	}
+	if a.Protocol == "journald" {
+		return &Journald{conn}, nil
+	}
+	return &Syslog{conn}, nil
+}
+
+// How long a failing sink writes to its fallback before trying to reconnect
+const sinkRetry = 5 * time.Second
+
+// How long a line may take to send, a collector that stops reading mustn't stall every logger behind the lock
+const sinkWriteTimeout = time.Second
+
+// The connection a sink sends its lines down, shared by journald & syslog
+type sinkConn struct {
+	network, address string
+	clock            system.Clock
+	hostname         string
+	fallback         io.Writer
+
+	mu       sync.Mutex
+	conn     net.Conn
+	failedAt time.Time // zero while the sink is working
+}
+
+func (s *sinkConn) dial() error {
+	conn, err := net.DialTimeout(s.network, s.address, time.Second)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	return nil
+}
+
+// Send the encoded line, redialling once if the connection has gone, e.g. the collector restarted, but
+// not when it timed out, a stuck collector would take the new connection's lines just as slowly
+func (s *sinkConn) send(e Entry, payload []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.write(payload)
+	if ne, ok := err.(net.Error); err != nil && !(ok && ne.Timeout()) && s.failedAt.IsZero() && s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+		err = s.write(payload)
+	}
+	if err != nil {
+		if s.failedAt.IsZero() {
+			fmt.Fprint(s.fallback, formatLine(Entry{Time: s.clock().UTC(), Component: "main", Message: fmt.Sprintf("log sink %s failed, logging here until it's back: %v", s.address, err)}, s.hostname))
+		}
+		if s.conn != nil {
+			s.conn.Close()
+			s.conn = nil
+		}
+		s.failedAt = s.clock()
+		fmt.Fprint(s.fallback, formatLine(e, s.hostname))
+		return err
+	}
+	if !s.failedAt.IsZero() {
+		s.failedAt = time.Time{}
+		fmt.Fprint(s.fallback, formatLine(Entry{Time: s.clock().UTC(), Component: "main", Message: fmt.Sprintf("log sink %s is back", s.address)}, s.hostname))
+	}
+	return nil
+}
+
+func (s *sinkConn) write(payload []byte) error {
+	if s.conn == nil {
+		if !s.failedAt.IsZero() && s.clock().Sub(s.failedAt) < sinkRetry {
+			return fmt.Errorf("waiting to reconnect")
+		}
+		if err := s.dial(); err != nil {
+			return err
+		}
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(sinkWriteTimeout)) // real time, not the clock, the kernel keeps it
+	_, err := s.conn.Write(payload)
+	return err
+}
+
+func (s *sinkConn) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// Lines of text from elsewhere become info entries from no particular component
+func writeLines(sink Sink, clock system.Clock, p []byte) (int, error) {
+	now := clock().UTC()
+	for _, line := range strings.Split(strings.TrimSuffix(string(p), "\n"), "\n") {
+		if err := sink.Send(Entry{Time: now, Level: LevelInfo, Message: line}); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
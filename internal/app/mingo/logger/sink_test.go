@@ -0,0 +1,255 @@
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+var sinkClock = system.ClockForTesting("2022-04-30T23:59:59Z")
+
+// A fake collector on a datagram socket, returning each datagram it receives
+func listenPacket(t *testing.T, network, address string) (net.PacketConn, func() string) {
+	t.Helper()
+	pc, err := net.ListenPacket(network, address)
+	if err != nil {
+		t.Skipf("can't listen on %s: %v", network, err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	return pc, func() string {
+		buf := make([]byte, 65536)
+		pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("reading datagram: %v", err)
+		}
+		return string(buf[:n])
+	}
+}
+
+// Read the native protocol back into fields
+func parseJournal(t *testing.T, datagram string) map[string]string {
+	fields := map[string]string{}
+	for datagram != "" {
+		line, rest, _ := strings.Cut(datagram, "\n")
+		if name, value, ok := strings.Cut(line, "="); ok {
+			fields[name] = value
+			datagram = rest
+			continue
+		}
+		size := binary.LittleEndian.Uint64([]byte(rest[:8]))
+		fields[line] = rest[8 : 8+size]
+		if rest[8+size] != '\n' {
+			t.Fatalf("binary field %s isn't newline terminated", line)
+		}
+		datagram = rest[9+size:]
+	}
+	return fields
+}
+
+func TestJournaldFields(t *testing.T) {
+	restoreLevels(t)
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	_, receive := listenPacket(t, "unixgram", path)
+
+	sink, err := OpenSink(SinkAddress{"journald", "unixgram", path}, sinkClock, "testhost", &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	Warnf(NewComponentLogger(sinkClock, sink, "testhost", "sql"), "GetAll was slow, 1s")
+	fields := parseJournal(t, receive())
+	want := map[string]string{"MESSAGE": "GetAll was slow, 1s", "PRIORITY": "4", "SYSLOG_IDENTIFIER": "mingo", "COMPONENT": "sql"}
+	if len(fields) != len(want) {
+		t.Errorf("got %q, want %q", fields, want)
+	}
+	for name, value := range want {
+		if fields[name] != value {
+			t.Errorf("%s got %q, want %q", name, fields[name], value)
+		}
+	}
+
+	NewAccessLogger(AccessMingo, sinkClock, sink, "testhost").Log(AccessEntry{RequestId: "req-1", Method: "GET", Status: 200, Uri: "/health"})
+	if fields = parseJournal(t, receive()); fields["REQUEST_ID"] != "req-1" || fields["COMPONENT"] != "access" || fields["PRIORITY"] != "6" {
+		t.Errorf("access line got %q", fields)
+	}
+
+	sink.Send(Entry{Level: LevelError, Component: "error", Message: "panic serving req-2\ngoroutine 1 [running]:"})
+	if fields = parseJournal(t, receive()); fields["MESSAGE"] != "panic serving req-2\ngoroutine 1 [running]:" || fields["PRIORITY"] != "3" {
+		t.Errorf("multi-line message got %q", fields)
+	}
+}
+
+func TestSyslogOverUdpAndUnix(t *testing.T) {
+	pc, udp := listenPacket(t, "udp", "127.0.0.1:0")
+	path := filepath.Join(t.TempDir(), "log.sock")
+	_, unix := listenPacket(t, "unixgram", path)
+
+	want := "<28>1 2022-04-30T23:59:59.000000Z testhost mingo " + strconv.Itoa(os.Getpid()) + " throttle - rate limited 10.0.0.1"
+	for _, tt := range []struct {
+		address SinkAddress
+		receive func() string
+	}{
+		{SinkAddress{"syslog", "udp", pc.LocalAddr().String()}, udp},
+		{SinkAddress{"syslog", "unixgram", path}, unix},
+	} {
+		sink, err := OpenSink(tt.address, sinkClock, "testhost", &bytes.Buffer{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		Warnf(NewComponentLogger(sinkClock, sink, "testhost", "throttle"), "rate limited 10.0.0.1")
+		if got := tt.receive(); got != want {
+			t.Errorf("%s got %q, want %q", tt.address, got, want)
+		}
+		sink.Close()
+	}
+}
+
+func TestSyslogOverTcpIsOctetCounted(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	sink, err := OpenSink(SinkAddress{"syslog", "tcp", ln.Addr().String()}, sinkClock, "test host", &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sink.Send(Entry{Time: sinkClock(), Level: LevelDebug, Message: "two\nlines"})
+	sink.Write([]byte("from elsewhere\n"))
+
+	r := bufio.NewReader(conn)
+	for _, want := range []string{"<31>1 2022-04-30T23:59:59.000000Z testhost mingo ", "<30>1 "} {
+		size, err := r.ReadString(' ')
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(size))
+		message := make([]byte, n)
+		if _, err := io.ReadFull(r, message); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(message), want) {
+			t.Errorf("got %q, want it to start %q", message, want)
+		}
+	}
+}
+
+func TestSinkFallsBackWhileTheCollectorIsAway(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	pc, _ := listenPacket(t, "unixgram", path)
+	var fallback bytes.Buffer
+	sink, err := OpenSink(SinkAddress{"journald", "unixgram", path}, sinkClock, "testhost", &fallback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	pc.Close()
+	os.Remove(path)
+	l := NewComponentLogger(sinkClock, sink, "testhost", "sql")
+	l.Println("first")
+	l.Println("second")
+
+	want := "2022-04-30T23:59:59Z | testhost | main | log sink " + path + " failed, logging here until it's back: "
+	lines := strings.Split(fallback.String(), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], want) ||
+		lines[1] != "2022-04-30T23:59:59Z | testhost | sql | first" || lines[2] != "2022-04-30T23:59:59Z | testhost | sql | second" {
+		t.Errorf("fallback got %q", fallback.String())
+	}
+}
+
+func TestSinkFallsBackWhenTheCollectorStopsReading(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() { // accept but never read, until the socket buffers fill
+		var conns []net.Conn
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				for _, c := range conns {
+					c.Close()
+				}
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+	var fallback bytes.Buffer
+	sink, err := OpenSink(SinkAddress{"syslog", "tcp", ln.Addr().String()}, sinkClock, "testhost", &fallback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	big := strings.Repeat("x", 1<<20)
+	for i := 0; ; i++ {
+		if i == 256 {
+			t.Fatal("256M sent to a collector that doesn't read, want the writes to time out")
+		}
+		start := time.Now()
+		err := sink.Send(Entry{Time: sinkClock(), Level: LevelInfo, Component: "sql", Message: big})
+		if took := time.Since(start); took > sinkWriteTimeout+time.Second {
+			t.Fatalf("send took %s, want at most about %s", took, sinkWriteTimeout)
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	start := time.Now()
+	if err := sink.Send(Entry{Time: sinkClock(), Level: LevelInfo, Component: "sql", Message: "next"}); err == nil || time.Since(start) > 100*time.Millisecond {
+		t.Errorf("send after the timeout got %v after %s, want the fallback straight away", err, time.Since(start))
+	}
+	if !strings.HasPrefix(fallback.String(), "2022-04-30T23:59:59Z | testhost | main | log sink "+ln.Addr().String()+" failed") ||
+		!strings.HasSuffix(fallback.String(), "2022-04-30T23:59:59Z | testhost | sql | next\n") {
+		t.Errorf("fallback got %.200q...%q", fallback.String(), fallback.String()[fallback.Len()-60:])
+	}
+}
+
+func TestParseSinkAddress(t *testing.T) {
+	for _, tt := range []struct {
+		spec string
+		want SinkAddress
+		err  bool
+	}{
+		{"journald", SinkAddress{"journald", "unixgram", "/run/systemd/journal/socket"}, false},
+		{"syslog", SinkAddress{"syslog", "unixgram", "/dev/log"}, false},
+		{"syslog+unix:///var/run/log", SinkAddress{"syslog", "unixgram", "/var/run/log"}, false},
+		{"syslog+udp://logs.example.com", SinkAddress{"syslog", "udp", "logs.example.com:514"}, false},
+		{"syslog+tcp://[::1]:6514", SinkAddress{"syslog", "tcp", "[::1]:6514"}, false},
+		{"syslog+tcp://", SinkAddress{}, true},
+		{"syslog+unix://", SinkAddress{}, true},
+		{"syslog+sctp://host", SinkAddress{}, true},
+		{"stderr", SinkAddress{}, true},
+	} {
+		got, err := ParseSinkAddress(tt.spec)
+		if got != tt.want || (err != nil) != tt.err {
+			t.Errorf("%q got %+v, %v", tt.spec, got, err)
+		}
+		if err == nil && got.String() != tt.spec && tt.spec != "syslog+udp://logs.example.com" {
+			t.Errorf("%q formats as %q", tt.spec, got.String())
+		}
+	}
+}
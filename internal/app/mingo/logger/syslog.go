@@ -0,0 +1,49 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Sends lines as RFC 5424 syslog messages from the daemon facility, the component is the MSGID
+type Syslog struct {
+	*sinkConn
+}
+
+const facilityDaemon = 3
+
+func (s *Syslog) Send(e Entry) error {
+	message := syslogMessage(e, s.hostname, os.Getpid())
+	if s.network == "tcp" { // RFC 6587 octet counting, the message may contain newlines
+		message = fmt.Sprintf("%d %s", len(message), message)
+	}
+	return s.send(e, []byte(message))
+}
+
+func (s *Syslog) Write(p []byte) (int, error) {
+	return writeLines(s, s.clock, p)
+}
+
+// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func syslogMessage(e Entry, hostname string, pid int) string {
+	return fmt.Sprintf("<%d>1 %s %s mingo %d %s - %s", facilityDaemon*8+severities[e.Level],
+		e.Time.UTC().Format("2006-01-02T15:04:05.000000Z07:00"), syslogName(hostname, 255), pid, syslogName(e.Component, 32), e.Message)
+}
+
+// Header fields are printable ASCII without spaces, "-" when there's nothing to say
+func syslogName(s string, limit int) string {
+	s = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return -1
+		}
+		return r
+	}, s)
+	if len(s) > limit {
+		s = s[:limit]
+	}
+	if s == "" {
+		return "-"
+	}
+	return s
+}
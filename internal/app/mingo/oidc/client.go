@@ -0,0 +1,131 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+	"github.com/craigjperry2/mingo/internal/app/mingo/tracing"
+)
+
+// Client is a relying party of one provider. Discovery happens on first use, not at startup, so the
+// server still comes up (and password logins still work) while the provider is unreachable
+type Client struct {
+	issuer       string
+	clientId     string
+	clientSecret string // empty for a public client, PKCE alone protects the code
+	httpClient   *http.Client
+	clock        system.Clock
+
+	mu       sync.Mutex
+	metadata *providerMetadata
+	keys     *keySet
+}
+
+// NewClient for the provider at issuer, httpClient may be nil for a default with a timeout
+func NewClient(issuer string, clientId string, clientSecret string, httpClient *http.Client, clock system.Clock) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Client{issuer: issuer, clientId: clientId, clientSecret: clientSecret, httpClient: httpClient, clock: clock}
+}
+
+func (c *Client) Issuer() string {
+	return c.issuer
+}
+
+func (c *Client) provider() (providerMetadata, *keySet, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.metadata == nil {
+		m, err := discover(c.httpClient, c.issuer)
+		if err != nil {
+			return m, nil, err
+		}
+		c.metadata = &m
+		c.keys = &keySet{client: c.httpClient, uri: m.JwksUri, clock: c.clock}
+	}
+	return *c.metadata, c.keys, nil
+}
+
+// AuthCodeURL is where to send the browser to log in, the provider redirects back to redirectUri
+func (c *Client) AuthCodeURL(redirectUri string, state string, nonce string, verifier string) (string, error) {
+	m, _, err := c.provider()
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(m.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("authorization endpoint: %w", err)
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", c.clientId)
+	q.Set("redirect_uri", redirectUri)
+	q.Set("scope", "openid profile email")
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", PkceChallenge(verifier))
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Exchange redeems an authorization code and returns the validated ID token's claims
+func (c *Client) Exchange(ctx context.Context, code string, redirectUri string, verifier string, nonce string) (Claims, error) {
+	m, keys, err := c.provider()
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectUri},
+		"code_verifier": {verifier},
+	}
+	if c.clientSecret == "" {
+		form.Set("client_id", c.clientId)
+	}
+	ctx, span := tracing.Start(ctx, tracing.KindClient, "POST "+m.TokenEndpoint)
+	defer span.End()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	tracing.Inject(ctx, req.Header)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.clientId), url.QueryEscape(c.clientSecret)) // RFC 6749 2.3.1
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		span.SetError(err)
+		return nil, fmt.Errorf("token endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+	span.SetAttribute("http.status_code", resp.StatusCode)
+	var body struct {
+		IdToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("token endpoint: %s: %w", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK || body.Error != "" {
+		return nil, fmt.Errorf("token endpoint: %s: %s %s", resp.Status, body.Error, body.ErrorDescription)
+	}
+	if body.IdToken == "" {
+		return nil, fmt.Errorf("token endpoint: no id_token, is the openid scope allowed?")
+	}
+	return c.verifyIdToken(keys, body.IdToken, nonce)
+}
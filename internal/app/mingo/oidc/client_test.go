@@ -0,0 +1,126 @@
+package oidc_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/oidc"
+	"github.com/craigjperry2/mingo/internal/app/mingo/oidc/fakeidp"
+)
+
+const redirectUri = "https://mingo.test/login/oidc/callback"
+
+// Run the browser's side of the flow: visit the authorize URL and return the code it redirects back with
+func authorize(t *testing.T, idp *fakeidp.Provider, client *oidc.Client, nonce string, verifier string) string {
+	t.Helper()
+	authUrl, err := client.AuthCodeURL(redirectUri, "the-state", nonce, verifier)
+	if err != nil {
+		t.Fatalf("auth code url err want nil, got %v", err)
+	}
+	browser := idp.Client()
+	browser.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := browser.Get(authUrl)
+	if err != nil {
+		t.Fatalf("authorize err want nil, got %v", err)
+	}
+	resp.Body.Close()
+	back, _ := url.Parse(resp.Header.Get("Location"))
+	if !strings.HasPrefix(back.String(), redirectUri) || back.Query().Get("state") != "the-state" {
+		t.Fatalf("authorize redirected to %q, want %s with the state", back, redirectUri)
+	}
+	return back.Query().Get("code")
+}
+
+func newProvider(t *testing.T, secret string) (*fakeidp.Provider, *oidc.Client) {
+	t.Helper()
+	idp, err := fakeidp.New("https://idp.test/realms/corp", "mingo", secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.Login(map[string]interface{}{"sub": "u-123", "preferred_username": "alice", "groups": []string{"staff"}})
+	return idp, oidc.NewClient(idp.Issuer, "mingo", secret, idp.Client(), time.Now)
+}
+
+func TestExchange(t *testing.T) {
+	for _, secret := range []string{"", "s3cret"} {
+		idp, client := newProvider(t, secret)
+		code := authorize(t, idp, client, "n-1", "v-1")
+		claims, err := client.Exchange(context.Background(), code, redirectUri, "v-1", "n-1")
+		if err != nil {
+			t.Fatalf("secret %q exchange err want nil, got %v", secret, err)
+		}
+		if claims.String("sub") != "u-123" || claims.String("preferred_username") != "alice" || claims.Strings("groups")[0] != "staff" {
+			t.Errorf("claims got %v", claims)
+		}
+		if _, err := client.Exchange(context.Background(), code, redirectUri, "v-1", "n-1"); err == nil {
+			t.Errorf("secret %q replayed code err want invalid_grant, got nil", secret)
+		}
+	}
+}
+
+func TestExchangeRejects(t *testing.T) {
+	var tests = []struct {
+		desc    string
+		tamper  func(claims map[string]interface{})
+		wantErr string
+	}{
+		{"wrong audience", func(c map[string]interface{}) { c["aud"] = "someone-else" }, "audience"},
+		{"wrong issuer", func(c map[string]interface{}) { c["iss"] = "https://evil.test" }, "issuer"},
+		{"expired", func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, "expired"},
+		{"issued in the future", func(c map[string]interface{}) { c["iat"] = time.Now().Add(time.Hour).Unix() }, "future"},
+		{"replayed nonce", func(c map[string]interface{}) { c["nonce"] = "n-other" }, "nonce"},
+		{"foreign authorized party", func(c map[string]interface{}) { c["aud"] = []string{"mingo", "other"}; c["azp"] = "other" }, "authorized party"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			idp, client := newProvider(t, "s3cret")
+			idp.Tamper = tt.tamper
+			code := authorize(t, idp, client, "n-1", "v-1")
+			if _, err := client.Exchange(context.Background(), code, redirectUri, "v-1", "n-1"); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err got %v, want mention of %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	idp, client := newProvider(t, "s3cret")
+	code := authorize(t, idp, client, "n-1", "v-1")
+	if _, err := client.Exchange(context.Background(), code, redirectUri, "wrong-verifier", "n-1"); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("wrong PKCE verifier err got %v, want invalid_grant", err)
+	}
+
+	wrongSecret := oidc.NewClient(idp.Issuer, "mingo", "guess", idp.Client(), time.Now)
+	code = authorize(t, idp, client, "n-1", "v-1")
+	if _, err := wrongSecret.Exchange(context.Background(), code, redirectUri, "v-1", "n-1"); err == nil || !strings.Contains(err.Error(), "invalid_client") {
+		t.Errorf("wrong client secret err got %v, want invalid_client", err)
+	}
+}
+
+func TestKeyRotationRefetchesJwks(t *testing.T) {
+	now := time.Now()
+	idp, _ := newProvider(t, "")
+	client := oidc.NewClient(idp.Issuer, "mingo", "", idp.Client(), func() time.Time { return now })
+	if _, err := client.Exchange(context.Background(), authorize(t, idp, client, "n", "v"), redirectUri, "v", "n"); err != nil {
+		t.Fatalf("first exchange err want nil, got %v", err)
+	}
+
+	idp.RotateKey()
+	if _, err := client.Exchange(context.Background(), authorize(t, idp, client, "n", "v"), redirectUri, "v", "n"); err == nil {
+		t.Errorf("unknown key straight after a fetch err want error, got nil")
+	}
+	now = now.Add(2 * time.Minute)
+	if _, err := client.Exchange(context.Background(), authorize(t, idp, client, "n", "v"), redirectUri, "v", "n"); err != nil {
+		t.Errorf("rotated key err want nil, got %v", err)
+	}
+}
+
+func TestDiscoveryChecksIssuer(t *testing.T) {
+	idp, _ := newProvider(t, "")
+	client := oidc.NewClient("https://idp.test/realms/corp/", "mingo", "", idp.Client(), time.Now)
+	if _, err := client.AuthCodeURL(redirectUri, "s", "n", "v"); err == nil || !strings.Contains(err.Error(), "doesn't match") {
+		t.Errorf("err got %v, want issuer mismatch", err)
+	}
+}
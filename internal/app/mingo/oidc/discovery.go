@@ -0,0 +1,60 @@
+package oidc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// The parts of the provider's /.well-known/openid-configuration document we use
+type providerMetadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JwksUri               string   `json:"jwks_uri"`
+	CodeChallengeMethods  []string `json:"code_challenge_methods_supported"`
+}
+
+func discover(client *http.Client, issuer string) (providerMetadata, error) {
+	var m providerMetadata
+	if err := getJson(client, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", &m); err != nil {
+		return m, fmt.Errorf("discovery: %w", err)
+	}
+	// A document claiming a different issuer could be an attempt to pass off another provider's tokens
+	if m.Issuer != issuer {
+		return m, fmt.Errorf("discovery: issuer %q doesn't match configured %q", m.Issuer, issuer)
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JwksUri == "" {
+		return m, fmt.Errorf("discovery: authorization, token or jwks endpoint missing")
+	}
+	if len(m.CodeChallengeMethods) > 0 && !contains(m.CodeChallengeMethods, "S256") {
+		return m, fmt.Errorf("discovery: provider doesn't support S256 PKCE")
+	}
+	return m, nil
+}
+
+func getJson(client *http.Client, url string, v interface{}) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v); err != nil {
+		return fmt.Errorf("GET %s: %w", url, err)
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,3 @@
+// Package oidc is a relying party for OpenID Connect's authorization code flow with PKCE: provider
+// discovery, a cached JWKS, ID token validation and mapping claims to mingo roles
+package oidc
@@ -0,0 +1,244 @@
+// Package fakeidp is an in-memory OpenID Connect provider for tests: discovery, JWKS, an authorize
+// endpoint that approves whoever Login says is signed in, and a token endpoint that checks PKCE
+// Its Client talks to it in-process so a whole login flow runs without network access
+package fakeidp
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Provider at Issuer that knows one client
+type Provider struct {
+	Issuer       string
+	ClientId     string
+	ClientSecret string // empty for a public client
+	Clock        func() time.Time
+
+	// Tamper, when set, edits ID token claims before signing to test how relying parties cope
+	Tamper func(claims map[string]interface{})
+
+	mu     sync.Mutex
+	key    *rsa.PrivateKey
+	kid    int
+	user   map[string]interface{}
+	grants map[string]grant
+}
+
+type grant struct {
+	claims      map[string]interface{}
+	nonce       string
+	challenge   string
+	redirectUri string
+}
+
+func New(issuer string, clientId string, clientSecret string) (*Provider, error) {
+	p := &Provider{Issuer: issuer, ClientId: clientId, ClientSecret: clientSecret, Clock: time.Now, grants: map[string]grant{}}
+	return p, p.RotateKey()
+}
+
+// Login sets who the provider authenticates at its authorize endpoint, claims must include "sub"
+// nil means nobody, authorize then answers access_denied
+func (p *Provider) Login(claims map[string]interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.user = claims
+}
+
+// RotateKey signs future ID tokens with a new key under a new key id, the old one leaves the JWKS
+func (p *Provider) RotateKey() error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.key = key
+	p.kid++
+	return nil
+}
+
+// Client is an HTTP client whose requests to the issuer are served in-process
+func (p *Provider) Client() *http.Client {
+	return &http.Client{Transport: roundTripper{p}}
+}
+
+type roundTripper struct {
+	p *Provider
+}
+
+func (rt roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	issuer, err := url.Parse(rt.p.Issuer)
+	if err != nil || req.URL.Host != issuer.Host || req.URL.Scheme != issuer.Scheme {
+		return nil, fmt.Errorf("fakeidp: no route to %s", req.URL)
+	}
+	w := httptest.NewRecorder()
+	rt.p.ServeHTTP(w, req)
+	return w.Result(), nil
+}
+
+func (p *Provider) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	issuer, _ := url.Parse(p.Issuer)
+	switch strings.TrimPrefix(req.URL.Path, strings.TrimSuffix(issuer.Path, "/")) {
+	case "/.well-known/openid-configuration":
+		writeJson(w, http.StatusOK, map[string]interface{}{
+			"issuer":                                p.Issuer,
+			"authorization_endpoint":                p.endpoint("/authorize"),
+			"token_endpoint":                        p.endpoint("/token"),
+			"jwks_uri":                              p.endpoint("/jwks"),
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+			"code_challenge_methods_supported":      []string{"S256"},
+		})
+	case "/jwks":
+		p.mu.Lock()
+		key, kid := p.key.PublicKey, p.kid
+		p.mu.Unlock()
+		writeJson(w, http.StatusOK, map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": fmt.Sprint(kid),
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	case "/authorize":
+		p.authorize(w, req)
+	case "/token":
+		p.token(w, req)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func (p *Provider) endpoint(path string) string {
+	return strings.TrimSuffix(p.Issuer, "/") + path
+}
+
+func (p *Provider) authorize(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+	redirectUri, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || !redirectUri.IsAbs() || q.Get("client_id") != p.ClientId {
+		http.Error(w, "unknown client or bad redirect_uri", http.StatusBadRequest)
+		return
+	}
+	reply := url.Values{"state": {q.Get("state")}}
+	p.mu.Lock()
+	user := p.user
+	switch {
+	case q.Get("response_type") != "code":
+		reply.Set("error", "unsupported_response_type")
+	case q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "":
+		reply.Set("error", "invalid_request")
+	case !strings.Contains(" "+q.Get("scope")+" ", " openid "):
+		reply.Set("error", "invalid_scope")
+	case user == nil:
+		reply.Set("error", "access_denied")
+	default:
+		code := randomString()
+		p.grants[code] = grant{user, q.Get("nonce"), q.Get("code_challenge"), q.Get("redirect_uri")}
+		reply.Set("code", code)
+	}
+	p.mu.Unlock()
+
+	redirectUri.RawQuery = reply.Encode()
+	http.Redirect(w, req, redirectUri.String(), http.StatusFound)
+}
+
+func (p *Provider) token(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost || req.ParseForm() != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	clientId, clientSecret, basic := req.BasicAuth()
+	if basic {
+		clientId, _ = url.QueryUnescape(clientId)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientId = req.PostFormValue("client_id")
+	}
+	if clientId != p.ClientId || clientSecret != p.ClientSecret {
+		writeJson(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if req.PostFormValue("grant_type") != "authorization_code" {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	p.mu.Lock()
+	code := req.PostFormValue("code")
+	g, ok := p.grants[code]
+	delete(p.grants, code) // single use
+	key, kid := p.key, p.kid
+	p.mu.Unlock()
+	verifier := sha256.Sum256([]byte(req.PostFormValue("code_verifier")))
+	if !ok || g.redirectUri != req.PostFormValue("redirect_uri") || base64.RawURLEncoding.EncodeToString(verifier[:]) != g.challenge {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := p.Clock()
+	claims := map[string]interface{}{}
+	for k, v := range g.claims {
+		claims[k] = v
+	}
+	claims["iss"] = p.Issuer
+	claims["aud"] = p.ClientId
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(5 * time.Minute).Unix()
+	if g.nonce != "" {
+		claims["nonce"] = g.nonce
+	}
+	if p.Tamper != nil {
+		p.Tamper(claims)
+	}
+	idToken, err := sign(key, fmt.Sprint(kid), claims)
+	if err != nil {
+		writeJson(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]interface{}{"access_token": randomString(), "token_type": "Bearer", "expires_in": 300, "id_token": idToken})
+}
+
+// Sign claims as an RS256 JWT
+func sign(key *rsa.PrivateKey, kid string, claims map[string]interface{}) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func writeJson(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,113 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Tolerated clock difference between us and the provider
+const clockSkew = time.Minute
+
+// Claims of a validated ID token, e.g. "sub", "email", "groups"
+type Claims map[string]interface{}
+
+// String returns a string claim, or "" when missing or not a string
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Strings returns a claim that may be a single string or an array of strings, e.g. groups
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var result []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+func (c Claims) time(name string) (time.Time, bool) {
+	f, ok := c[name].(float64)
+	return time.Unix(int64(f), 0), ok
+}
+
+// Check the signature & the claims OpenID Connect Core 3.1.3.7 requires of an ID token
+func (c *Client) verifyIdToken(keys *keySet, rawToken string, nonce string) (Claims, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("id token: malformed")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("id token header: %w", err)
+	}
+	if header.Alg != "RS256" { // never "none", nor HS256 keyed with a public key
+		return nil, fmt.Errorf("id token: unsupported algorithm %q", header.Alg)
+	}
+	key, err := keys.key(header.Kid)
+	if err != nil {
+		return nil, fmt.Errorf("id token: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("id token signature: %w", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Errorf("id token: bad signature")
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("id token claims: %w", err)
+	}
+	if iss := claims.String("iss"); iss != c.issuer {
+		return nil, fmt.Errorf("id token: issuer %q, want %q", iss, c.issuer)
+	}
+	audience := claims.Strings("aud")
+	if !contains(audience, c.clientId) {
+		return nil, fmt.Errorf("id token: audience %q doesn't include %q", audience, c.clientId)
+	}
+	if azp := claims.String("azp"); (len(audience) > 1 || azp != "") && azp != c.clientId {
+		return nil, fmt.Errorf("id token: authorized party %q, want %q", azp, c.clientId)
+	}
+	now := c.clock()
+	if exp, ok := claims.time("exp"); !ok || !now.Before(exp.Add(clockSkew)) {
+		return nil, fmt.Errorf("id token: expired")
+	}
+	if iat, ok := claims.time("iat"); !ok || iat.After(now.Add(clockSkew)) {
+		return nil, fmt.Errorf("id token: issued in the future")
+	}
+	if claims.String("nonce") != nonce { // binds the token to this browser's login attempt
+		return nil, fmt.Errorf("id token: nonce mismatch")
+	}
+	if claims.String("sub") == "" {
+		return nil, fmt.Errorf("id token: no subject")
+	}
+	return claims, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
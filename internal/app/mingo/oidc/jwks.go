@@ -0,0 +1,97 @@
+package oidc
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+// Keys are refetched after jwksMaxAge, or sooner when a token names an unknown key (the provider rotated)
+// but no more often than jwksMinRefresh so junk tokens can't make us hammer the provider
+const (
+	jwksMaxAge     = time.Hour
+	jwksMinRefresh = time.Minute
+)
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// A cache of the provider's signing keys by key id
+type keySet struct {
+	client    *http.Client
+	uri       string
+	clock     system.Clock
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+func (ks *keySet) key(kid string) (*rsa.PublicKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	now := ks.clock()
+	key, known := ks.keys[kid]
+	stale := now.Sub(ks.fetchedAt) > jwksMaxAge
+	if (!known || stale) && now.Sub(ks.fetchedAt) > jwksMinRefresh {
+		if err := ks.fetch(now); err != nil {
+			if known {
+				return key, nil // ride out a provider blip with the key we have
+			}
+			return nil, err
+		}
+		key, known = ks.keys[kid]
+	}
+	if !known {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (ks *keySet) fetch(now time.Time) error {
+	var doc struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJson(ks.client, ks.uri, &doc); err != nil {
+		return fmt.Errorf("jwks: %w", err)
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range doc.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") || (k.Alg != "" && k.Alg != "RS256") {
+			continue // only RS256, the algorithm every provider must support
+		}
+		if key, err := rsaPublicKey(k); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	ks.keys, ks.fetchedAt = keys, now
+	return nil
+}
+
+func rsaPublicKey(k jsonWebKey) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+	exponent := new(big.Int).SetBytes(e)
+	if len(n) < 2048/8 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("unsuitable RSA key %q", k.Kid)
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
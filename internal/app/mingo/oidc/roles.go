@@ -0,0 +1,50 @@
+package oidc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/auth"
+)
+
+// RoleMap turns the values of a claim, typically groups, into a mingo role
+// The most powerful matching role wins, "*" matches anyone, no match means no access
+type RoleMap struct {
+	Claim string
+	roles map[string]string
+}
+
+// ParseRoleMap reads value=role pairs, e.g. ["mingo-admins=admin", "staff=editor", "*=viewer"]
+func ParseRoleMap(claim string, pairs []string) (RoleMap, error) {
+	rm := RoleMap{Claim: claim, roles: map[string]string{}}
+	for _, pair := range pairs {
+		value, role, ok := strings.Cut(pair, "=")
+		if !ok || value == "" {
+			return rm, fmt.Errorf("role mapping %q, want <claim value>=<role>", pair)
+		}
+		if _, err := auth.ParseRole(role); err != nil {
+			return rm, err
+		}
+		rm.roles[value] = role
+	}
+	return rm, nil
+}
+
+// Role for the claims, false when nothing matches
+func (rm RoleMap) Role(claims Claims) (string, bool) {
+	best, found := "", false
+	consider := func(role string) {
+		if !found || auth.RoleRank(role) > auth.RoleRank(best) {
+			best, found = role, true
+		}
+	}
+	for _, value := range claims.Strings(rm.Claim) {
+		if role, ok := rm.roles[value]; ok {
+			consider(role)
+		}
+	}
+	if role, ok := rm.roles["*"]; ok {
+		consider(role)
+	}
+	return best, found
+}
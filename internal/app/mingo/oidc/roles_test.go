@@ -0,0 +1,38 @@
+package oidc
+
+import "testing"
+
+func TestRoleMap(t *testing.T) {
+	rm, err := ParseRoleMap("groups", []string{"mingo-admins=admin", "staff=editor", "*=viewer"})
+	if err != nil {
+		t.Fatalf("parse err want nil, got %v", err)
+	}
+	strict, _ := ParseRoleMap("groups", []string{"staff=editor"})
+
+	var tests = []struct {
+		desc     string
+		rm       RoleMap
+		claims   Claims
+		wantRole string
+		wantOk   bool
+	}{
+		{"most powerful match wins", rm, Claims{"groups": []interface{}{"staff", "mingo-admins"}}, "admin", true},
+		{"single string claim", rm, Claims{"groups": "staff"}, "editor", true},
+		{"wildcard", rm, Claims{"groups": []interface{}{"contractors"}}, "viewer", true},
+		{"missing claim gets wildcard", rm, Claims{}, "viewer", true},
+		{"no match without wildcard", strict, Claims{"groups": []interface{}{"contractors"}}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if role, ok := tt.rm.Role(tt.claims); role != tt.wantRole || ok != tt.wantOk {
+				t.Errorf("got %q %v, want %q %v", role, ok, tt.wantRole, tt.wantOk)
+			}
+		})
+	}
+
+	for _, bad := range []string{"staff", "=admin", "staff=root"} {
+		if _, err := ParseRoleMap("groups", []string{bad}); err == nil {
+			t.Errorf("parse %q err want error, got nil", bad)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/httpserver/handlers"
+	"github.com/craigjperry2/mingo/internal/app/mingo/logger"
+)
+
+// A part of the app with a lifecycle of its own, e.g. the database or an HTTP server
+// Any of the hooks may be nil when there's nothing to do
+type component struct {
+	name        string
+	dependsOn   []string                        // started before this one, stopped after it
+	start       func(ctx context.Context) error // returns once started, long running work carries on in goroutines
+	stop        func(ctx context.Context) error // ctx expires after stopTimeout, or sooner when the stop is forced
+	health      func(ctx context.Context) error // nil when healthy
+	stopTimeout time.Duration                   // defaultStopTimeout when zero
+}
+
+const (
+	defaultStopTimeout = 5 * time.Second
+	healthTimeout      = 2 * time.Second
+)
+
+// The app's components, started in dependency order and stopped in reverse. A component that fails
+// to start, or fails once running, moves the app to Stopping and the rest are stopped
+type registry struct {
+	log        *log.Logger
+	mu         sync.Mutex
+	components []*component
+	started    []*component
+	failed     chan error
+}
+
+func newRegistry(log *log.Logger) *registry {
+	return &registry{log: log, failed: make(chan error, 1)}
+}
+
+func (r *registry) register(c component) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.components {
+		if existing.name == c.name {
+			panic("programmer error: component " + c.name + " registered twice")
+		}
+	}
+	r.components = append(r.components, &c)
+}
+
+// Components after those they depend on, otherwise in the order they were registered
+func (r *registry) ordered() ([]*component, error) {
+	byName := map[string]*component{}
+	for _, c := range r.components {
+		byName[c.name] = c
+	}
+	var ordered []*component
+	state := map[string]int{} // 1 while visiting, 2 once ordered
+	var visit func(c *component, path []string) error
+	visit = func(c *component, path []string) error {
+		switch state[c.name] {
+		case 1:
+			return fmt.Errorf("components depend on each other: %v", append(path, c.name))
+		case 2:
+			return nil
+		}
+		state[c.name] = 1
+		for _, name := range c.dependsOn {
+			dep, ok := byName[name]
+			if !ok {
+				return fmt.Errorf("component %s depends on unknown component %s", c.name, name)
+			}
+			if err := visit(dep, append(path, c.name)); err != nil {
+				return err
+			}
+		}
+		state[c.name] = 2
+		ordered = append(ordered, c)
+		return nil
+	}
+	for _, c := range r.components {
+		if err := visit(c, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// Start every component not yet started. On failure the app moves to Stopping, those already started
+// are stopped, the app moves to Failed and the failing component's error is returned
+func (r *registry) start(ctx context.Context) error {
+	r.mu.Lock()
+	ordered, err := r.ordered()
+	r.mu.Unlock()
+	if err != nil {
+		panic("programmer error: " + err.Error())
+	}
+	for _, c := range ordered {
+		if r.isStarted(c) {
+			continue
+		}
+		if c.start != nil {
+			if err := c.start(ctx); err != nil {
+				logger.Errorf(r.log, "Could not start %s: %v\n", c.name, err)
+				transitionToStopping(fmt.Sprintf("could not start %s: %v", c.name, err))
+				r.stop(context.Background())
+				transitionToFailed(fmt.Sprintf("could not start %s", c.name))
+				return err
+			}
+		}
+		logger.Debugf(r.log, "Started %s\n", c.name)
+		r.mu.Lock()
+		r.started = append(r.started, c)
+		r.mu.Unlock()
+	}
+	return nil
+}
+
+func (r *registry) isStarted(c *component) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.started {
+		if s == c {
+			return true
+		}
+	}
+	return false
+}
+
+// Stop the started components in reverse order, each within its own timeout or until ctx is cancelled,
+// e.g. by a second SIGINT. Every component gets its turn even if an earlier one failed to stop, the
+// first failure is returned
+func (r *registry) stop(ctx context.Context) error {
+	r.mu.Lock()
+	started := r.started
+	r.started = nil
+	r.mu.Unlock()
+
+	var first error
+	for i := len(started) - 1; i >= 0; i-- {
+		c := started[i]
+		if c.stop == nil {
+			continue
+		}
+		timeout := c.stopTimeout
+		if timeout == 0 {
+			timeout = defaultStopTimeout
+		}
+		stopCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := c.stop(stopCtx)
+		cancel()
+		if err != nil {
+			logger.Errorf(r.log, "Could not stop %s cleanly: %v\n", c.name, err)
+			if first == nil {
+				first = err
+			}
+		} else {
+			logger.Debugf(r.log, "Stopped %s\n", c.name)
+		}
+	}
+	return first
+}
+
+// fail reports that a started component stopped working, e.g. its server stopped accepting
+// connections, and moves the app to Stopping
+func (r *registry) fail(name string, err error) {
+	logger.Errorf(r.log, "%s failed: %v\n", name, err)
+	transitionToStopping(fmt.Sprintf("%s failed: %v", name, err))
+	select {
+	case r.failed <- err:
+	default: // the app is already on its way down
+	}
+}
+
+// failures receives the first error passed to fail
+func (r *registry) failures() <-chan error {
+	return r.failed
+}
+
+// healthy returns the first started component's health check failure, nil when they're all healthy
+func (r *registry) healthy() error {
+	for _, c := range r.health() {
+		if c.Err != nil {
+			return fmt.Errorf("%s: %v", c.Name, c.Err)
+		}
+	}
+	return nil
+}
+
+// health of the started components in the order they started, for the health endpoint
+func (r *registry) health() []handlers.ComponentHealth {
+	r.mu.Lock()
+	started := append([]*component(nil), r.started...)
+	r.mu.Unlock()
+
+	var report []handlers.ComponentHealth
+	for _, c := range started {
+		h := handlers.ComponentHealth{Name: c.name}
+		if c.health != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), healthTimeout)
+			h.Err = c.health(ctx)
+			cancel()
+		}
+		report = append(report, h)
+	}
+	return report
+}
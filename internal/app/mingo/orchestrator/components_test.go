@@ -0,0 +1,170 @@
+package orchestrator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Components that note their starts & stops in calls
+func fakeComponent(calls *[]string, name string, dependsOn ...string) component {
+	return component{
+		name:      name,
+		dependsOn: dependsOn,
+		start: func(ctx context.Context) error {
+			*calls = append(*calls, "start "+name)
+			return nil
+		},
+		stop: func(ctx context.Context) error {
+			*calls = append(*calls, "stop "+name)
+			return nil
+		},
+	}
+}
+
+func TestComponentsStartInDependencyOrderAndStopInReverse(t *testing.T) {
+	var calls []string
+	reg := newRegistry(log.New(&bytes.Buffer{}, "", 0))
+	reg.register(fakeComponent(&calls, "http", "database"))
+	reg.register(fakeComponent(&calls, "redirect"))
+	reg.register(fakeComponent(&calls, "database", "tracer"))
+	reg.register(fakeComponent(&calls, "tracer"))
+
+	if err := reg.start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := "start tracer,start database,start http,start redirect,stop redirect,stop http,stop database,stop tracer"
+	if got := strings.Join(calls, ","); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestComponentStartFailureStopsTheRest(t *testing.T) {
+	teardown := setupLifecycle()
+	defer teardown()
+	if GetLifecycleState() != LifecycleStarting {
+		t.Fatalf("lifecycle got %v, want LifecycleStarting", GetLifecycleState())
+	}
+
+	var calls []string
+	var logged bytes.Buffer
+	reg := newRegistry(log.New(&logged, "", 0))
+	reg.register(fakeComponent(&calls, "database"))
+	broken := fakeComponent(&calls, "http", "database")
+	broken.start = func(ctx context.Context) error { return fmt.Errorf("address already in use") }
+	reg.register(broken)
+	reg.register(fakeComponent(&calls, "worker", "http"))
+
+	if err := reg.start(context.Background()); err == nil || err.Error() != "address already in use" {
+		t.Errorf("start got %v, want the http component's error", err)
+	}
+	if got := strings.Join(calls, ","); got != "start database,stop database" {
+		t.Errorf("got %s, want the database stopped and the worker never started", got)
+	}
+	if GetLifecycleState() != LifecycleFailed {
+		t.Errorf("lifecycle got %v, want LifecycleFailed", GetLifecycleState())
+	}
+	if _, history := GetLifecycleHistory(); len(history) != 2 || history[0].Reason != "could not start http: address already in use" {
+		t.Errorf("lifecycle history got %+v", history)
+	}
+	if !strings.Contains(logged.String(), "Could not start http: address already in use") {
+		t.Errorf("log got %q", logged.String())
+	}
+}
+
+func TestComponentStopTimeout(t *testing.T) {
+	var calls []string
+	reg := newRegistry(log.New(&bytes.Buffer{}, "", 0))
+	reg.register(fakeComponent(&calls, "database"))
+	stuck := fakeComponent(&calls, "http", "database")
+	stuck.stopTimeout = 10 * time.Millisecond
+	stuck.stop = func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	reg.register(stuck)
+	reg.start(context.Background())
+
+	if err := reg.stop(context.Background()); err != context.DeadlineExceeded {
+		t.Errorf("stop got %v, want the stuck component's timeout", err)
+	}
+	if calls[len(calls)-1] != "stop database" {
+		t.Errorf("got %v, want the database stopped regardless", calls)
+	}
+}
+
+func TestComponentStopForced(t *testing.T) {
+	var calls []string
+	reg := newRegistry(log.New(&bytes.Buffer{}, "", 0))
+	reg.register(fakeComponent(&calls, "database"))
+	draining := fakeComponent(&calls, "http", "database")
+	draining.stopTimeout = time.Hour
+	draining.stop = func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	reg.register(draining)
+	reg.start(context.Background())
+
+	ctx, forceNow := context.WithCancel(context.Background())
+	forceNow()
+	if err := reg.stop(ctx); err != context.Canceled {
+		t.Errorf("stop got %v, want the drain cut short", err)
+	}
+	if calls[len(calls)-1] != "stop database" {
+		t.Errorf("got %v, want the database stopped regardless", calls)
+	}
+}
+
+func TestComponentHealthAndFailures(t *testing.T) {
+	teardown := setupLifecycle()
+	defer teardown()
+
+	var calls []string
+	reg := newRegistry(log.New(&bytes.Buffer{}, "", 0))
+	db := fakeComponent(&calls, "database")
+	db.health = func(ctx context.Context) error { return fmt.Errorf("disk I/O error") }
+	reg.register(db)
+	reg.register(fakeComponent(&calls, "http", "database"))
+
+	if got := reg.health(); len(got) != 0 {
+		t.Errorf("health before starting got %+v, want nothing", got)
+	}
+	reg.start(context.Background())
+	got := reg.health()
+	if len(got) != 2 || got[0].Name != "database" || got[0].Err == nil || got[1].Name != "http" || got[1].Err != nil {
+		t.Errorf("health got %+v", got)
+	}
+
+	reg.fail("http", fmt.Errorf("first"))
+	reg.fail("http", fmt.Errorf("second, dropped"))
+	if err := <-reg.failures(); err.Error() != "first" {
+		t.Errorf("failure got %v", err)
+	}
+	if GetLifecycleState() != LifecycleStopping {
+		t.Errorf("lifecycle got %v, want LifecycleStopping", GetLifecycleState())
+	}
+}
+
+func TestComponentDependencyCycle(t *testing.T) {
+	var calls []string
+	reg := newRegistry(log.New(&bytes.Buffer{}, "", 0))
+	reg.register(fakeComponent(&calls, "a", "b"))
+	reg.register(fakeComponent(&calls, "b", "a"))
+	if _, err := reg.ordered(); err == nil || !strings.Contains(err.Error(), "depend on each other") {
+		t.Errorf("got %v, want a cycle error", err)
+	}
+
+	reg = newRegistry(log.New(&bytes.Buffer{}, "", 0))
+	reg.register(fakeComponent(&calls, "http", "database"))
+	if _, err := reg.ordered(); err == nil || !strings.Contains(err.Error(), "unknown component database") {
+		t.Errorf("got %v, want an unknown dependency error", err)
+	}
+}
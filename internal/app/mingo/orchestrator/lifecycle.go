@@ -3,6 +3,9 @@ package orchestrator
 import (
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
 )
 
 // I'm faking an enum with all this messing around, users can't see it's just an int64
@@ -12,35 +15,155 @@ const (
 	LifecycleStarting lifecycle = iota + 1
 	LifecycleRunning
 	LifecycleStopping
+	LifecycleStopped // terminal, shut down cleanly
+	LifecycleFailed  // terminal, a component failed to start, failed while running or didn't stop cleanly
 )
 
-var instance lifecycle // all access must be atomic for thread safety
-var once sync.Once
+var lifecycleNames = map[lifecycle]string{
+	LifecycleStarting: "starting",
+	LifecycleRunning:  "running",
+	LifecycleStopping: "stopping",
+	LifecycleStopped:  "stopped",
+	LifecycleFailed:   "failed",
+}
+
+func (l lifecycle) String() string {
+	if name, ok := lifecycleNames[l]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// The most transitions the app makes in its life: starting, running, stopping then stopped or failed
+const maxTransitions = 3
+
+// The states each state may move to, anything else is rejected
+var allowedTransitions = map[lifecycle][]lifecycle{
+	LifecycleStarting: {LifecycleRunning, LifecycleStopping, LifecycleFailed},
+	LifecycleRunning:  {LifecycleStopping, LifecycleFailed},
+	LifecycleStopping: {LifecycleStopped, LifecycleFailed},
+}
+
+// A change of lifecycle state, when and why it happened
+type LifecycleTransition struct {
+	From   lifecycle
+	To     lifecycle
+	At     time.Time
+	Reason string
+}
+
+var instance = int64(LifecycleStarting) // all access must be atomic for thread safety
+
+// Transitions are serialised so history & subscribers see them in order, reads of the state aren't
+var transitions struct {
+	sync.Mutex
+	clock       system.Clock
+	startedAt   time.Time
+	history     []LifecycleTransition
+	subscribers map[chan LifecycleTransition]struct{}
+}
+
+func init() {
+	transitions.clock = system.NewClock()
+	transitions.startedAt = transitions.clock().UTC()
+	transitions.subscribers = map[chan LifecycleTransition]struct{}{}
+}
 
 // GetLifecycleState is called by any code that needs to get access to the application's lifecycle state
 // This method is threadsafe even though the underlying field is a singleton
 // It returns a defensive copy wrapped in the opaque lifecycle type "enum"
 func GetLifecycleState() lifecycle {
-	once.Do(func() {
-		atomic.StoreInt64((*int64)(&instance), int64(LifecycleStarting))
-	})
-	return lifecycle(atomic.LoadInt64((*int64)(&instance)))
+	return lifecycle(atomic.LoadInt64(&instance))
+}
+
+// GetLifecycleHistory is every transition so far, oldest first, and when the app started
+func GetLifecycleHistory() (time.Time, []LifecycleTransition) {
+	transitions.Lock()
+	defer transitions.Unlock()
+	return transitions.startedAt, append([]LifecycleTransition(nil), transitions.history...)
+}
+
+// SubscribeLifecycle to be sent each transition from now on, call the returned func to stop, which
+// closes the channel. There are only ever a handful of transitions so the channel's buffer holds
+// them all, a slow subscriber can't hold up the app or miss one
+func SubscribeLifecycle() (<-chan LifecycleTransition, func()) {
+	ch := make(chan LifecycleTransition, maxTransitions)
+	transitions.Lock()
+	transitions.subscribers[ch] = struct{}{}
+	transitions.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			transitions.Lock()
+			delete(transitions.subscribers, ch)
+			transitions.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// transition compare-and-swaps the state from any of from to to, it returns false when the state
+// was none of them, e.g. another transition won the race, or when from to to isn't allowed
+func transition(to lifecycle, reason string, from ...lifecycle) bool {
+	transitions.Lock()
+	defer transitions.Unlock()
+	for _, f := range from {
+		if !allowed(f, to) || !atomic.CompareAndSwapInt64(&instance, int64(f), int64(to)) {
+			continue
+		}
+		t := LifecycleTransition{f, to, transitions.clock().UTC(), reason}
+		transitions.history = append(transitions.history, t)
+		for ch := range transitions.subscribers {
+			select {
+			case ch <- t:
+			default:
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func allowed(from, to lifecycle) bool {
+	for _, next := range allowedTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
 }
 
 // attemptTransitionToRunning is called by the app orchestrator to change the application lifecycle state
 // Valid transitions:
-//	* Starting -> Running
+//   - Starting -> Running
+//
 // This method is threadsafe, the app becomes mutli-threaded during bootstrapping once the signal handler is created
 // It returns false when the requested state transition was rejected, otherwise returns true
 func attemptTransitionToRunning() bool {
-	return atomic.CompareAndSwapInt64((*int64)(&instance), int64(LifecycleStarting), int64(LifecycleRunning))
+	return transition(LifecycleRunning, "all components started", LifecycleStarting)
 }
 
 // transitionToStopping is called by the app orchestrator to change the application lifecycle state
 // Valid state transitions:
-//	* From Starting -> Stopping (e.g. CTRL+C while bootstrapping)
-//	* From Running -> Stopping (e.g. CTRL+C while running)
+//   - From Starting -> Stopping (e.g. CTRL+C while bootstrapping)
+//   - From Running -> Stopping (e.g. CTRL+C while running)
+//
+// It's idempotent, once stopping further calls are ignored, and returns false when the transition was rejected
 // This method is threadsafe to allow for clients concurrently calling Get() during Running state
-func transitionToStopping() {
-	atomic.SwapInt64((*int64)(&instance), int64(LifecycleStopping))
+func transitionToStopping(reason string) bool {
+	return transition(LifecycleStopping, reason, LifecycleStarting, LifecycleRunning)
+}
+
+// transitionToStopped is called once every component has stopped cleanly
+// Valid state transitions:
+//   - From Stopping -> Stopped
+func transitionToStopped() bool {
+	return transition(LifecycleStopped, "all components stopped", LifecycleStopping)
+}
+
+// transitionToFailed is called when the app can't carry on or didn't shut down cleanly
+// Valid state transitions:
+//   - From Starting, Running or Stopping -> Failed
+func transitionToFailed(reason string) bool {
+	return transition(LifecycleFailed, reason, LifecycleStarting, LifecycleRunning, LifecycleStopping)
 }
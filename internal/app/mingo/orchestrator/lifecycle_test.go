@@ -1,8 +1,12 @@
 package orchestrator
 
 import (
+	"strings"
 	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
 )
 
 func TestRegularLifecycleTransitions(t *testing.T) {
@@ -27,14 +31,14 @@ func TestRegularLifecycleTransitions(t *testing.T) {
 	}
 
 	// Should transition to Stopping state
-	transitionToStopping()
+	transitionToStopping("test")
 	got = GetLifecycleState()
 	if got != LifecycleStopping {
 		t.Errorf("stopping want %d, got %d", LifecycleStopping, got)
 	}
 
 	// Transition to Stopping state should be idempotent
-	transitionToStopping()
+	transitionToStopping("test")
 	got = GetLifecycleState()
 	if got != LifecycleStopping {
 		t.Errorf("idempotent want %d, got %d", LifecycleStopping, got)
@@ -59,14 +63,14 @@ func TestStartingToStoppingLifecycleTransitions(t *testing.T) {
 	}
 
 	// Should transition to Stopping state
-	transitionToStopping()
+	transitionToStopping("test")
 	got = GetLifecycleState()
 	if got != LifecycleStopping {
 		t.Errorf("stopping want %d, got %d", LifecycleStopping, got)
 	}
 
 	// Transition to Stopping state should be idempotent
-	transitionToStopping()
+	transitionToStopping("test")
 	got = GetLifecycleState()
 	if got != LifecycleStopping {
 		t.Errorf("idempotent want %d, got %d", LifecycleStopping, got)
@@ -79,10 +83,93 @@ func TestStartingToStoppingLifecycleTransitions(t *testing.T) {
 	}
 }
 
+// Every pair of states, whether the transition between them is allowed
+func TestEveryTransition(t *testing.T) {
+	moves := map[lifecycle]func() bool{
+		LifecycleRunning:  attemptTransitionToRunning,
+		LifecycleStopping: func() bool { return transitionToStopping("test") },
+		LifecycleStopped:  transitionToStopped,
+		LifecycleFailed:   func() bool { return transitionToFailed("test") },
+	}
+	allowed := map[[2]lifecycle]bool{
+		{LifecycleStarting, LifecycleRunning}:  true,
+		{LifecycleStarting, LifecycleStopping}: true,
+		{LifecycleStarting, LifecycleFailed}:   true,
+		{LifecycleRunning, LifecycleStopping}:  true,
+		{LifecycleRunning, LifecycleFailed}:    true,
+		{LifecycleStopping, LifecycleStopped}:  true,
+		{LifecycleStopping, LifecycleFailed}:   true,
+	}
+	for _, from := range []lifecycle{LifecycleStarting, LifecycleRunning, LifecycleStopping, LifecycleStopped, LifecycleFailed} {
+		for to, move := range moves {
+			teardown := setupLifecycle()
+			atomic.StoreInt64(&instance, int64(from))
+
+			want := allowed[[2]lifecycle{from, to}]
+			if got := move(); got != want {
+				t.Errorf("%s -> %s got %t, want %t", from, to, got, want)
+			}
+			if want && GetLifecycleState() != to || !want && GetLifecycleState() != from {
+				t.Errorf("%s -> %s left the state %s", from, to, GetLifecycleState())
+			}
+			teardown()
+		}
+	}
+}
+
+// Subscribers' buffers hold every transition only while maxTransitions is the longest path through the states
+func TestMaxTransitionsIsTheLongestPath(t *testing.T) {
+	var longest func(from lifecycle) int
+	longest = func(from lifecycle) int {
+		most := 0
+		for _, to := range allowedTransitions[from] {
+			if n := 1 + longest(to); n > most {
+				most = n
+			}
+		}
+		return most
+	}
+	if got := longest(LifecycleStarting); got != maxTransitions {
+		t.Errorf("longest path got %d transitions, want maxTransitions %d", got, maxTransitions)
+	}
+}
+
+func TestLifecycleSubscribersAndHistory(t *testing.T) {
+	teardown := setupLifecycle()
+	defer teardown()
+	transitions.clock = system.ClockForTesting("2022-04-30T23:59:59Z")
+
+	ch, stop := SubscribeLifecycle()
+	attemptTransitionToRunning()
+	transitionToStopping("received interrupt")
+	transitionToStopping("ignored, already stopping")
+	transitionToStopped()
+	stop()
+	stop() // harmless twice
+
+	var got []string
+	for tr := range ch {
+		got = append(got, tr.From.String()+" -> "+tr.To.String()+": "+tr.Reason)
+	}
+	want := []string{"starting -> running: all components started", "running -> stopping: received interrupt", "stopping -> stopped: all components stopped"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("subscriber got %q, want %q", got, want)
+	}
+
+	_, history := GetLifecycleHistory()
+	if len(history) != 3 || history[1].Reason != "received interrupt" || history[1].At.Format(time.RFC3339) != "2022-04-30T23:59:59Z" {
+		t.Errorf("history got %+v", history)
+	}
+}
+
 func setupLifecycle() func() {
 	// noop to catch flaky tests that don't cleanup after themselves
 
 	return func() {
-		atomic.StoreInt64((*int64)(&instance), int64(LifecycleStarting))
+		atomic.StoreInt64(&instance, int64(LifecycleStarting))
+		transitions.Lock()
+		transitions.history = nil
+		transitions.clock = system.NewClock()
+		transitions.Unlock()
 	}
 }
@@ -3,80 +3,316 @@ package orchestrator
 import (
 	"context"
 	"io"
+	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/craigjperry2/mingo/internal/app/mingo/admin"
+	"github.com/craigjperry2/mingo/internal/app/mingo/certs"
 	"github.com/craigjperry2/mingo/internal/app/mingo/config"
 	"github.com/craigjperry2/mingo/internal/app/mingo/errors"
 	"github.com/craigjperry2/mingo/internal/app/mingo/httpserver"
+	"github.com/craigjperry2/mingo/internal/app/mingo/httpserver/handlers"
 	"github.com/craigjperry2/mingo/internal/app/mingo/logger"
 )
 
-func Orchestrate(args []string, stderr io.Writer) error {
-	ctx, server, err := bootstrap(args, stderr)
+func Orchestrate(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	if err := config.Build(args, stderr); err != nil {
+		return err
+	}
+	c := config.GetInstance()
+	logger.Setup(c.GetLoggingDestination(), c.GetClock(), c.GetHostname())
+	for _, f := range c.GetLogFiles() {
+		defer f.Close() // last, so the shutdown is logged
+	}
+	if sink := c.GetLogSink(); sink != nil {
+		defer sink.Close()
+	}
+
+	serviceLogger := logger.NewComponentLogger(c.GetClock(), c.GetLoggingDestination(), c.GetHostname(), "service")
+	stopLoggingTransitions := logTransitions(serviceLogger)
+	defer stopLoggingTransitions()
+	reg := newRegistry(serviceLogger)
+	registerStorage(reg)
+
+	if command := c.GetCommand(); len(command) > 0 {
+		if err := reg.start(context.Background()); err != nil {
+			return err
+		}
+		defer reg.stop(context.Background())
+		return admin.Run(command, stdin, stdout, stderr)
+	}
+
+	notifier := newNotifier(serviceLogger) // nil unless running under systemd
+	defer notifier.Close()
+	stopNotifying := notifier.reportLifecycle()
+	defer stopNotifying()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel() // the signal handlers & watchdog stop with the app
+	stop, force, err := bootstrap(ctx, reg, notifier)
 	if err != nil {
 		return err
 	}
-	attemptTransitionToRunning() // transition STARTING -> RUNNING
-	return run(ctx, server)
+	err = run(stop, force, reg)
+	stopLoggingTransitions() // so they're logged before the shutdown
+	stopNotifying()
+	if err == nil {
+		serviceLogger.Printf("Server has shutdown\n")
+	}
+	return err
 }
 
-// Bootstrap the app, triggers the following side-effects:
-//	* Signal handler setup for SIGINT & SIGTERM to cause a graceful app shutdown
-//	* App config will be initialised and made accessible as an immutable singleton via the config pkg
-//	* Logging will be enabled
-func bootstrap(args []string, stderr io.Writer) (context.Context, *http.Server, error) {
-	err := config.Build(args, stderr)
-
+// The tracer & database, which commands need as well as the server
+func registerStorage(reg *registry) {
 	c := config.GetInstance()
-	logger.Setup(c.GetLoggingDestination(), c.GetClock(), c.GetHostname())
+	reg.register(component{
+		name: "tracer",
+		stop: func(ctx context.Context) error { return c.GetTracer().Close(ctx) }, // export the last spans
+	})
+	reg.register(component{
+		name:      "database",
+		dependsOn: []string{"tracer"},
+		start: func(ctx context.Context) error {
+			if err := c.GetDatabase().Migrate(); err != nil {
+				logger.Errorf(reg.log, "Could not open or migrate database %s: %v\n", c.GetDatabasePath(), err)
+				return errors.ErrDatabaseUnavailable
+			}
+			return nil
+		},
+		stop:   func(ctx context.Context) error { return c.GetDatabase().Close() },
+		health: func(ctx context.Context) error { return c.GetDatabase().PingContext(ctx) },
+	})
+}
+
+// Bootstrap the server, triggers the following side-effects:
+//   - Signal handler setup for SIGINT & SIGTERM to cause a graceful app shutdown, a second one cuts the drain short
+//   - Signal handler setup for SIGHUP to reload the TLS certificate when serving HTTPS
+//   - Signal handler setup for SIGUSR1 to reopen log files, e.g. after an external logrotate
+//   - Signal handler setup for SIGUSR2 to hand the listeners over to a new process then drain & exit
+//   - Pinging systemd's watchdog while the components are healthy, when it's enabled
+//
+// By now app config has been initialised and made accessible as an immutable singleton via the config pkg
+// and logging is enabled. The HTTP servers join the registry's components, nothing is started yet, they
+// listen on the sockets systemd or the previous process handed over when there are any
+// It returns a context cancelled when the app is told to stop and another when it's told to stop now
+func bootstrap(ctx context.Context, reg *registry, notifier *notifier) (context.Context, context.Context, error) {
+	main := httpserver.MakeHttpServer(func() handlers.HealthReport { return healthReport(reg) })
+	keypair, err := httpserver.ConfigureTls(main)
+	if err != nil {
+		return nil, nil, err
+	}
+	h := newHandoff(reg.log)
+	h.notifier = notifier
+	reg.register(serverComponent(reg, h, "http", main, "database"))
+	if redirect := httpserver.MakeRedirectServer(); redirect != nil {
+		reg.register(serverComponent(reg, h, "redirect", redirect))
+	}
+	if h.parent != nil {
+		h.reportToParent()
+		notifier.takingOver(os.Getppid())
+	}
 
-	server := httpserver.MakeHttpServer()
-	ctx := setupSignalHandler(context.Background(), server)
+	stop, force := setupSignalHandler(ctx)
+	if len(upgradeSignals) > 0 {
+		stop = setupUpgradeHandler(ctx, stop, h)
+	}
+	if interval, ok := watchdogInterval(); ok && notifier != nil {
+		go notifier.watchdog(ctx, interval, reg.healthy)
+	}
+	// Until the app exits rather than until it's asked to stop, a logrotate or renewal during the drain
+	// would otherwise get the signal's default treatment and kill the process
+	if keypair != nil {
+		setupReloadHandler(ctx, keypair)
+	}
+	if files := config.GetInstance().GetLogFiles(); len(files) > 0 && len(reopenSignals) > 0 {
+		setupReopenHandler(ctx, files)
+	}
+	return stop, force, nil
+}
 
-	return ctx, server, err
+// An HTTP server as a component, it's started once it's listening and stops once its in-flight requests
+// finish, within --drain-timeout, after which the connections still open are closed
+func serverComponent(reg *registry, h *handoff, name string, server *http.Server, dependsOn ...string) component {
+	return component{
+		name:        name,
+		dependsOn:   dependsOn,
+		stopTimeout: config.GetInstance().GetDrainTimeout(),
+		start: func(ctx context.Context) error {
+			listener, err := h.listen(name, server.Addr)
+			if err != nil {
+				logger.Errorf(server.ErrorLog, "Could not listen on %s: %v\n", server.Addr, err)
+				return errors.ErrPortUnavailable
+			}
+			go func() {
+				var err error
+				if server.TLSConfig != nil {
+					err = server.ServeTLS(listener, "", "") // certificate comes from TLSConfig.GetCertificate
+				} else {
+					err = server.Serve(listener)
+				}
+				if err != http.ErrServerClosed {
+					reg.fail(name, errors.ErrPortUnavailable)
+				}
+			}()
+			return nil
+		},
+		stop: func(ctx context.Context) error {
+			server.SetKeepAlivesEnabled(false)
+			if err := server.Shutdown(ctx); err != nil {
+				server.Close() // out of time, drop the requests still going
+				return err
+			}
+			return nil
+		},
+	}
 }
 
-// Invoke the HTTP server main loop then await graceful shutdown
-func run(ctx context.Context, server *http.Server) error {
+// Start the components then run until a signal or a component's failure asks to stop. Once asked the
+// app carries on serving for --shutdown-delay, while /ready reports 503, then drains & stops. Cancelling
+// force cuts both short, ErrShutdownFailed is returned when the components didn't all stop cleanly
+func run(ctx context.Context, force context.Context, reg *registry) error {
 
 	// TODO: Try listening on the port then open the browser to the location unless --no-browser, if already bound, just open browser
 
 	serviceLogger := logger.NewComponentLogger(config.GetInstance().GetClock(), config.GetInstance().GetLoggingDestination(), config.GetInstance().GetHostname(), "service")
-	serviceLogger.Println(config.GetInstance().GetProgname(), "is starting as user", config.GetInstance().GetUsername(), "on host", config.GetInstance().GetHostname(), "port", config.GetInstance().GetListenPortStr())
+	scheme := "http"
+	if config.GetInstance().IsTlsEnabled() {
+		scheme = "https"
+	}
+	serviceLogger.Println(config.GetInstance().GetProgname(), "is starting as user", config.GetInstance().GetUsername(), "on host", config.GetInstance().GetHostname(), "port", config.GetInstance().GetListenPortStr(), "serving", scheme)
 
-	if err := server.ListenAndServe(); err != http.ErrServerClosed {
-		serviceLogger.Printf("Could not listen on port %d: %v\n", config.GetInstance().GetListenPort(), err)
-		return errors.ErrPortUnavailable
+	if err := reg.start(ctx); err != nil {
+		return err
+	}
+	attemptTransitionToRunning() // transition STARTING -> RUNNING
+
+	var err error
+	select {
+	case <-ctx.Done(): // signalled, already STOPPING
+	case err = <-reg.failures(): // already STOPPING
+	}
+	transitionToStopping("shutting down") // in case it wasn't, e.g. the signal arrived while starting
+	if delay := config.GetInstance().GetShutdownDelay(); delay > 0 && err == nil {
+		serviceLogger.Printf("Serving for another %s while /ready reports not ready\n", delay)
+		select {
+		case <-time.After(delay):
+		case <-force.Done():
+		}
+	}
+	stopErr := reg.stop(force)
+	switch {
+	case err != nil:
+		transitionToFailed("stopped after a component failed") // transition STOPPING -> FAILED
+	case stopErr != nil:
+		transitionToFailed("a component didn't stop cleanly: " + stopErr.Error())
+		err = errors.ErrShutdownFailed
+	default:
+		transitionToStopped() // transition STOPPING -> STOPPED
 	}
-	<-ctx.Done()
-	serviceLogger.Printf("Server has shutdown\n")
-	return nil
+	return err
 }
 
-func setupSignalHandler(ctx context.Context, server *http.Server) context.Context {
-	ctx, done := context.WithCancel(ctx)
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+// Log each lifecycle transition, call the returned func to log any still on their way and stop
+func logTransitions(l *log.Logger) func() {
+	ch, stop := SubscribeLifecycle()
+	done := make(chan struct{})
 	go func() {
-		defer done()
+		defer close(done)
+		for t := range ch {
+			l.Printf("Lifecycle %s -> %s: %s\n", t.From, t.To, t.Reason)
+		}
+	}()
+	return func() {
+		stop()
+		<-done
+	}
+}
+
+// The lifecycle's transitions & the components' health for /health
+func healthReport(reg *registry) handlers.HealthReport {
+	startedAt, history := GetLifecycleHistory()
+	report := handlers.HealthReport{
+		Lifecycle:  []handlers.LifecycleEvent{{State: LifecycleStarting.String(), At: startedAt}},
+		Components: reg.health(),
+	}
+	for _, t := range history {
+		report.Lifecycle = append(report.Lifecycle, handlers.LifecycleEvent{State: t.To.String(), At: t.At, Reason: t.Reason})
+	}
+	return report
+}
 
-		<-quit
-		signal.Stop(quit)
-		close(quit)
+// Cancel the first returned context on SIGINT or SIGTERM so run stops the app gracefully, and the second
+// on another so it stops without waiting for the drain. Both are cancelled when ctx is
+func setupSignalHandler(ctx context.Context) (context.Context, context.Context) {
+	stop, stopNow := context.WithCancel(ctx)
+	force, forceNow := context.WithCancel(ctx)
+	quit := make(chan os.Signal, 2)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		defer forceNow()
+		defer stopNow()
+		defer signal.Stop(quit) // a third signal gets the default treatment
 
-		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-		defer cancel()
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-quit:
+			transitionToStopping("received " + sig.String()) // transition (STARTING|RUNNING) -> STOPPING
+			stopNow()
+		}
+		select {
+		case <-ctx.Done():
+		case sig := <-quit:
+			logger.Warnf(log.Default(), "Received %s again, stopping without waiting for requests to finish\n", sig)
+			forceNow()
+		}
+	}()
+	return stop, force
+}
 
-		server.SetKeepAlivesEnabled(false)
-		if err := server.Shutdown(ctx); err != nil {
-			server.ErrorLog.Printf("Could not gracefully shutdown the server: %s\n", err)
+// Reload the TLS certificate on SIGHUP, e.g. after a renewal, without restarting
+func setupReloadHandler(ctx context.Context, keypair *certs.Keypair) {
+	serviceLogger := logger.NewComponentLogger(config.GetInstance().GetClock(), config.GetInstance().GetLoggingDestination(), config.GetInstance().GetHostname(), "service")
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				if err := keypair.Reload(); err != nil {
+					logger.Errorf(serviceLogger, "Could not reload TLS certificate, keeping the previous one: %v\n", err)
+				} else {
+					serviceLogger.Println("Reloaded TLS certificate")
+				}
+			}
 		}
+	}()
+}
 
-		transitionToStopping() // transition (STARTING|RUNNING) -> STOPPING
+// Reopen log files by name on SIGUSR1, an external logrotate moves them aside then signals
+func setupReopenHandler(ctx context.Context, files []*logger.RotatingFile) {
+	reopen := make(chan os.Signal, 1)
+	signal.Notify(reopen, reopenSignals...)
+	go func() {
+		defer signal.Stop(reopen)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-reopen:
+				for _, f := range files {
+					if err := f.Reopen(); err != nil {
+						logger.Errorf(log.Default(), "Could not reopen log file: %v\n", err)
+					}
+				}
+				log.Println("Reopened log files")
+			}
+		}
 	}()
-	return ctx
 }
@@ -1,26 +1,144 @@
 package orchestrator
 
 import (
+	"context"
 	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
 )
 
 func TestSignalHandlerMovesLifecycleToStopping(t *testing.T) {
+	teardown := setupLifecycle()
+	defer teardown()
+
 	l := GetLifecycleState()
 	if l != LifecycleStarting {
 		t.Errorf("start want LifecycleStarting, got %v", l)
 	}
+	ch, stop := SubscribeLifecycle()
+	defer stop()
 
-	go Orchestrate([]string{}, ioutil.Discard)
+	go Orchestrate([]string{"--db", ":memory:"}, nil, ioutil.Discard, ioutil.Discard)
 	time.Sleep(100 * time.Millisecond) // await setup
 
 	syscall.Kill(syscall.Getpid(), syscall.SIGINT)
-	time.Sleep(100 * time.Millisecond) // await delivery
 
-	l = GetLifecycleState()
-	if l != LifecycleStopping {
-		t.Errorf("stop want LifecycleStopping, got %v", l)
+	want := []LifecycleTransition{
+		{From: LifecycleStarting, To: LifecycleRunning, Reason: "all components started"},
+		{From: LifecycleRunning, To: LifecycleStopping, Reason: "received interrupt"},
+		{From: LifecycleStopping, To: LifecycleStopped, Reason: "all components stopped"},
+	}
+	for _, w := range want {
+		select {
+		case got := <-ch:
+			if got.From != w.From || got.To != w.To || got.Reason != w.Reason || got.At.IsZero() {
+				t.Errorf("transition got %+v, want %+v", got, w)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("want %s -> %s, got nothing", w.From, w.To)
+		}
+	}
+	if l = GetLifecycleState(); l != LifecycleStopped {
+		t.Errorf("stop want LifecycleStopped, got %v", l)
+	}
+}
+
+func TestSecondSignalForcesStop(t *testing.T) {
+	teardown := setupLifecycle()
+	defer teardown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop, force := setupSignalHandler(ctx)
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+	select {
+	case <-stop.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("first signal didn't stop the app")
+	}
+	if force.Err() != nil {
+		t.Error("first signal forced the stop, want a graceful one")
+	}
+	if l := GetLifecycleState(); l != LifecycleStopping {
+		t.Errorf("lifecycle got %v, want LifecycleStopping", l)
+	}
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+	select {
+	case <-force.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("second signal didn't force the stop")
+	}
+}
+
+// Runs the whole app in a process of its own, for signals that would kill the test binary were they mishandled
+func TestOrchestrateHelperProcess(t *testing.T) {
+	args := os.Getenv("MINGO_ORCHESTRATE_ARGS")
+	if args == "" {
+		return
+	}
+	if err := Orchestrate(strings.Split(args, "\n"), nil, ioutil.Discard, ioutil.Discard); err != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func TestSignalsWhileStopping(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close() // a free port for the app
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mingo.log")
+	cmd := exec.Command(os.Args[0], "-test.run=^TestOrchestrateHelperProcess$")
+	cmd.Env = append(os.Environ(), "MINGO_ORCHESTRATE_ARGS="+strings.Join([]string{"--db", ":memory:", "--port", port(l), "--log-file", path, "--tls-self-signed", "--tls-dir", dir, "--shutdown-delay", "1s"}, "\n"))
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	awaitLog := func(want string) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+			if b, _ := os.ReadFile(path); strings.Contains(string(b), want) {
+				return
+			}
+			if time.Now().After(deadline) {
+				cmd.Process.Kill()
+				t.Fatalf("log never said %q", want)
+			}
+		}
+	}
+
+	awaitLog("-> running")
+	cmd.Process.Signal(syscall.SIGTERM)
+	awaitLog("Serving for another 1s")
+	// The app's still serving, a logrotate or certificate renewal now is handled as usual rather than
+	// ignoring SIGUSR1 and dying of SIGHUP
+	os.Rename(path, path+".1")
+	cmd.Process.Signal(syscall.SIGUSR1)
+	awaitLog("Reopened log files")
+	cmd.Process.Signal(syscall.SIGHUP)
+	awaitLog("Reloaded TLS certificate")
+
+	select {
+	case err := <-exited:
+		if err != nil {
+			t.Fatalf("app exited with %v, want it to survive SIGHUP while stopping", err)
+		}
+	case <-time.After(10 * time.Second):
+		cmd.Process.Kill()
+		t.Fatal("app didn't stop")
+	}
+	if b, _ := os.ReadFile(path); !strings.Contains(string(b), "Server has shutdown") {
+		t.Errorf("reopened log got %q, want the rest of the shutdown", b)
 	}
 }
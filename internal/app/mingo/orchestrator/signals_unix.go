@@ -0,0 +1,14 @@
+//go:build !windows
+
+package orchestrator
+
+import (
+	"os"
+	"syscall"
+)
+
+// Ask for log files to be reopened, e.g. by logrotate's postrotate script
+var reopenSignals = []os.Signal{syscall.SIGUSR1}
+
+// Ask for the binary to be replaced without dropping connections, e.g. after installing a new version
+var upgradeSignals = []os.Signal{syscall.SIGUSR2}
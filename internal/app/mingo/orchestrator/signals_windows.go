@@ -0,0 +1,9 @@
+package orchestrator
+
+import "os"
+
+// Windows has no SIGUSR1, rotation by size or day still works
+var reopenSignals []os.Signal
+
+// Nor SIGUSR2, nor can a listening socket be passed to a child process, upgrades mean a restart
+var upgradeSignals []os.Signal
@@ -0,0 +1,218 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/logger"
+)
+
+// Being a good citizen under systemd without its libraries, see sd_listen_fds(3) and sd_notify(3). Outside
+// systemd none of its environment variables are set and none of this does anything
+
+// The first descriptor systemd passes a socket activated service
+const listenFdsStart = 3
+
+// systemdListeners are the sockets systemd opened for this process's socket unit. They're taken once,
+// whatever this process starts in turn doesn't see them
+func systemdListeners(log *log.Logger) []net.Listener {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	var listeners []net.Listener
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("fd %d", listenFdsStart+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(listenFdsStart+i), name)
+		l, err := net.FileListener(f) // a copy of the descriptor
+		f.Close()
+		if err != nil {
+			logger.Errorf(log, "Could not listen on systemd's socket %s: %v\n", name, err)
+			continue
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners
+}
+
+// Tells systemd how the app is doing over $NOTIFY_SOCKET, for a Type=notify service. A nil notifier
+// does nothing, so callers needn't check whether the app's running under systemd
+type notifier struct {
+	log  *log.Logger
+	conn net.Conn
+
+	mu         sync.Mutex
+	handedOver bool // another process is the service's main process now
+	previous   int  // the process this one is taking over from, the main one again should this one not start
+}
+
+// newNotifier connects to $NOTIFY_SOCKET, it returns nil when there isn't one
+func newNotifier(log *log.Logger) *notifier {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return nil
+	}
+	conn, err := net.Dial("unixgram", path) // a leading @ is the abstract namespace
+	if err != nil {
+		logger.Errorf(log, "Could not connect to systemd's notify socket %s: %v\n", path, err)
+		return nil
+	}
+	return &notifier{log: log, conn: conn}
+}
+
+// notify sends systemd newline separated assignments, e.g. "READY=1\nSTATUS=running"
+func (n *notifier) notify(state string) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.handedOver {
+		return
+	}
+	if _, err := n.conn.Write([]byte(state)); err != nil {
+		logger.Warnf(n.log, "Could not notify systemd: %v\n", err)
+	}
+}
+
+// handOver tells systemd pid is the main process now and stops notifying, the STOPPING=1 of this
+// process draining would otherwise take the new one down with it, and its watchdog pings keep it alive
+// It's sent before the new process reports in, with NotifyAccess=main systemd only hears the main process
+func (n *notifier) handOver(pid int) {
+	n.notify(fmt.Sprintf("MAINPID=%d", pid))
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.handedOver = true
+}
+
+// takeBack tells systemd this is the main process again, after the new one didn't start. When that
+// one died or hung rather than giving up, systemd only hears this with NotifyAccess=all
+func (n *notifier) takeBack() {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	n.handedOver = false
+	n.mu.Unlock()
+	n.notify(fmt.Sprintf("MAINPID=%d", os.Getpid()))
+}
+
+// takingOver from pid, the previous process, which this one hands the main pid back to if it stops
+// before it's running
+func (n *notifier) takingOver(pid int) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.previous = pid
+}
+
+func (n *notifier) Close() error {
+	if n == nil {
+		return nil
+	}
+	return n.conn.Close()
+}
+
+// Tell systemd about each lifecycle transition, call the returned func to send any still on their way and stop
+func (n *notifier) reportLifecycle() func() {
+	if n == nil {
+		return func() {}
+	}
+	ch, stop := SubscribeLifecycle()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for t := range ch {
+			n.mu.Lock()
+			previous := n.previous
+			n.mu.Unlock()
+			if previous != 0 && t.From == LifecycleStarting && t.To != LifecycleRunning {
+				n.handOver(previous) // rather than STOPPING=1, the previous process carries on
+				continue
+			}
+			n.notify(lifecycleNotification(t))
+		}
+	}()
+	return func() {
+		stop()
+		<-done
+	}
+}
+
+func lifecycleNotification(t LifecycleTransition) string {
+	status := "STATUS=" + t.To.String() + ", " + strings.ReplaceAll(t.Reason, "\n", " ")
+	switch t.To {
+	case LifecycleRunning:
+		return "READY=1\n" + status
+	case LifecycleStopping:
+		return "STOPPING=1\n" + status
+	}
+	return status
+}
+
+// watchdogInterval is how often systemd wants to hear WATCHDOG=1, half its WatchdogSec= as
+// sd_watchdog_enabled(3) advises. It's false when the watchdog's off or meant for another process
+func watchdogInterval() (time.Duration, bool) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, false
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, false
+	}
+	return time.Duration(usec) * time.Microsecond / 2, true
+}
+
+// Ping systemd's watchdog every interval while healthy returns nil, until ctx is done. Once the pings
+// stop for WatchdogSec= systemd restarts the app
+func (n *notifier) watchdog(ctx context.Context, interval time.Duration, healthy func() error) {
+	if n == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var unhealthy error
+	for {
+		err := healthy()
+		switch {
+		case err == nil:
+			if unhealthy != nil {
+				n.log.Println("Healthy again, pinging systemd's watchdog")
+			}
+			n.notify("WATCHDOG=1")
+		case unhealthy == nil:
+			logger.Warnf(n.log, "Not pinging systemd's watchdog while unhealthy: %v\n", err)
+		}
+		unhealthy = err
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package orchestrator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A fake of systemd's end of $NOTIFY_SOCKET
+func fakeNotifySocket(t *testing.T) *net.UnixConn {
+	path := filepath.Join(t.TempDir(), "notify")
+	sock, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sock.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	return sock
+}
+
+// The next notification, or "" when there isn't one within timeout
+func received(sock *net.UnixConn, timeout time.Duration) string {
+	buf := make([]byte, 4096)
+	sock.SetReadDeadline(time.Now().Add(timeout))
+	n, err := sock.Read(buf)
+	if err != nil {
+		return ""
+	}
+	return string(buf[:n])
+}
+
+func TestNotifierReportsLifecycle(t *testing.T) {
+	teardown := setupLifecycle()
+	defer teardown()
+	sock := fakeNotifySocket(t)
+
+	n := newNotifier(log.New(io.Discard, "", 0))
+	if n == nil {
+		t.Fatal("no notifier with $NOTIFY_SOCKET set")
+	}
+	defer n.Close()
+	stop := n.reportLifecycle()
+	attemptTransitionToRunning()
+	transitionToStopping("received terminated")
+	transitionToStopped()
+	stop()
+
+	for _, want := range []string{
+		"READY=1\nSTATUS=running, all components started",
+		"STOPPING=1\nSTATUS=stopping, received terminated",
+		"STATUS=stopped, all components stopped",
+	} {
+		if got := received(sock, time.Second); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestNotifierQuietAfterHandingOver(t *testing.T) {
+	teardown := setupLifecycle()
+	defer teardown()
+	sock := fakeNotifySocket(t)
+
+	n := newNotifier(log.New(io.Discard, "", 0))
+	defer n.Close()
+	stop := n.reportLifecycle()
+	attemptTransitionToRunning()
+	if got := received(sock, time.Second); got != "READY=1\nSTATUS=running, all components started" {
+		t.Errorf("got %q, want READY=1", got)
+	}
+	n.handOver(4242)
+	transitionToStopping("handed over to pid 4242")
+	transitionToStopped()
+	stop()
+	n.notify("WATCHDOG=1")
+
+	if got := received(sock, time.Second); got != "MAINPID=4242" {
+		t.Errorf("got %q, want MAINPID=4242", got)
+	}
+	if got := received(sock, 100*time.Millisecond); got != "" {
+		t.Errorf("got %q after handing over, want nothing, STOPPING=1 would stop the new main process", got)
+	}
+}
+
+// A new process that stops before it's running gives the main pid back rather than stopping the service
+func TestNotifierGivesBackAFailedTakeOver(t *testing.T) {
+	teardown := setupLifecycle()
+	defer teardown()
+	sock := fakeNotifySocket(t)
+
+	n := newNotifier(log.New(io.Discard, "", 0))
+	defer n.Close()
+	n.takingOver(4242)
+	stop := n.reportLifecycle()
+	transitionToStopping("could not start http")
+	transitionToFailed("http did not stop cleanly")
+	stop()
+
+	if got := received(sock, time.Second); got != "MAINPID=4242" {
+		t.Errorf("got %q, want MAINPID=4242", got)
+	}
+	if got := received(sock, 100*time.Millisecond); got != "" {
+		t.Errorf("got %q after giving back, want nothing, STOPPING=1 would stop the previous process", got)
+	}
+
+	n.takeBack()
+	if got, want := received(sock, time.Second), fmt.Sprintf("MAINPID=%d", os.Getpid()); got != want {
+		t.Errorf("taking back got %q, want %q", got, want)
+	}
+	n.notify("WATCHDOG=1")
+	if got := received(sock, time.Second); got != "WATCHDOG=1" {
+		t.Errorf("got %q, want notifications again once taken back", got)
+	}
+}
+
+func TestNotifierOutsideSystemd(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	n := newNotifier(log.New(io.Discard, "", 0))
+	if n != nil {
+		t.Fatal("got a notifier without $NOTIFY_SOCKET")
+	}
+	n.notify("READY=1") // does nothing rather than panic
+	n.handOver(4242)
+	n.reportLifecycle()()
+	n.Close()
+}
+
+func TestWatchdogPingsWhileHealthy(t *testing.T) {
+	sock := fakeNotifySocket(t)
+	t.Setenv("WATCHDOG_USEC", "20000")
+	interval, ok := watchdogInterval()
+	if !ok || interval != 10*time.Millisecond {
+		t.Fatalf("interval got %v %v, want half of WATCHDOG_USEC", interval, ok)
+	}
+
+	var logged bytes.Buffer
+	n := newNotifier(log.New(&logged, "", 0))
+	defer n.Close()
+	var mu sync.Mutex
+	var health error
+	setHealth := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		health = err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		n.watchdog(ctx, interval, func() error {
+			mu.Lock()
+			defer mu.Unlock()
+			return health
+		})
+	}()
+
+	if got := received(sock, time.Second); got != "WATCHDOG=1" {
+		t.Errorf("healthy got %q, want a ping", got)
+	}
+	setHealth(fmt.Errorf("database: disk I/O error"))
+	time.Sleep(3 * interval)
+	for received(sock, time.Millisecond) != "" { // pings sent before it was unhealthy
+	}
+	if got := received(sock, 5*interval); got != "" {
+		t.Errorf("unhealthy got %q, want no pings", got)
+	}
+	setHealth(nil)
+	if got := received(sock, time.Second); got != "WATCHDOG=1" {
+		t.Errorf("healthy again got %q, want a ping", got)
+	}
+	cancel()
+	<-done
+	if n := strings.Count(logged.String(), "Not pinging systemd's watchdog while unhealthy: database: disk I/O error"); n != 1 {
+		t.Errorf("log got %q, want one warning", logged.String())
+	}
+}
+
+func TestWatchdogForAnotherProcess(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "20000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()+1))
+	if _, ok := watchdogInterval(); ok {
+		t.Error("got a watchdog meant for another process")
+	}
+	t.Setenv("WATCHDOG_USEC", "")
+	t.Setenv("WATCHDOG_PID", "")
+	if _, ok := watchdogInterval(); ok {
+		t.Error("got a watchdog without WATCHDOG_USEC")
+	}
+}
+
+func TestSystemdSocketActivation(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close() // as systemd, the socket stays open in f
+
+	cmd := helperCommand("systemd", addr)()
+	cmd.Env = append(cmd.Env, "LISTEN_FDS=1", "LISTEN_FDNAMES=mingo.socket")
+	cmd.ExtraFiles = []*os.File{f}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer cmd.Wait()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	reply, _ := io.ReadAll(conn)
+	if want := fmt.Sprintf("pid %d\n", cmd.Process.Pid); string(reply) != want {
+		t.Errorf("got %q, want %q", reply, want)
+	}
+}
@@ -0,0 +1,263 @@
+package orchestrator
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/logger"
+)
+
+// Names the listeners handed to a new process on SIGUSR2, in the order of their file descriptors from 4.
+// Descriptor 3 is a pipe the new process writes "ready" to once it's running
+const listenersEnv = "MINGO_LISTENERS"
+
+const upgradeTimeout = time.Minute
+
+// The servers' listening sockets, so they can be handed over to a new process on SIGUSR2 without
+// refusing a single connection. The new process starts with them, the old one drains and exits
+type handoff struct {
+	log       *log.Logger
+	mu        sync.Mutex
+	inherited []net.Listener // handed over by the previous process or opened by systemd, until a server takes one
+	listening map[string]net.Listener
+	names     []string         // of listening, in the order the servers started
+	parent    *os.File         // to tell the previous process we're running, nil unless it started us
+	command   func() *exec.Cmd // starts the new process, the running binary with the same arguments
+	timeout   time.Duration    // for the new process to be running
+	notifier  *notifier        // tells systemd the new process is the main one, nil outside systemd
+}
+
+// newHandoff takes over any listeners the previous process handed over, or systemd opened
+func newHandoff(log *log.Logger) *handoff {
+	h := &handoff{
+		log:       log,
+		inherited: systemdListeners(log),
+		listening: map[string]net.Listener{},
+		command:   sameCommand,
+		timeout:   upgradeTimeout,
+	}
+	names := os.Getenv(listenersEnv)
+	if names == "" {
+		return h
+	}
+	os.Unsetenv(listenersEnv) // not for whatever we start in turn
+	h.parent = os.NewFile(3, "upgrade")
+	for i, name := range strings.Split(names, ",") {
+		f := os.NewFile(uintptr(4+i), name)
+		l, err := net.FileListener(f) // a copy of the descriptor
+		f.Close()
+		if err != nil {
+			logger.Errorf(log, "Could not take over the %s listener: %v\n", name, err)
+			continue
+		}
+		h.inherited = append(h.inherited, l)
+	}
+	return h
+}
+
+func sameCommand() *exec.Cmd {
+	exe, err := os.Executable()
+	if err != nil {
+		exe = os.Args[0]
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd
+}
+
+// listen for the named server on addr, using an inherited listener when there's one on the same port
+func (h *handoff) listen(name, addr string) (net.Listener, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var l net.Listener
+	for i, inherited := range h.inherited {
+		if samePort(inherited.Addr().String(), addr) {
+			l = inherited
+			h.inherited = append(h.inherited[:i], h.inherited[i+1:]...)
+			logger.Debugf(h.log, "Serving %s on the inherited listener %s\n", name, l.Addr())
+			break
+		}
+	}
+	if l == nil {
+		var err error
+		if l, err = net.Listen("tcp", addr); err != nil {
+			return nil, err
+		}
+	}
+	h.listening[name] = l
+	h.names = append(h.names, name)
+	return l, nil
+}
+
+func samePort(a, b string) bool {
+	_, portA, errA := net.SplitHostPort(a)
+	_, portB, errB := net.SplitHostPort(b)
+	return errA == nil && errB == nil && portA == portB
+}
+
+// ready tells the previous process this one is running so it can drain & exit. Inherited listeners no
+// server wanted are closed, otherwise connections to them would never be accepted
+func (h *handoff) ready() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, l := range h.inherited {
+		l.Close() // e.g. the port's been reconfigured
+	}
+	h.inherited = nil
+	if h.parent != nil {
+		fmt.Fprintln(h.parent, "ready")
+		h.parent.Close()
+		h.parent = nil
+	}
+}
+
+// abandon tells the previous process this one won't be running, it carries on instead
+func (h *handoff) abandon() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.parent != nil {
+		h.parent.Close()
+		h.parent = nil
+	}
+}
+
+// Report to the previous process once this one's running, or once it's given up
+func (h *handoff) reportToParent() {
+	ch, stop := SubscribeLifecycle()
+	go func() {
+		defer stop()
+		for t := range ch {
+			switch t.To {
+			case LifecycleRunning:
+				h.ready()
+				return
+			case LifecycleStopping, LifecycleFailed:
+				h.abandon()
+				return
+			}
+		}
+	}()
+}
+
+// upgrade starts a new process with the listeners and waits until it's running, it returns its pid
+// systemd is told the new process is the main one as soon as it starts, so it hears it report in
+func (h *handoff) upgrade() (int, error) {
+	h.mu.Lock()
+	names := append([]string(nil), h.names...)
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, name := range names {
+		l, ok := h.listening[name].(interface{ File() (*os.File, error) })
+		if !ok {
+			h.mu.Unlock()
+			return 0, fmt.Errorf("can't hand over the %s listener", name)
+		}
+		f, err := l.File() // a copy of the descriptor for the new process
+		if err != nil {
+			h.mu.Unlock()
+			return 0, fmt.Errorf("can't hand over the %s listener: %w", name, err)
+		}
+		files = append(files, f)
+	}
+	h.mu.Unlock()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	cmd := h.command()
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	env = withoutEnv(withoutEnv(env, listenersEnv), "WATCHDOG_PID") // systemd's watchdog is the new process's to ping once it's the main one
+	cmd.Env = append(env, listenersEnv+"="+strings.Join(names, ","))
+	cmd.ExtraFiles = append([]*os.File{w}, files...)
+	err = cmd.Start()
+	w.Close() // the new process has its own copy, ours would keep the pipe open if it died
+	if err != nil {
+		return 0, err
+	}
+	pid := cmd.Process.Pid
+	h.notifier.handOver(pid)
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	readied := make(chan bool, 1)
+	go func() {
+		line, _ := bufio.NewReader(r).ReadString('\n')
+		readied <- line == "ready\n"
+	}()
+	select {
+	case ok := <-readied:
+		if ok {
+			return pid, nil
+		}
+		err = fmt.Errorf("pid %d gave up before it was running", pid)
+	case exit := <-exited:
+		err = fmt.Errorf("pid %d exited before it was running: %v", pid, exit)
+	case <-time.After(h.timeout):
+		cmd.Process.Kill()
+		err = fmt.Errorf("pid %d wasn't running within %s", pid, h.timeout)
+	}
+	h.notifier.takeBack()
+	return 0, err
+}
+
+func withoutEnv(env []string, name string) []string {
+	var kept []string
+	for _, kv := range env {
+		if !strings.HasPrefix(kv, name+"=") {
+			kept = append(kept, kv)
+		}
+	}
+	return kept
+}
+
+// Hand the listeners over to a new process on SIGUSR2, once it's running this one moves to Stopping and
+// the returned context, derived from stop, is cancelled so it drains & exits. If the new process doesn't
+// make it this one carries on. SIGUSR2 is handled until ctx is done, when the app exits, so another one
+// while draining is refused rather than given the default treatment
+func setupUpgradeHandler(ctx, stop context.Context, h *handoff) context.Context {
+	stop, handOver := context.WithCancel(stop)
+	usr2 := make(chan os.Signal, 1)
+	signal.Notify(usr2, upgradeSignals...)
+	go func() {
+		defer handOver()
+		defer signal.Stop(usr2)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-usr2:
+				if state := GetLifecycleState(); state != LifecycleRunning {
+					logger.Warnf(h.log, "Not upgrading while %s\n", state)
+					continue
+				}
+				h.log.Println("Upgrading, starting a new process with the listeners")
+				pid, err := h.upgrade()
+				if err != nil {
+					logger.Errorf(h.log, "Could not upgrade, carrying on: %v\n", err)
+					continue
+				}
+				transitionToStopping(fmt.Sprintf("handed over to pid %d", pid)) // transition RUNNING -> STOPPING
+				handOver()
+			}
+		}
+	}()
+	return stop
+}
@@ -0,0 +1,280 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// The new process started by an upgrade runs this test binary again as this helper
+func helperCommand(mode, addr string) func() *exec.Cmd {
+	return func() *exec.Cmd {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestUpgradeHelperProcess$")
+		cmd.Env = append(os.Environ(), "MINGO_UPGRADE_HELPER="+mode, "MINGO_UPGRADE_ADDR="+addr)
+		return cmd
+	}
+}
+
+// Not a real test, see helperCommand
+func TestUpgradeHelperProcess(t *testing.T) {
+	mode := os.Getenv("MINGO_UPGRADE_HELPER")
+	if mode == "" {
+		return
+	}
+	if mode == "systemd" {
+		os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid())) // systemd sets it once it knows the pid
+	}
+	h := newHandoff(log.New(io.Discard, "", 0))
+	n := newNotifier(log.New(io.Discard, "", 0)) // nil unless the test set $NOTIFY_SOCKET
+	n.takingOver(os.Getppid())
+	stopNotifying := n.reportLifecycle()
+	switch mode {
+	case "serve", "systemd":
+		l, err := h.listen("http", os.Getenv("MINGO_UPGRADE_ADDR"))
+		if err != nil || os.Getenv("LISTEN_FDS") != "" || os.Getenv(listenersEnv) != "" {
+			os.Exit(1)
+		}
+		attemptTransitionToRunning()
+		stopNotifying() // READY=1 is sent before the previous process hears this one's running
+		h.ready()
+		l.(*net.TCPListener).SetDeadline(time.Now().Add(10 * time.Second))
+		if conn, err := l.Accept(); err == nil {
+			fmt.Fprintf(conn, "pid %d\n", os.Getpid())
+			conn.Close()
+		}
+	case "give up":
+		transitionToStopping("could not start http")
+		stopNotifying()
+		h.abandon()
+		time.Sleep(time.Second)
+	case "hang":
+		time.Sleep(10 * time.Second)
+	}
+	os.Exit(0)
+}
+
+func TestUpgradeHandsListenersToTheNewProcess(t *testing.T) {
+	h := newHandoff(log.New(io.Discard, "", 0))
+	l, err := h.listen("http", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.command = helperCommand("serve", l.Addr().String())
+
+	pid, err := h.upgrade()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close() // as this process does once it's drained, the socket stays open in the new one
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("the new process isn't listening: %v", err)
+	}
+	defer conn.Close()
+	reply, _ := io.ReadAll(conn)
+	if want := fmt.Sprintf("pid %d\n", pid); string(reply) != want {
+		t.Errorf("got %q, want %q", reply, want)
+	}
+}
+
+func TestUpgradeCarriesOnWhenTheNewProcessDoesnt(t *testing.T) {
+	for mode, want := range map[string]string{"give up": "before it was running", "hang": "wasn't running within"} {
+		h := newHandoff(log.New(io.Discard, "", 0))
+		l, err := h.listen("http", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.command = helperCommand(mode, l.Addr().String())
+		h.timeout = 200 * time.Millisecond
+
+		if _, err := h.upgrade(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s got %v, want %q", mode, err, want)
+		}
+		l.Close()
+	}
+}
+
+// Log lines as they're written, for tests waiting on another goroutine
+type logLines chan string
+
+func (l logLines) Write(p []byte) (int, error) {
+	l <- string(p)
+	return len(p), nil
+}
+
+func (l logLines) await(t *testing.T, want string) {
+	t.Helper()
+	for {
+		select {
+		case line := <-l:
+			if strings.Contains(line, want) {
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("log never said %q", want)
+		}
+	}
+}
+
+func TestUpgradeSignal(t *testing.T) {
+	teardown := setupLifecycle()
+	defer teardown()
+	attemptTransitionToRunning()
+	lines := make(logLines, 10)
+	h := newHandoff(log.New(lines, "", 0))
+	l, err := h.listen("http", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	h.timeout = 500 * time.Millisecond
+	var mode atomic.Value // what the next new process does, set here & read by the signal handler
+	h.command = func() *exec.Cmd { return helperCommand(mode.Load().(string), l.Addr().String())() }
+	ch, unsubscribe := SubscribeLifecycle()
+	defer unsubscribe()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := setupUpgradeHandler(ctx, ctx, h)
+
+	for _, m := range []string{"give up", "hang"} {
+		mode.Store(m)
+		syscall.Kill(syscall.Getpid(), syscall.SIGUSR2)
+		lines.await(t, "Upgrading, starting a new process")
+		if state := GetLifecycleState(); state != LifecycleRunning {
+			t.Errorf("%s: lifecycle got %v while upgrading, want LifecycleRunning", m, state)
+		}
+		lines.await(t, "Could not upgrade, carrying on")
+		if state := GetLifecycleState(); state != LifecycleRunning || stop.Err() != nil {
+			t.Errorf("%s: lifecycle got %v, stopping %v, want this process carrying on", m, state, stop.Err())
+		}
+	}
+
+	mode.Store("serve")
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR2)
+	var transition LifecycleTransition
+	select {
+	case transition = <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatal("didn't hand over")
+	}
+	select {
+	case <-stop.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("handing over didn't stop this process")
+	}
+	l.Close()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("the new process isn't listening: %v", err)
+	}
+	reply, _ := io.ReadAll(conn)
+	conn.Close()
+	want := LifecycleTransition{From: LifecycleRunning, To: LifecycleStopping, Reason: "handed over to pid " + strings.TrimSpace(strings.TrimPrefix(string(reply), "pid "))}
+	if transition.From != want.From || transition.To != want.To || transition.Reason != want.Reason {
+		t.Errorf("transition got %+v, want %+v", transition, want)
+	}
+
+	// Still handled while draining, the default treatment would be to ignore it silently
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR2)
+	lines.await(t, "Not upgrading while stopping")
+}
+
+// systemd is told the new process is the main one before it reports ready, with NotifyAccess=main it
+// would otherwise drop the READY=1, and told this one is again when the new one doesn't make it
+func TestUpgradeNotifiesSystemdInOrder(t *testing.T) {
+	sock := fakeNotifySocket(t)
+	upgrade := func(mode string) (int, error) {
+		n := newNotifier(log.New(io.Discard, "", 0))
+		defer n.Close()
+		h := newHandoff(log.New(io.Discard, "", 0))
+		h.notifier = n
+		l, err := h.listen("http", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		h.command = helperCommand(mode, l.Addr().String())
+		h.timeout = 5 * time.Second
+		pid, err := h.upgrade()
+		n.notify("WATCHDOG=1")
+		if pid != 0 {
+			l.Close()
+			if conn, err := net.Dial("tcp", l.Addr().String()); err == nil { // lets the new process exit
+				io.ReadAll(conn)
+				conn.Close()
+			}
+		}
+		return pid, err
+	}
+
+	pid, err := upgrade("serve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{fmt.Sprintf("MAINPID=%d", pid), "READY=1\nSTATUS=running, all components started"} {
+		if got := received(sock, time.Second); got != want {
+			t.Errorf("handing over got %q, want %q", got, want)
+		}
+	}
+	if got := received(sock, 100*time.Millisecond); got != "" {
+		t.Errorf("got %q once handed over, want nothing from this process", got)
+	}
+
+	if _, err := upgrade("give up"); err == nil {
+		t.Fatal("upgrade err want the new process giving up, got nil")
+	}
+	self := fmt.Sprintf("MAINPID=%d", os.Getpid())
+	if got := received(sock, time.Second); !strings.HasPrefix(got, "MAINPID=") || got == self {
+		t.Errorf("got %q, want the new process's MAINPID", got)
+	}
+	for _, want := range []string{self, self, "WATCHDOG=1"} { // given back by the new process then taken back by this one
+		if got := received(sock, time.Second); got != want {
+			t.Errorf("giving up got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestInheritedListenersAreTakenByPort(t *testing.T) {
+	unused, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inherited, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inherited.Close()
+	h := newHandoff(log.New(io.Discard, "", 0))
+	h.inherited = []net.Listener{unused, inherited}
+
+	if l, err := h.listen("http", "0.0.0.0:"+port(inherited)); err != nil || l != inherited {
+		t.Errorf("got %v %v, want the inherited listener on the same port", l, err)
+	}
+	l, err := h.listen("redirect", "127.0.0.1:0") // e.g. a port that's been reconfigured
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if l == unused {
+		t.Error("got an inherited listener on another port")
+	}
+	h.ready()
+	if _, err := unused.Accept(); err == nil {
+		t.Error("inherited listener no server wanted left open once ready")
+	}
+}
+
+func port(l net.Listener) string {
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	return port
+}
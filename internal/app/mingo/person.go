@@ -2,7 +2,7 @@ package mingo
 
 // Person model for CRUD App
 type Person struct {
-	Id       int
-	Name     string
-	Location string
+	Id       int    `json:"id"`
+	Name     string `json:"name"`
+	Location string `json:"location"`
 }
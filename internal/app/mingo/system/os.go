@@ -21,3 +21,11 @@ func Hostname() (string, error) {
 	}
 	return hostname, nil
 }
+
+func ConfigDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", errors.ErrUnknownConfigDir
+	}
+	return dir, nil
+}
@@ -0,0 +1,29 @@
+package system
+
+import (
+	"io"
+	"os"
+	"os/exec"
+)
+
+// IsTerminal reports whether r is an interactive terminal rather than e.g. a pipe
+func IsTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// SetEcho turns the terminal's echo of typed characters on or off, e.g. while a password is typed
+// Shelling out to stty avoids platform specific ioctls
+func SetEcho(terminal *os.File, on bool) error {
+	mode := "-echo"
+	if on {
+		mode = "echo"
+	}
+	cmd := exec.Command("stty", mode)
+	cmd.Stdin = terminal
+	return cmd.Run()
+}
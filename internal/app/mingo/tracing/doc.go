@@ -0,0 +1,3 @@
+// Package tracing follows requests through mingo: W3C Trace Context propagation, spans carried on a
+// context.Context and export of finished spans as OTLP JSON to a file or a collector
+package tracing
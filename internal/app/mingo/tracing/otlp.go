@@ -0,0 +1,182 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// The OTLP/JSON encoding of an ExportTraceServiceRequest, ids are hex and 64 bit integers are strings
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceId           string         `json:"traceId"`
+	SpanId            string         `json:"spanId"`
+	TraceState        string         `json:"traceState,omitempty"`
+	ParentSpanId      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"` // 0 unset, 2 error
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func encodeOtlp(service string, spans []*Span) ([]byte, error) {
+	scope := otlpScopeSpans{Scope: otlpScope{"mingo"}}
+	for _, s := range spans {
+		s.mu.Lock()
+		o := otlpSpan{
+			TraceId:           s.sc.TraceID.String(),
+			SpanId:            s.sc.SpanID.String(),
+			TraceState:        s.sc.State,
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+		if s.parent.IsValid() {
+			o.ParentSpanId = s.parent.String()
+		}
+		for _, a := range s.attrs {
+			o.Attributes = append(o.Attributes, otlpAttribute(a.key, a.value))
+		}
+		if s.failed {
+			o.Status = otlpStatus{2, s.message}
+		}
+		s.mu.Unlock()
+		scope.Spans = append(scope.Spans, o)
+	}
+	return json.Marshal(otlpRequest{[]otlpResourceSpans{{
+		Resource:   otlpResource{[]otlpKeyValue{otlpAttribute("service.name", service)}},
+		ScopeSpans: []otlpScopeSpans{scope},
+	}}})
+}
+
+func otlpAttribute(key string, value interface{}) otlpKeyValue {
+	var v otlpAnyValue
+	switch value := value.(type) {
+	case string:
+		v.StringValue = &value
+	case bool:
+		v.BoolValue = &value
+	case int:
+		i := strconv.Itoa(value)
+		v.IntValue = &i
+	case int64:
+		i := strconv.FormatInt(value, 10)
+		v.IntValue = &i
+	case float64:
+		v.DoubleValue = &value
+	default:
+		s := fmt.Sprint(value)
+		v.StringValue = &s
+	}
+	return otlpKeyValue{key, v}
+}
+
+// FileExporter writes each batch as a line of OTLP JSON, the format the OpenTelemetry collector's file
+// exporter writes and its otlpjsonfile receiver reads
+type FileExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewFileExporter(w io.Writer) *FileExporter {
+	return &FileExporter{w: w}
+}
+
+func (e *FileExporter) Export(ctx context.Context, service string, spans []*Span) error {
+	b, err := encodeOtlp(service, spans)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.w.Write(append(b, '\n'))
+	return err
+}
+
+func (e *FileExporter) Close() error {
+	if c, ok := e.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// HttpExporter posts each batch to a collector's OTLP/HTTP endpoint, e.g. http://localhost:4318/v1/traces
+type HttpExporter struct {
+	url    string
+	client *http.Client
+}
+
+func NewHttpExporter(url string, client *http.Client) *HttpExporter {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HttpExporter{url, client}
+}
+
+func (e *HttpExporter) Export(ctx context.Context, service string, spans []*Span) error {
+	b, err := encodeOtlp(service, spans)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type SpanKind int
+
+// The OTLP span kinds mingo creates
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+// Span is one timed operation within a trace
+// A nil *Span is a valid no-op, so code needn't check whether its context is being traced
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+	parent SpanID
+	name   string
+	kind   SpanKind
+	start  time.Time
+
+	mu      sync.Mutex
+	end     time.Time
+	attrs   []attribute
+	failed  bool
+	message string
+}
+
+type attribute struct {
+	key   string
+	value interface{}
+}
+
+type spanKey struct{}
+
+// FromContext is the context's current span, nil when it isn't being traced
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Start a child of the context's span, it ends when End is called
+func Start(ctx context.Context, kind SpanKind, name string) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	sc := parent.sc
+	sc.SpanID = newSpanID()
+	span := parent.tracer.newSpan(sc, parent.sc.SpanID, kind, name)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetAttribute records a string, bool, int, int64 or float64 about the operation, e.g. http.status_code
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, attribute{key, value})
+}
+
+// SetError marks the operation as failed
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed, s.message = true, err.Error()
+}
+
+// End the span and queue it for export, later calls do nothing
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = s.tracer.clock()
+	s.mu.Unlock()
+	if s.sc.Sampled() {
+		s.tracer.enqueue(s)
+	}
+}
@@ -0,0 +1,103 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type TraceID [16]byte
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+// All zero ids are invalid in W3C Trace Context
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+func (s SpanID) IsValid() bool  { return s != SpanID{} }
+
+func newTraceID() TraceID {
+	var t TraceID
+	for !t.IsValid() {
+		rand.Read(t[:])
+	}
+	return t
+}
+
+func newSpanID() SpanID {
+	var s SpanID
+	for !s.IsValid() {
+		rand.Read(s[:])
+	}
+	return s
+}
+
+const flagSampled = 0x01
+
+// SpanContext is the part of a span that crosses process boundaries in the traceparent & tracestate headers
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Flags   byte
+	State   string // tracestate, passed along untouched
+}
+
+func (sc SpanContext) IsValid() bool { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+func (sc SpanContext) Sampled() bool { return sc.Flags&flagSampled != 0 }
+
+// Traceparent formats the version 00 header, e.g. 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// ParseTraceparent reads a traceparent header, accepting future versions' extra fields as the spec asks
+func ParseTraceparent(header string) (SpanContext, error) {
+	var sc SpanContext
+	var version, flags [1]byte
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || !decodeHex(version[:], parts[0]) || version[0] == 0xff || (version[0] == 0 && len(parts) != 4) ||
+		!decodeHex(sc.TraceID[:], parts[1]) || !decodeHex(sc.SpanID[:], parts[2]) || !decodeHex(flags[:], parts[3]) {
+		return sc, fmt.Errorf("malformed traceparent %q", header)
+	}
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return sc, fmt.Errorf("traceparent %q has an all zero id", header)
+	}
+	return sc, nil
+}
+
+// Exactly len(dst) bytes of lowercase hex
+func decodeHex(dst []byte, s string) bool {
+	if len(s) != 2*len(dst) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// Extract the caller's span context from request headers, tracestate only counts alongside a valid traceparent
+func Extract(h http.Header) (SpanContext, bool) {
+	sc, err := ParseTraceparent(h.Get("traceparent"))
+	if err != nil {
+		return SpanContext{}, false
+	}
+	if state := strings.Join(h.Values("tracestate"), ","); len(state) <= 512 {
+		sc.State = state
+	}
+	return sc, true
+}
+
+// Inject the context's span into outgoing request headers so the next service continues the trace
+func Inject(ctx context.Context, h http.Header) {
+	span := FromContext(ctx)
+	if span == nil {
+		return
+	}
+	h.Set("traceparent", span.sc.Traceparent())
+	if span.sc.State != "" {
+		h.Set("tracestate", span.sc.State)
+	}
+}
@@ -0,0 +1,63 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	const valid = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceparent(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || !sc.Sampled() {
+		t.Errorf("got %+v", sc)
+	}
+	if got := sc.Traceparent(); got != valid {
+		t.Errorf("round trip got %s", got)
+	}
+
+	for header, wantErr := range map[string]bool{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00":        false,
+		"cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future": false,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra":  true,
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01":        true,
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01":        true,
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01":        true,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01":        true,
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01":         true,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-zz":        true,
+		"": true,
+	} {
+		if _, err := ParseTraceparent(header); (err != nil) != wantErr {
+			t.Errorf("%q err got %v, want error %v", header, err, wantErr)
+		}
+	}
+}
+
+func TestExtractAndInject(t *testing.T) {
+	in := http.Header{}
+	in.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	in.Add("tracestate", "vendor=a")
+	in.Add("tracestate", "other=b")
+	tracer := NewTracer(system.ClockForTesting("2022-04-30T23:59:59Z"), "test", nil, nil)
+	ctx, span := tracer.StartRequest(context.Background(), in, "GET /")
+	if span.parent.String() != "00f067aa0ba902b7" || span.sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || span.sc.State != "vendor=a,other=b" {
+		t.Errorf("server span got %+v", span)
+	}
+
+	out := http.Header{}
+	Inject(ctx, out)
+	if want := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + span.sc.SpanID.String() + "-01"; out.Get("traceparent") != want || out.Get("tracestate") != "vendor=a,other=b" {
+		t.Errorf("injected %v, want traceparent %s", out, want)
+	}
+
+	Inject(context.Background(), out)
+	if _, ok := Extract(http.Header{"Tracestate": {"vendor=a"}}); ok {
+		t.Error("tracestate without traceparent extracted")
+	}
+}
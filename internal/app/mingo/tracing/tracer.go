@@ -0,0 +1,154 @@
+package tracing
+
+import (
+	"context"
+	"expvar"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/logger"
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+var tracingMetrics = expvar.NewMap("tracing")
+
+const (
+	queueSize     = 2048
+	maxBatch      = 256
+	flushInterval = 5 * time.Second
+	exportTimeout = 10 * time.Second
+)
+
+// Exporter sends a batch of finished spans somewhere
+type Exporter interface {
+	Export(ctx context.Context, service string, spans []*Span) error
+}
+
+// Tracer starts request spans and exports finished ones in the background, in batches
+// Spans are dropped rather than slow requests down when the exporter can't keep up
+type Tracer struct {
+	clock    system.Clock
+	service  string
+	exporter Exporter
+	log      *log.Logger
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan *Span
+	done   chan struct{}
+	abort  context.CancelFunc // cancels exports, when Close can't wait for them
+	export context.Context
+}
+
+// NewTracer with a nil exporter still propagates trace context, it just keeps no spans
+func NewTracer(clock system.Clock, service string, exporter Exporter, log *log.Logger) *Tracer {
+	t := &Tracer{clock: clock, service: service, exporter: exporter, log: log}
+	if exporter != nil {
+		t.queue = make(chan *Span, queueSize)
+		t.done = make(chan struct{})
+		t.export, t.abort = context.WithCancel(context.Background())
+		go t.run(flushInterval)
+	}
+	return t
+}
+
+// StartRequest begins the server span for an incoming request, joining the caller's trace when it sent a
+// valid traceparent and following its sampling decision, otherwise starting a new sampled trace
+func (t *Tracer) StartRequest(ctx context.Context, h http.Header, name string) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	parent, ok := Extract(h)
+	sc := parent
+	if !ok {
+		sc = SpanContext{TraceID: newTraceID(), Flags: flagSampled}
+	}
+	sc.SpanID = newSpanID()
+	span := t.newSpan(sc, parent.SpanID, KindServer, name)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func (t *Tracer) newSpan(sc SpanContext, parent SpanID, kind SpanKind, name string) *Span {
+	return &Span{tracer: t, sc: sc, parent: parent, name: name, kind: kind, start: t.clock()}
+}
+
+func (t *Tracer) enqueue(s *Span) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.queue == nil || t.closed {
+		return
+	}
+	select {
+	case t.queue <- s:
+	default:
+		tracingMetrics.Add("spans_dropped", 1)
+	}
+}
+
+func (t *Tracer) run(interval time.Duration) {
+	defer close(t.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(t.export, exportTimeout)
+		defer cancel()
+		if err := t.exporter.Export(ctx, t.service, batch); err != nil {
+			tracingMetrics.Add("export_errors", 1)
+			logger.Warnf(t.log, "could not export %d spans: %v\n", len(batch), err)
+		} else {
+			tracingMetrics.Add("spans_exported", int64(len(batch)))
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case s, ok := <-t.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, s)
+			if len(batch) >= maxBatch {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Close exports the spans still queued then releases the exporter, spans ending afterwards are dropped
+// Once ctx is done the export in flight is cancelled and whatever is still queued is dropped
+func (t *Tracer) Close(ctx context.Context) error {
+	if t == nil || t.queue == nil {
+		return nil
+	}
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	close(t.queue)
+	t.mu.Unlock()
+
+	defer t.abort()
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if c, ok := t.exporter.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
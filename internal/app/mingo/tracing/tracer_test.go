@@ -0,0 +1,151 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/craigjperry2/mingo/internal/app/mingo/system"
+)
+
+func TestSpansExportAsOtlpJson(t *testing.T) {
+	var out bytes.Buffer
+	tracer := NewTracer(system.ClockForTesting("2022-04-30T23:59:59Z"), "mingo-test", NewFileExporter(&out), log.New(io.Discard, "", 0))
+
+	ctx, root := tracer.StartRequest(context.Background(), http.Header{}, "GET /api/people")
+	root.SetAttribute("http.status_code", 200)
+	_, child := Start(ctx, KindClient, "sqlite GetAll")
+	child.SetAttribute("db.system", "sqlite")
+	child.SetError(errors.New("database is locked"))
+	child.End()
+	root.End()
+	root.End() // only exported once
+	if err := tracer.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines, want one batch: %s", len(lines), out.String())
+	}
+	var req otlpRequest
+	if err := json.Unmarshal([]byte(lines[0]), &req); err != nil {
+		t.Fatal(err)
+	}
+	rs := req.ResourceSpans[0]
+	if kv := rs.Resource.Attributes[0]; kv.Key != "service.name" || *kv.Value.StringValue != "mingo-test" {
+		t.Errorf("resource got %+v", rs.Resource)
+	}
+	spans := rs.ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	db, http := spans[0], spans[1]
+	if db.TraceId != http.TraceId || db.ParentSpanId != http.SpanId || http.ParentSpanId != "" || len(http.TraceId) != 32 || len(http.SpanId) != 16 {
+		t.Errorf("ids got db %+v http %+v", db, http)
+	}
+	if db.Kind != KindClient || http.Kind != KindServer || db.Status.Code != 2 || db.Status.Message != "database is locked" {
+		t.Errorf("kinds/status got db %+v http %+v", db, http)
+	}
+	if http.StartTimeUnixNano != "1651363199000000000" || *http.Attributes[0].Value.IntValue != "200" {
+		t.Errorf("http span got %+v", http)
+	}
+}
+
+func TestUnsampledCallersAreFollowed(t *testing.T) {
+	exported := 0
+	tracer := NewTracer(system.NewClock(), "mingo-test", exporterFunc(func(ctx context.Context, spans []*Span) error { exported += len(spans); return nil }), log.New(io.Discard, "", 0))
+	h := http.Header{}
+	h.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	ctx, root := tracer.StartRequest(context.Background(), h, "GET /")
+	_, child := Start(ctx, KindInternal, "work")
+	if child.SpanContext().Sampled() || child.SpanContext().TraceID != root.SpanContext().TraceID {
+		t.Errorf("child got %+v", child.SpanContext())
+	}
+	child.End()
+	root.End()
+	tracer.Close(context.Background())
+	if exported != 0 {
+		t.Errorf("exported %d unsampled spans", exported)
+	}
+
+	if _, span := Start(context.Background(), KindInternal, "untraced"); span != nil {
+		t.Error("span started without a traced context")
+	}
+	var nothing *Span
+	nothing.SetAttribute("k", "v")
+	nothing.End()
+}
+
+// A collector that stops answering mustn't hold up the shutdown past its deadline
+func TestCloseGivesUpAtTheDeadline(t *testing.T) {
+	abandoned := make(chan error, 1)
+	tracer := NewTracer(system.NewClock(), "mingo-test", exporterFunc(func(ctx context.Context, spans []*Span) error {
+		<-ctx.Done()
+		abandoned <- ctx.Err()
+		return ctx.Err()
+	}), log.New(io.Discard, "", 0))
+	_, span := tracer.StartRequest(context.Background(), http.Header{}, "GET /")
+	span.End()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := tracer.Close(ctx); err != context.DeadlineExceeded {
+		t.Errorf("close err got %v, want the deadline's", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("close took %v, want it back by the deadline", elapsed)
+	}
+	select {
+	case err := <-abandoned:
+		if err != context.Canceled {
+			t.Errorf("export ended with %v, want it cancelled", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("export still running after close gave up")
+	}
+}
+
+func TestHttpExporter(t *testing.T) {
+	var got otlpRequest
+	status := http.StatusOK
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost || req.URL.Path != "/v1/traces" || req.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s %s %s", req.Method, req.URL.Path, req.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(req.Body).Decode(&got)
+		w.WriteHeader(status)
+	}))
+	defer collector.Close()
+
+	e := NewHttpExporter(collector.URL+"/v1/traces", collector.Client())
+	tracer := NewTracer(system.NewClock(), "mingo-test", nil, nil)
+	_, span := tracer.StartRequest(context.Background(), http.Header{}, "GET /")
+	span.end = span.start
+	if err := e.Export(context.Background(), "mingo-test", []*Span{span}); err != nil {
+		t.Fatal(err)
+	}
+	if got.ResourceSpans[0].ScopeSpans[0].Spans[0].Name != "GET /" {
+		t.Errorf("collector got %+v", got)
+	}
+
+	status = http.StatusServiceUnavailable
+	if err := e.Export(context.Background(), "mingo-test", []*Span{span}); err == nil {
+		t.Error("collector failure not reported")
+	}
+}
+
+type exporterFunc func(ctx context.Context, spans []*Span) error
+
+func (f exporterFunc) Export(ctx context.Context, service string, spans []*Span) error {
+	return f(ctx, spans)
+}
@@ -0,0 +1,33 @@
+package mingo
+
+import "time"
+
+// User account that can log in to the CRUD UI
+type User struct {
+	Id           int
+	Username     string
+	PasswordHash string
+	Role         string
+	Disabled     bool
+	CreatedAt    time.Time
+}
+
+// Session of a logged in user, the session token itself is never stored only its hash
+type Session struct {
+	IdHash    string
+	UserId    int
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// ApiToken lets scripts act as a user, the secret itself is never stored only its hash
+type ApiToken struct {
+	Id         string
+	UserId     int
+	Name       string
+	SecretHash string
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time // zero for a token that never expires
+	LastUsedAt time.Time // zero until first use
+}
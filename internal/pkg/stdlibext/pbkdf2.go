@@ -0,0 +1,43 @@
+package stdlibext
+
+import (
+	"crypto/hmac"
+	"encoding/binary"
+	"hash"
+)
+
+// --- There's no password based key derivation in stdlib ---------------------
+
+// PBKDF2 as per RFC 8018 section 5.2, golang.org/x/crypto/pbkdf2 has it but i want to stick with zero external deps
+// e.g. Pbkdf2([]byte("password"), salt, 600000, 32, sha256.New)
+func Pbkdf2(password []byte, salt []byte, iterations int, keyLen int, h func() hash.Hash) []byte {
+	prf := hmac.New(h, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	var counter [4]byte
+	derived := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		// U1 = PRF(password, salt || INT(block))
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(counter[:], uint32(block))
+		prf.Write(counter[:])
+		u = prf.Sum(u[:0])
+		t := make([]byte, hashLen)
+		copy(t, u)
+
+		// T = U1 ^ U2 ^ ... ^ Uc
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		derived = append(derived, t...)
+	}
+	return derived[:keyLen]
+}
@@ -0,0 +1,39 @@
+package stdlibext
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"testing"
+)
+
+func TestPbkdf2(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		password   string
+		salt       string
+		iterations int
+		keyLen     int
+		h          func() hash.Hash
+		want       string
+	}{
+		// RFC 6070 test vectors
+		{"sha1 c=1", "password", "salt", 1, 20, sha1.New, "0c60c80f961f0e71f3a9b524af6012062fe037a6"},
+		{"sha1 c=2", "password", "salt", 2, 20, sha1.New, "ea6c014dc72d6f8ccd1ed92ace1d41f0d8de8957"},
+		{"sha1 c=4096", "password", "salt", 4096, 20, sha1.New, "4b007901b765489abead49d926f721d065a429c1"},
+		{"sha1 multi block", "passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096, 25, sha1.New, "3d2eec4fe41c849b80c8d83662c0e44a8b291a964cf2f07038"},
+		{"sha1 nul", "pass\x00word", "sa\x00lt", 4096, 16, sha1.New, "56fa6aa75548099dcc37d7f03425e0c3"},
+		// Widely published PBKDF2-HMAC-SHA256 vectors
+		{"sha256 c=1", "password", "salt", 1, 32, sha256.New, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{"sha256 c=4096", "password", "salt", 4096, 32, sha256.New, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.desc, func(t *testing.T) {
+			got := hex.EncodeToString(Pbkdf2([]byte(tt.password), []byte(tt.salt), tt.iterations, tt.keyLen, tt.h))
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,3 +4,6 @@ import "embed"
 
 //go:embed static
 var StaticDir embed.FS
+
+//go:embed templates
+var Templates embed.FS
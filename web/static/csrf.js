@@ -0,0 +1,28 @@
+// Echo the session's CSRF token, which the server puts in the mingo_csrf cookie, on every state change
+(function () {
+    function csrfToken() {
+        var match = document.cookie.match(/(?:^|;\s*)mingo_csrf=([^;]*)/);
+        return match ? decodeURIComponent(match[1]) : "";
+    }
+
+    // htmx requests carry it as a header
+    document.addEventListener("htmx:configRequest", function (event) {
+        event.detail.headers["X-CSRF-Token"] = csrfToken();
+    });
+
+    // Plain HTML forms carry it as a hidden field
+    document.addEventListener("submit", function (event) {
+        var form = event.target;
+        if ((form.method || "").toLowerCase() !== "post") {
+            return;
+        }
+        var field = form.querySelector("input[name=csrf_token]");
+        if (!field) {
+            field = document.createElement("input");
+            field.type = "hidden";
+            field.name = "csrf_token";
+            form.appendChild(field);
+        }
+        field.value = csrfToken();
+    }, true);
+})();